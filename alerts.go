@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const defaultAlertAfterFailures = 2
+
+// AlertsConfig posts to a Slack or Discord incoming webhook when cycles keep
+// failing, or when too many posts in a cycle can't be fetched.
+type AlertsConfig struct {
+	Webhook string `json:"webhook"`
+	// AfterFailures is how many cycles in a row have to fail before alerting.
+	AfterFailures int `json:"afterFailures"`
+	// MaxFailureRate alerts when more than this fraction of a cycle's posts
+	// could not be fetched, ignoring cycles smaller than MinPosts.
+	MaxFailureRate float64 `json:"maxFailureRate"`
+	MinPosts       int     `json:"minPosts"`
+}
+
+type alerter struct {
+	config     AlertsConfig
+	httpClient *http.Client
+
+	mu sync.Mutex
+	// failures counts consecutive failed cycles per tenant
+	failures map[string]int
+	// incidents are the alerts that fired and haven't been resolved yet, so
+	// each fires once until whatever raised it is fixed
+	incidents map[string]bool
+}
+
+// alerts is configured by applyConfig. With no webhook configured it only
+// logs.
+var alerts = newAlerter(AlertsConfig{})
+
+func newAlerter(config AlertsConfig) *alerter {
+	a := &alerter{
+		httpClient: &http.Client{},
+		failures:   make(map[string]int),
+		incidents:  make(map[string]bool),
+	}
+	a.configure(config)
+
+	return a
+}
+
+// configure applies a (re)loaded config, keeping the failure counts.
+func (a *alerter) configure(config AlertsConfig) {
+	if config.AfterFailures <= 0 {
+		config.AfterFailures = defaultAlertAfterFailures
+	}
+
+	a.mu.Lock()
+	a.config = config
+	a.mu.Unlock()
+}
+
+func (a *alerter) currentConfig() AlertsConfig {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.config
+}
+
+// cycleFailed alerts once a tenant's cycles have failed AfterFailures times
+// in a row.
+func (a *alerter) cycleFailed(tenant string, reason string) {
+	a.mu.Lock()
+	a.failures[tenant]++
+	failures := a.failures[tenant]
+	afterFailures := a.config.AfterFailures
+	a.mu.Unlock()
+
+	if failures >= afterFailures {
+		a.raise("cycles:"+tenant, fmt.Sprintf("%d cycles in a row failed%s: %s", failures, tenantSuffix(tenant), reason))
+	}
+}
+
+// cycleSucceeded resets the failure count, saying so if an alert was sent.
+func (a *alerter) cycleSucceeded(tenant string) {
+	a.mu.Lock()
+	failures := a.failures[tenant]
+	a.failures[tenant] = 0
+	a.mu.Unlock()
+
+	a.resolve("cycles:"+tenant, fmt.Sprintf("cycles are succeeding again%s after %d failures", tenantSuffix(tenant), failures))
+}
+
+// checkFailureRate alerts when a cycle could fetch too few of its posts, and
+// again once a cycle fetches enough of them.
+func (a *alerter) checkFailureRate(tenant string, posts int, failed int) {
+	config := a.currentConfig()
+	if config.MaxFailureRate <= 0 || posts == 0 || posts < config.MinPosts {
+		return
+	}
+
+	rate := float64(failed) / float64(posts)
+	if rate > config.MaxFailureRate {
+		a.raise("failureRate:"+tenant, fmt.Sprintf("%d of %d posts (%.0f%%) could not be fetched%s", failed, posts, rate*100, tenantSuffix(tenant)))
+		return
+	}
+
+	a.resolve("failureRate:"+tenant, fmt.Sprintf("posts are being fetched again%s, %d of %d failed", tenantSuffix(tenant), failed, posts))
+}
+
+// reloadFailed alerts when the config can't be reloaded, once until a reload
+// succeeds.
+func (a *alerter) reloadFailed(reason string) {
+	a.raise("reload", "could not reload config: "+reason)
+}
+
+func (a *alerter) reloaded() {
+	a.resolve("reload", "config reloaded")
+}
+
+// raise sends message unless the incident it's about has already alerted.
+func (a *alerter) raise(incident string, message string) {
+	a.mu.Lock()
+	raised := a.incidents[incident]
+	a.incidents[incident] = true
+	a.mu.Unlock()
+
+	if !raised {
+		a.send(message)
+	}
+}
+
+// resolve sends message if the incident it's about had alerted.
+func (a *alerter) resolve(incident string, message string) {
+	a.mu.Lock()
+	raised := a.incidents[incident]
+	delete(a.incidents, incident)
+	a.mu.Unlock()
+
+	if raised {
+		a.send(message)
+	}
+}
+
+func (a *alerter) send(message string) {
+	fmt.Println("alert:", message)
+
+	config := a.currentConfig()
+	if config.Webhook == "" {
+		return
+	}
+
+	text := "abt-og-parser: " + message
+
+	// slack and discord incoming webhooks name the message field differently
+	var payload interface{} = map[string]string{"text": text}
+	if isDiscordWebhook(config.Webhook) {
+		payload = map[string]string{"content": text}
+	}
+
+	err := sendJson(a.httpClient, "POST", config.Webhook, nil, payload)
+	if err != nil {
+		fmt.Println("could not send alert", err.Error())
+	}
+}
+
+func isDiscordWebhook(webhook string) bool {
+	return strings.Contains(webhook, "discord.com/api/webhooks/") ||
+		strings.Contains(webhook, "discordapp.com/api/webhooks/")
+}
+
+func tenantSuffix(tenant string) string {
+	if tenant == "" || tenant == primaryTenantName {
+		return ""
+	}
+
+	return " for tenant " + tenant
+}
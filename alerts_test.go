@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// webhookRecorder collects the messages posted to a slack webhook.
+type webhookRecorder struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	messages []string
+}
+
+func newWebhookRecorder(t *testing.T) *webhookRecorder {
+	t.Helper()
+
+	recorder := &webhookRecorder{}
+	recorder.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+
+		recorder.mu.Lock()
+		recorder.messages = append(recorder.messages, payload["text"])
+		recorder.mu.Unlock()
+	}))
+	t.Cleanup(recorder.Close)
+
+	return recorder
+}
+
+func (r *webhookRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.messages)
+}
+
+func TestAlertsFireOncePerIncident(t *testing.T) {
+	webhook := newWebhookRecorder(t)
+	a := newAlerter(AlertsConfig{Webhook: webhook.URL, AfterFailures: 2, MaxFailureRate: 0.5})
+
+	for i := 0; i < 4; i++ {
+		a.cycleFailed(primaryTenantName, "db down")
+	}
+	if got := webhook.count(); got != 1 {
+		t.Fatalf("failing cycles sent %d alerts, want 1", got)
+	}
+
+	a.cycleSucceeded(primaryTenantName)
+	a.cycleSucceeded(primaryTenantName)
+	if got := webhook.count(); got != 2 {
+		t.Fatalf("recovering sent %d messages in all, want 2", got)
+	}
+
+	for i := 0; i < 3; i++ {
+		a.checkFailureRate(primaryTenantName, 10, 8)
+	}
+	a.checkFailureRate(primaryTenantName, 10, 1)
+	if got := webhook.count(); got != 4 {
+		t.Fatalf("the failure rate sent %d messages in all, want an alert and a recovery", got)
+	}
+
+	for i := 0; i < 3; i++ {
+		a.reloadFailed("bad json")
+	}
+	a.reloaded()
+	a.reloaded()
+	if got := webhook.count(); got != 6 {
+		t.Errorf("reloads sent %d messages in all, want an alert and a recovery", got)
+	}
+}
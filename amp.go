@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// fetchAmpFallback replaces a page that yielded no usable metadata with its
+// amp version, which is static html and nearly always has full metadata.
+// The original page is kept if the amp page is no better.
+func fetchAmpFallback(fetcher Fetcher, scrapedPost *PostScraped) {
+	base, err := url.Parse(scrapedPost.Post.Url)
+	if err != nil {
+		return
+	}
+
+	ampUrl, err := base.Parse(scrapedPost.OpenGraphTags.AmpUrl)
+	if err != nil {
+		return
+	}
+
+	fmt.Println("falling back to amp page for", scrapedPost.Post.Url)
+
+	ampPost := PostScraped{
+		Post: scrapedPost.Post,
+	}
+
+	ampPost.Html, ampPost.StatusCode, ampPost.FetchErr = fetcher.Fetch(scrapedPost.Post, ampUrl.String())
+	if ampPost.Html == "" {
+		return
+	}
+
+	getOgTagsFromHtml(&ampPost)
+
+	if !ampPost.OpenGraphTags.hasUsableMetadata() {
+		return
+	}
+
+	ampPost.OpenGraphTags.FromAmp = true
+	*scrapedPost = ampPost
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AmqpSinkConfig struct {
+	// Enabled turns the sink off without removing its settings. It is on
+	// whenever it is configured unless set to false.
+	Enabled          *bool  `json:"enabled"`
+	Url              string `json:"url"`
+	Exchange         string `json:"exchange"`
+	ExchangeType     string `json:"exchangeType"`
+	RoutingKeyPrefix string `json:"routingKeyPrefix"`
+}
+
+// amqpSink publishes scraped posts to an exchange with a routing key of
+// <prefix>.<domain>, e.g. post.scraped.example.com.
+type amqpSink struct {
+	config  AmqpSinkConfig
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+func newAmqpSink(config AmqpSinkConfig) (*amqpSink, error) {
+	if config.Exchange == "" {
+		return nil, errors.New("amqp exchange is required")
+	}
+
+	if config.ExchangeType == "" {
+		config.ExchangeType = "topic"
+	}
+
+	if config.RoutingKeyPrefix == "" {
+		config.RoutingKeyPrefix = "post.scraped"
+	}
+
+	sink := &amqpSink{config: config}
+
+	err := sink.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+func (s *amqpSink) Name() string {
+	return "amqp"
+}
+
+func (s *amqpSink) connect() error {
+	conn, err := amqp.Dial(s.config.Url)
+	if err != nil {
+		return err
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	err = channel.ExchangeDeclare(s.config.Exchange, s.config.ExchangeType, true, false, false, false, nil)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	s.conn = conn
+	s.channel = channel
+
+	return nil
+}
+
+func (s *amqpSink) Write(scraped PostScraped) error {
+	body, err := json.Marshal(newScrapedEvent(scraped))
+	if err != nil {
+		return err
+	}
+
+	msg := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    clock.Now(),
+		MessageId:    idempotencyKey(scraped),
+		Body:         body,
+	}
+
+	routingKey := s.config.RoutingKeyPrefix + "." + routingKeyDomain(scraped.Post.Url)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// reconnect once if the broker dropped us since the last write
+	if s.conn == nil || s.conn.IsClosed() {
+		err = s.connect()
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	return s.channel.PublishWithContext(ctx, s.config.Exchange, routingKey, false, false, msg)
+}
+
+func (s *amqpSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	return s.conn.Close()
+}
+
+// routingKeyDomain is the post's host with the dots amqp uses as word
+// separators kept, so consumers can bind to e.g. post.scraped.#.tumblr.com.
+func routingKeyDomain(postUrl string) string {
+	u, err := url.Parse(postUrl)
+	if err != nil || u.Hostname() == "" {
+		return "unknown"
+	}
+
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
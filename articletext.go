@@ -0,0 +1,37 @@
+package main
+
+import "strings"
+
+// maxParagraphs caps how much of a page's text is kept for enrichers.
+const maxParagraphs = 200
+
+// startParagraph begins collecting the text of a <p>, returning false once
+// enough text has been kept.
+func (t *OpenGraphTags) startParagraph() bool {
+	if len(t.paragraphs) >= maxParagraphs {
+		return false
+	}
+
+	t.paragraphs = append(t.paragraphs, "")
+
+	return true
+}
+
+// articleParagraphs returns the normalized text of the page's non-empty
+// paragraphs.
+func (t OpenGraphTags) articleParagraphs() []string {
+	paragraphs := make([]string, 0, len(t.paragraphs))
+
+	for _, paragraph := range t.paragraphs {
+		if text := normalizeText(paragraph); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+	}
+
+	return paragraphs
+}
+
+// articleText is the page's paragraph text, one paragraph per line.
+func (t OpenGraphTags) articleText() string {
+	return strings.Join(t.articleParagraphs(), "\n")
+}
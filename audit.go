@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// outcomes of processing a post, as recorded in its audit trail
+const (
+	auditFetchFailed      = "fetch failed"
+	auditPermanentFailure = "permanent failure"
+	auditSoftNotFound     = "soft 404"
+	auditNoMetadata       = "no metadata"
+	auditSaveFailed       = "save failed"
+	auditUnchanged        = "unchanged"
+	auditSaved            = "saved"
+)
+
+// AuditEntry records what happened to a post in one scrape, to answer
+// questions like why a post has no image.
+type AuditEntry struct {
+	PostID     int64     `json:"-"`
+	Created    time.Time `json:"-"`
+	Url        string    `json:"url"`
+	StatusCode int       `json:"-"`
+	Bytes      int       `json:"-"`
+	Outcome    string    `json:"-"`
+	// Fields are the metadata fields that were found
+	Fields []string `json:"fields,omitempty"`
+	// Sinks are where the post was written, including solr
+	Sinks []string `json:"sinks,omitempty"`
+	// Notes explain decisions such as a dropped image
+	Notes []string `json:"notes,omitempty"`
+}
+
+// detailsJson encodes the entry's lists for the details column.
+func (e AuditEntry) detailsJson() string {
+	encoded, err := json.Marshal(e)
+	if err != nil {
+		return "{}"
+	}
+
+	return string(encoded)
+}
+
+// note adds to the explanation of what happened to a page in its audit
+// trail.
+func (s *PostScraped) note(format string, args ...interface{}) {
+	s.notes = append(s.notes, fmt.Sprintf(format, args...))
+}
+
+// recordAudit adds an entry to the audit trail of scraped.Post when the
+// audit log is enabled.
+func recordAudit(ctx context.Context, store Store, config AppConfig, scraped PostScraped, outcome string, sinks []string) {
+	if !config.AuditLog {
+		return
+	}
+
+	entry := AuditEntry{
+		PostID:     scraped.Post.PostID,
+		Created:    clock.Now().UTC(),
+		Url:        scraped.Post.Url,
+		StatusCode: scraped.StatusCode,
+		Bytes:      len(scraped.Html),
+		Outcome:    outcome,
+		Fields:     scraped.OpenGraphTags.fieldsFound(),
+		Sinks:      sinks,
+		Notes:      scraped.notes,
+	}
+
+	if scraped.FetchErr != nil {
+		entry.Notes = append(append([]string(nil), entry.Notes...), scraped.FetchErr.Error())
+	}
+
+	err := store.RecordAudit(ctx, entry)
+	if err != nil {
+		fmt.Println("could not record audit entry", scraped.Post.Url, err.Error())
+		reportError("db", scraped.Post, err)
+	}
+}
+
+// fieldsFound lists the metadata fields that have a value.
+func (t OpenGraphTags) fieldsFound() []string {
+	fields := make([]string, 0)
+
+	found := []struct {
+		name string
+		set  bool
+	}{
+		{"title", t.Title != ""},
+		{"description", t.Description != ""},
+		{"featured_image", t.FeaturedImage != ""},
+		{"canonical_url", t.canonicalUrl() != ""},
+		{"language", t.Language != ""},
+		{"icon", t.Icon != ""},
+		{"keywords", len(t.Keywords) > 0},
+		{"tags", len(t.Tags) > 0},
+		{"article", !t.Article.empty()},
+		{"dublin_core", !t.DublinCore.empty()},
+		{"video", !t.Video.empty()},
+		{"audio", !t.Audio.empty()},
+		{"json_ld", len(t.JsonLd) > 0},
+		{"feeds", len(t.Feeds) > 0},
+		{"nsfw", t.Nsfw},
+	}
+
+	for _, field := range found {
+		if field.set {
+			fields = append(fields, field.name)
+		}
+	}
+
+	return fields
+}
+
+// runAudit prints the audit trail of a post: ogparser audit <post id>
+func runAudit(args []string) {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	limit := flags.Int("limit", 20, "how many of the latest entries to show")
+	tenantName := flags.String("tenant", primaryTenantName, "which tenant's db the post is in")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Println("usage: ogparser audit [-limit n] [-tenant name] <post id>")
+		os.Exit(2)
+	}
+
+	postID, err := strconv.ParseInt(flags.Arg(0), 10, 64)
+	if err != nil {
+		kill("parsing post id", err)
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		kill("loading config file", err)
+	}
+
+	tenantConfig, ok := findTenantConfig(config, *tenantName)
+	if !ok {
+		kill("finding tenant", fmt.Errorf("no tenant named %s", *tenantName))
+	}
+
+	config = config.forTenant(tenantConfig)
+
+	store, err := newSqlStore(config.Db)
+	if err != nil {
+		kill("opening db connection", err)
+	}
+
+	defer func() {
+		_ = store.Close()
+	}()
+
+	entries, err := store.AuditTrail(context.Background(), postID, *limit)
+	if err != nil {
+		kill("loading audit trail", err)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No audit entries for post", postID)
+		return
+	}
+
+	err = writeAuditTrail(os.Stdout, entries)
+	if err != nil {
+		kill("writing audit trail", err)
+	}
+}
+
+func writeAuditTrail(w io.Writer, entries []AuditEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "TIME\tSTATUS\tBYTES\tOUTCOME\tFIELDS\tSINKS\tNOTES")
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(
+			tw,
+			"%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			e.Created.Format(time.RFC3339),
+			e.StatusCode,
+			e.Bytes,
+			e.Outcome,
+			strings.Join(e.Fields, ","),
+			strings.Join(e.Sinks, ","),
+			strings.Join(e.Notes, "; "),
+		)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+// runBackfill scrapes every post, not just the last hour's, in batches of
+// ascending id. The last processed id is checkpointed after each batch under
+// the backfill's name, so running it again resumes where it stopped (and later
+// picks up only posts added since).
+func runBackfill(args []string) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	name := flags.String("name", "backfill", "name the checkpoint is saved under")
+	fromID := flags.Int64("from-id", 0, "only backfill posts with a greater id, ignoring the checkpoint")
+	restart := flags.Bool("restart", false, "ignore the checkpoint and start from the first post")
+	batchSize := flags.Int("batch", 200, "how many posts to fetch at once")
+	tenantName := flags.String("tenant", primaryTenantName, "which tenant's db to backfill")
+	_ = flags.Parse(args)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		kill("loading config file", err)
+	}
+
+	applyConfig(config)
+
+	tenantConfig, ok := findTenantConfig(config, *tenantName)
+	if !ok {
+		kill("finding tenant", fmt.Errorf("no tenant named %s", *tenantName))
+	}
+
+	config = config.forTenant(tenantConfig)
+	currentTenant = tenantConfig.Name
+
+	store, err := newSqlStore(config.Db)
+	if err != nil {
+		kill("opening db connection", err)
+	}
+
+	defer func() {
+		_ = store.Close()
+	}()
+
+	sinks := newSinks(config.Sinks)
+
+	defer func() {
+		closeSinks(sinks)
+	}()
+
+	ctx := context.Background()
+
+	fromIDSet := false
+	flags.Visit(func(f *flag.Flag) {
+		fromIDSet = fromIDSet || f.Name == "from-id"
+	})
+
+	if !fromIDSet && !*restart {
+		checkpoint, ok, err := store.LoadCheckpoint(ctx, *name)
+		if err != nil {
+			kill("loading backfill checkpoint", err)
+		}
+
+		if ok {
+			fmt.Println("Resuming backfill", *name, "from checkpoint at post id", checkpoint)
+			*fromID = checkpoint
+		}
+	}
+
+	total, err := store.CountPostsAfterID(ctx, *fromID)
+	if err != nil {
+		kill("counting posts to backfill", err)
+	}
+
+	fmt.Println("Backfilling", total, "posts after id", *fromID)
+
+	progress := newProgressLogger("backfill", total)
+	lastID := *fromID
+	saved := 0
+
+	for {
+		posts, err := store.PostsAfterID(ctx, lastID, *batchSize)
+		if err != nil {
+			kill(fmt.Sprintf("loading posts after id %d", lastID), err)
+		}
+
+		if len(posts) == 0 {
+			break
+		}
+
+		summary := scrapePosts(ctx, store, config, sinks, posts, progress)
+		saved += summary.saved
+		lastID = posts[len(posts)-1].PostID
+
+		err = store.SaveCheckpoint(ctx, *name, lastID)
+		if err != nil {
+			kill(fmt.Sprintf("saving backfill checkpoint at post id %d", lastID), err)
+		}
+	}
+
+	fmt.Println("Backfill finished, saved metadata for", saved, "of", total, "posts")
+}
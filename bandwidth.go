@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// bandwidthLimiter is a token bucket of bytes, holding up to a second's
+// worth, shared by every response body the fetcher reads.
+type bandwidthLimiter struct {
+	bytesPerSecond int64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	return &bandwidthLimiter{
+		bytesPerSecond: bytesPerSecond,
+		tokens:         float64(bytesPerSecond),
+		last:           clock.Now(),
+	}
+}
+
+var (
+	sharedBandwidthLimiterMu sync.Mutex
+	sharedBandwidthLimiter   *bandwidthLimiter
+)
+
+// bandwidthLimiterFor returns the process-wide limiter, so the cap holds for
+// every fetcher at once, such as a cycle's and the grpc server's. Changing
+// the rate starts a new limiter.
+func bandwidthLimiterFor(bytesPerSecond int64) *bandwidthLimiter {
+	sharedBandwidthLimiterMu.Lock()
+	defer sharedBandwidthLimiterMu.Unlock()
+
+	if sharedBandwidthLimiter == nil || sharedBandwidthLimiter.bytesPerSecond != bytesPerSecond {
+		sharedBandwidthLimiter = newBandwidthLimiter(bytesPerSecond)
+	}
+
+	return sharedBandwidthLimiter
+}
+
+// take accounts for n bytes read, sleeping until the bucket has refilled
+// enough to cover them.
+func (l *bandwidthLimiter) take(n int) {
+	rate := float64(l.bytesPerSecond)
+
+	l.mu.Lock()
+	now := clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * rate
+	if l.tokens > rate {
+		l.tokens = rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+
+	if deficit > 0 {
+		<-clock.After(time.Duration(deficit / rate * float64(time.Second)))
+	}
+}
+
+// throttledTransport slows down reading response bodies to the limiter's
+// rate.
+type throttledTransport struct {
+	base    http.RoundTripper
+	limiter *bandwidthLimiter
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	resp.Body = &throttledBody{ReadCloser: resp.Body, limiter: t.limiter}
+
+	return resp, nil
+}
+
+type throttledBody struct {
+	io.ReadCloser
+	limiter *bandwidthLimiter
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	// large reads would otherwise take the whole second's budget at once
+	if chunk := int(b.limiter.bytesPerSecond / 10); chunk > 0 && len(p) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.limiter.take(n)
+	}
+
+	return n, err
+}
+
+// WithBandwidthLimit caps how fast all response bodies are read together,
+// in bytes per second.
+func WithBandwidthLimit(limiter *bandwidthLimiter) Option {
+	return func(f *httpFetcher) {
+		f.bandwidth = limiter
+	}
+}
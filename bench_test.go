@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// The parser's hot path on generated pages, so changes made for performance
+// can be compared before and after: go test -run ^$ -bench . -count 10
+
+var (
+	benchSmallHead    = benchPage(10, 20, 0)
+	benchHugeBody     = benchPage(10, 20000, 0)
+	benchDeeplyNested = benchPage(10, 50, 2000)
+)
+
+func BenchmarkTokenizeSmallHead(b *testing.B)    { benchTokenize(b, benchSmallHead) }
+func BenchmarkTokenizeHugeBody(b *testing.B)     { benchTokenize(b, benchHugeBody) }
+func BenchmarkTokenizeDeeplyNested(b *testing.B) { benchTokenize(b, benchDeeplyNested) }
+func BenchmarkParseSmallHead(b *testing.B)       { benchParse(b, benchSmallHead) }
+func BenchmarkParseHugeBody(b *testing.B)        { benchParse(b, benchHugeBody) }
+func BenchmarkParseDeeplyNested(b *testing.B)    { benchParse(b, benchDeeplyNested) }
+
+// benchTokenize only walks the tokens, the floor under any parse.
+func benchTokenize(b *testing.B, page string) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(page)))
+
+	for i := 0; i < b.N; i++ {
+		tokenizer := html.NewTokenizer(strings.NewReader(page))
+		for tokenizer.Next() != html.ErrorToken {
+			tokenizer.Token()
+		}
+
+		if tokenizer.Err() != io.EOF {
+			b.Fatal(tokenizer.Err())
+		}
+	}
+}
+
+// benchParse extracts the metadata as a cycle does, without fetching.
+func benchParse(b *testing.B, page string) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(page)))
+
+	for i := 0; i < b.N; i++ {
+		Parse("https://example.com/2020/01/a-post", page)
+	}
+}
+
+// benchPage builds a typical blog post: meta tags in the head, paragraphs
+// in the body, optionally wrapped in nested divs as page builders do.
+func benchPage(metaTags int, paragraphs int, depth int) string {
+	var b strings.Builder
+
+	b.WriteString("<!DOCTYPE html>\n<html lang=\"en\"><head><meta charset=\"utf-8\">\n")
+	b.WriteString("<title>A post about benchmarks | Example Blog</title>\n")
+	b.WriteString("<meta property=\"og:title\" content=\"A post about benchmarks\">\n")
+	b.WriteString("<meta property=\"og:description\" content=\"Measuring the parser rather than guessing.\">\n")
+	b.WriteString("<meta property=\"og:image\" content=\"https://example.com/images/bench.png\">\n")
+	b.WriteString("<link rel=\"canonical\" href=\"https://example.com/2020/01/a-post\">\n")
+
+	for i := 0; i < metaTags; i++ {
+		fmt.Fprintf(&b, "<meta name=\"custom-%d\" content=\"value %d\">\n", i, i)
+	}
+
+	b.WriteString("<script type=\"application/ld+json\">{\"@context\": \"https://schema.org\", \"@type\": \"BlogPosting\", " +
+		"\"headline\": \"A post about benchmarks\", \"author\": {\"@type\": \"Person\", \"name\": \"Someone\"}}</script>\n")
+	b.WriteString("</head><body>\n")
+
+	b.WriteString(strings.Repeat("<div class=\"wrapper\">", depth))
+	b.WriteString("<article>")
+
+	for i := 0; i < paragraphs; i++ {
+		fmt.Fprintf(&b, "<p>Paragraph %d of the post, with <a href=\"/link-%d\">a link</a> and <em>some emphasis</em> "+
+			"to give the tokenizer a realistic mix of text and inline elements.</p>\n", i, i)
+		if i%10 == 0 {
+			fmt.Fprintf(&b, "<img src=\"/images/%d.jpg\" width=\"640\" height=\"480\" alt=\"image %d\">\n", i, i)
+		}
+	}
+
+	b.WriteString("</article>")
+	b.WriteString(strings.Repeat("</div>", depth))
+	b.WriteString("</body></html>\n")
+
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBreakerFailures is how many fetches from a host fail in a row
+	// before its pages are skipped
+	defaultBreakerFailures = 5
+	// defaultBreakerCooldown is how long they're skipped before one is let
+	// through to see if the host is back
+	defaultBreakerCooldown = time.Minute
+)
+
+// errCircuitOpen fails the fetches skipped because their host keeps failing.
+var errCircuitOpen = errors.New("circuit open")
+
+type circuitState int
+
+const (
+	// circuitClosed lets every fetch through, counting failures
+	circuitClosed circuitState = iota
+	// circuitOpen skips every fetch until the cooldown is over
+	circuitOpen
+	// circuitHalfOpen lets a single trial fetch through, which closes the
+	// circuit again if it succeeds and opens it if it fails
+	circuitHalfOpen
+)
+
+// circuitBreaker stops fetching from hosts that are down, so a dead site
+// doesn't tie up workers with timeouts for every one of its posts.
+type circuitBreaker struct {
+	failures int
+	cooldown time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostCircuit
+}
+
+type hostCircuit struct {
+	state    circuitState
+	failures int
+	openedAt time.Time
+	// trying is set while the half-open circuit's trial fetch is in flight
+	trying bool
+}
+
+func newCircuitBreaker(failures int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		failures: failures,
+		cooldown: cooldown,
+		hosts:    make(map[string]*hostCircuit),
+	}
+}
+
+var (
+	sharedCircuitBreakerMu sync.Mutex
+	sharedCircuitBreaker   *circuitBreaker
+)
+
+// circuitBreakerFor returns the process-wide breaker, so a host that is down
+// stays skipped from one cycle's fetcher to the next. Changing the settings
+// starts a new breaker.
+func circuitBreakerFor(failures int, cooldown time.Duration) *circuitBreaker {
+	sharedCircuitBreakerMu.Lock()
+	defer sharedCircuitBreakerMu.Unlock()
+
+	if sharedCircuitBreaker == nil || sharedCircuitBreaker.failures != failures || sharedCircuitBreaker.cooldown != cooldown {
+		sharedCircuitBreaker = newCircuitBreaker(failures, cooldown)
+	}
+
+	return sharedCircuitBreaker
+}
+
+// allow reports whether a fetch from host may go ahead. A fetch that was
+// allowed must be followed by record.
+func (b *circuitBreaker) allow(host string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	circuit, ok := b.hosts[host]
+	if !ok {
+		return nil
+	}
+
+	switch circuit.state {
+	case circuitOpen:
+		reopens := circuit.openedAt.Add(b.cooldown)
+		if clock.Now().Before(reopens) {
+			return fmt.Errorf("%w for %s until %s", errCircuitOpen, host, reopens.Format(time.RFC3339))
+		}
+
+		circuit.state = circuitHalfOpen
+		circuit.trying = true
+	case circuitHalfOpen:
+		if circuit.trying {
+			return fmt.Errorf("%w for %s while a trial fetch is made", errCircuitOpen, host)
+		}
+
+		circuit.trying = true
+	}
+
+	return nil
+}
+
+// record counts the outcome of an allowed fetch from host.
+func (b *circuitBreaker) record(host string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	circuit, ok := b.hosts[host]
+	if !failed {
+		// hosts are only remembered while they're failing
+		delete(b.hosts, host)
+		return
+	}
+
+	if !ok {
+		circuit = &hostCircuit{}
+		b.hosts[host] = circuit
+	}
+
+	circuit.failures++
+	circuit.trying = false
+
+	if circuit.state == circuitHalfOpen || circuit.failures >= b.failures {
+		if circuit.state != circuitOpen {
+			fmt.Println("skipping", host, "for", b.cooldown, "after", circuit.failures, "failed fetches in a row")
+		}
+
+		circuit.state = circuitOpen
+		circuit.openedAt = clock.Now()
+	}
+}
+
+// WithCircuitBreaker skips the pages of hosts whose fetches keep failing.
+func WithCircuitBreaker(breaker *circuitBreaker) Option {
+	return func(f *httpFetcher) {
+		f.breaker = breaker
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	manual := useManualClock(t)
+
+	var down int32 = 1
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(WithCircuitBreaker(newCircuitBreaker(2, 10*time.Second)))
+	defer func() {
+		_ = fetcher.Close()
+	}()
+
+	fetch := func() FetchedPage {
+		return fetcher.FetchPage(Post{}, server.URL+"/post")
+	}
+
+	// closed: failures go through until there are enough in a row
+	for i := 0; i < 2; i++ {
+		if page := fetch(); page.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("fetch %d = %d, %v, want a 503", i, page.StatusCode, page.Err)
+		}
+	}
+
+	// open: fetches are skipped without a request
+	if page := fetch(); !errors.Is(page.Err, errCircuitOpen) {
+		t.Fatalf("fetch with the circuit open = %v, want it skipped", page.Err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Fatalf("made %d requests, want 2", got)
+	}
+
+	// half-open: a failed trial opens the circuit again
+	manual.Advance(11 * time.Second)
+	if page := fetch(); page.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("trial fetch = %d, %v, want it let through", page.StatusCode, page.Err)
+	}
+	if page := fetch(); !errors.Is(page.Err, errCircuitOpen) {
+		t.Fatalf("fetch after a failed trial = %v, want it skipped", page.Err)
+	}
+
+	// half-open: a successful trial closes the circuit
+	atomic.StoreInt32(&down, 0)
+	manual.Advance(11 * time.Second)
+	for i := 0; i < 3; i++ {
+		if page := fetch(); page.StatusCode != http.StatusOK {
+			t.Fatalf("fetch %d after the host is back = %d, %v", i, page.StatusCode, page.Err)
+		}
+	}
+}
+
+func TestCircuitBreakerLetsOneTrialThrough(t *testing.T) {
+	manual := useManualClock(t)
+
+	breaker := newCircuitBreaker(1, time.Second)
+	if err := breaker.allow("example.com"); err != nil {
+		t.Fatal(err)
+	}
+	breaker.record("example.com", true)
+
+	manual.Advance(2 * time.Second)
+	if err := breaker.allow("example.com"); err != nil {
+		t.Fatalf("trial fetch was not allowed: %v", err)
+	}
+	if err := breaker.allow("example.com"); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("second fetch during the trial = %v, want it skipped", err)
+	}
+	if err := breaker.allow("other.example"); err != nil {
+		t.Errorf("another host was skipped: %v", err)
+	}
+}
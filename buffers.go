@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+const (
+	// initialBodyBufferSize fits most pages' html without growing.
+	initialBodyBufferSize = 256 << 10
+	// maxPooledBufferSize keeps the odd huge page from pinning its buffer in
+	// the pool for the life of the process.
+	maxPooledBufferSize = 4 << 20
+)
+
+// bodyBuffers are reused across fetches so reading a response body doesn't
+// grow a fresh slice every time.
+var bodyBuffers = sync.Pool{
+	New: func() interface{} {
+		return bytes.NewBuffer(make([]byte, 0, initialBodyBufferSize))
+	},
+}
+
+func getBodyBuffer() *bytes.Buffer {
+	return bodyBuffers.Get().(*bytes.Buffer)
+}
+
+func putBodyBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+
+	buf.Reset()
+	bodyBuffers.Put(buf)
+}
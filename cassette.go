@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	cassetteRecord = "record"
+	cassetteReplay = "replay"
+
+	// cassettePage and cassetteProbe tell fetched pages from probed images
+	cassettePage  = "GET"
+	cassetteProbe = "PROBE"
+)
+
+// CassetteConfig records the responses of every fetch to a file, or answers
+// fetches from one without touching the network, so integration tests and
+// local development can run against recorded pages.
+type CassetteConfig struct {
+	Path string `json:"path"`
+	// Mode is "record" or "replay"
+	Mode string `json:"mode"`
+}
+
+// cassetteInteraction is one recorded fetch or image probe. Bodies that
+// aren't valid utf-8 are kept base64 encoded.
+type cassetteInteraction struct {
+	Method        string      `json:"method"`
+	Url           string      `json:"url"`
+	StatusCode    int         `json:"status"`
+	Header        http.Header `json:"header"`
+	FinalUrl      string      `json:"finalUrl,omitempty"`
+	ContentLength int64       `json:"contentLength,omitempty"`
+	Body          string      `json:"body"`
+	Base64        bool        `json:"base64,omitempty"`
+	Error         string      `json:"error,omitempty"`
+	Image         *imageInfo  `json:"image,omitempty"`
+}
+
+// cassette holds the interactions of a cassette file. Every fetcher using the
+// file shares it, so recordings are added to one list and written out by a
+// single writer.
+type cassette struct {
+	path string
+
+	mu           sync.Mutex
+	interactions []cassetteInteraction
+	unsaved      bool
+}
+
+var (
+	cassettesMu sync.Mutex
+	cassettes   = make(map[string]*cassette)
+)
+
+// cassetteFor loads a cassette file once, sharing it between fetchers.
+func cassetteFor(config CassetteConfig) (*cassette, error) {
+	cassettesMu.Lock()
+	defer cassettesMu.Unlock()
+
+	c, ok := cassettes[config.Path]
+	if ok {
+		return c, nil
+	}
+
+	c = &cassette{path: config.Path}
+
+	data, err := ioutil.ReadFile(config.Path)
+	switch {
+	case os.IsNotExist(err) && config.Mode == cassetteRecord:
+		// recording again adds to what is already there
+	case err != nil:
+		return nil, err
+	default:
+		err = json.Unmarshal(data, &c.interactions)
+		if err != nil {
+			return nil, fmt.Errorf("reading cassette %s: %w", config.Path, err)
+		}
+	}
+
+	cassettes[config.Path] = c
+
+	return c, nil
+}
+
+func (c *cassette) add(interaction cassetteInteraction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, interaction)
+	c.unsaved = true
+}
+
+// matches returns the interactions recorded for a method and url, in the
+// order they were recorded.
+func (c *cassette) matches(method string, url string) []cassetteInteraction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	matches := make([]cassetteInteraction, 0)
+	for _, interaction := range c.interactions {
+		if interaction.Method == method && interaction.Url == url {
+			matches = append(matches, interaction)
+		}
+	}
+
+	return matches
+}
+
+// save writes the cassette if anything was recorded since it last was,
+// going through a temporary file so a crash can't leave half of it.
+func (c *cassette) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.unsaved {
+		return nil
+	}
+
+	// html is kept readable for editing cassettes by hand
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(c.interactions)
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	err = ioutil.WriteFile(tmp, buf.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, c.path)
+	if err != nil {
+		return err
+	}
+
+	c.unsaved = false
+
+	return nil
+}
+
+// cassetteFetcher records what base fetches, or replays what was recorded.
+// Requests for the same url are answered in the order they were recorded,
+// the last answer repeating once they run out.
+type cassetteFetcher struct {
+	base     Fetcher
+	cassette *cassette
+	record   bool
+
+	mu     sync.Mutex
+	played map[string]int
+}
+
+func newCassetteFetcher(config CassetteConfig, base Fetcher) Fetcher {
+	c, err := cassetteFor(config)
+	if err != nil && config.Mode == cassetteReplay {
+		// replaying must never fall back to the network
+		fmt.Println("could not load cassette", config.Path, err.Error())
+		return failingFetcher{err: err}
+	}
+
+	if err != nil {
+		fmt.Println("not using cassette", config.Path, err.Error())
+		return base
+	}
+
+	fmt.Println("Fetching in", config.Mode, "mode with cassette", config.Path)
+
+	return &cassetteFetcher{
+		base:     base,
+		cassette: c,
+		record:   config.Mode == cassetteRecord,
+		played:   make(map[string]int),
+	}
+}
+
+func (f *cassetteFetcher) Fetch(post Post, pageUrl string) (string, int, error) {
+	page := f.FetchPage(post, pageUrl)
+
+	return page.Html, page.StatusCode, page.Err
+}
+
+func (f *cassetteFetcher) FetchPage(post Post, pageUrl string) FetchedPage {
+	if f.record {
+		page := f.base.FetchPage(post, pageUrl)
+		f.cassette.add(pageInteraction(pageUrl, page))
+		return page
+	}
+
+	interaction, err := f.replay(cassettePage, pageUrl)
+	if err != nil {
+		return FetchedPage{Err: err}
+	}
+
+	return interaction.page()
+}
+
+func (f *cassetteFetcher) ProbeImage(imageUrl string) (imageInfo, error) {
+	if f.record {
+		info, err := f.base.ProbeImage(imageUrl)
+
+		interaction := cassetteInteraction{Method: cassetteProbe, Url: imageUrl}
+		if err != nil {
+			interaction.Error = err.Error()
+		} else {
+			interaction.Image = &info
+		}
+		f.cassette.add(interaction)
+
+		return info, err
+	}
+
+	interaction, err := f.replay(cassetteProbe, imageUrl)
+	if err != nil {
+		return imageInfo{}, err
+	}
+
+	if interaction.Error != "" || interaction.Image == nil {
+		return imageInfo{}, errors.New(interaction.Error)
+	}
+
+	return *interaction.Image, nil
+}
+
+// Close writes what was recorded to the cassette file.
+func (f *cassetteFetcher) Close() error {
+	err := f.base.Close()
+	if !f.record {
+		return err
+	}
+
+	saveErr := f.cassette.save()
+	if saveErr != nil {
+		return fmt.Errorf("saving cassette %s: %w", f.cassette.path, saveErr)
+	}
+
+	return err
+}
+
+// replay returns the next interaction recorded for a method and url.
+func (f *cassetteFetcher) replay(method string, url string) (cassetteInteraction, error) {
+	matches := f.cassette.matches(method, url)
+	if len(matches) == 0 {
+		return cassetteInteraction{}, fmt.Errorf("no response recorded in %s for %s %s", f.cassette.path, method, url)
+	}
+
+	key := method + " " + url
+
+	f.mu.Lock()
+	played := f.played[key]
+	f.played[key]++
+	f.mu.Unlock()
+
+	if played >= len(matches) {
+		played = len(matches) - 1
+	}
+
+	return matches[played], nil
+}
+
+func pageInteraction(pageUrl string, page FetchedPage) cassetteInteraction {
+	interaction := cassetteInteraction{
+		Method:        cassettePage,
+		Url:           pageUrl,
+		StatusCode:    page.StatusCode,
+		Header:        page.Header,
+		FinalUrl:      page.FinalUrl,
+		ContentLength: page.ContentLength,
+	}
+
+	if page.Err != nil {
+		interaction.Error = page.Err.Error()
+	}
+
+	if utf8.ValidString(page.Html) {
+		interaction.Body = page.Html
+	} else {
+		interaction.Body = base64.StdEncoding.EncodeToString([]byte(page.Html))
+		interaction.Base64 = true
+	}
+
+	return interaction
+}
+
+func (i cassetteInteraction) page() FetchedPage {
+	page := FetchedPage{
+		StatusCode:    i.StatusCode,
+		Header:        i.Header.Clone(),
+		FinalUrl:      i.FinalUrl,
+		ContentLength: i.ContentLength,
+	}
+
+	if page.Header == nil {
+		page.Header = http.Header{}
+	}
+
+	if page.FinalUrl == "" {
+		page.FinalUrl = i.Url
+	}
+
+	if i.Error != "" {
+		page.Err = errors.New(i.Error)
+		return page
+	}
+
+	// only pages that were fetched successfully have a body
+	if i.StatusCode != http.StatusOK {
+		return page
+	}
+
+	body := i.Body
+	if i.Base64 {
+		decoded, err := base64.StdEncoding.DecodeString(i.Body)
+		if err != nil {
+			page.Err = fmt.Errorf("decoding recorded body of %s: %w", i.Url, err)
+			return page
+		}
+		body = string(decoded)
+	}
+
+	page.Html = body
+	if page.ContentLength == 0 {
+		page.ContentLength = int64(len(body))
+	}
+
+	return page
+}
+
+// failingFetcher fails every fetch with the same error.
+type failingFetcher struct {
+	err error
+}
+
+func (f failingFetcher) Fetch(Post, string) (string, int, error) {
+	return "", 0, f.err
+}
+
+func (f failingFetcher) FetchPage(Post, string) FetchedPage {
+	return FetchedPage{Err: f.err}
+}
+
+func (f failingFetcher) ProbeImage(string) (imageInfo, error) {
+	return imageInfo{}, f.err
+}
+
+func (f failingFetcher) Close() error {
+	return nil
+}
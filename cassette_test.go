@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCassetteReplaysRecordedCycle(t *testing.T) {
+	site := newFixtureSite(t)
+	posts := []Post{
+		{PostID: 1, Url: site.URL + "/article.html"},
+		{PostID: 2, Url: site.URL + "/missing.html"},
+	}
+	path := filepath.Join(t.TempDir(), "pages.json")
+
+	config := testConfig()
+	config.Fetch.Cassette = CassetteConfig{Path: path, Mode: cassetteRecord}
+	runCycle(t, newMemoryStore(posts), config)
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("cassette was not written: %v", err)
+	}
+
+	site.Close()
+
+	// replay from the file rather than what was recorded in memory
+	cassettesMu.Lock()
+	delete(cassettes, path)
+	cassettesMu.Unlock()
+
+	config.Fetch.Cassette.Mode = cassetteReplay
+	store := newMemoryStore(posts)
+	runCycle(t, store, config)
+
+	saved, ok := store.Saved(1)
+	if !ok {
+		t.Fatal("replayed article was not saved")
+	}
+	if saved.OpenGraphTags.Description != "What we learned building an opengraph parser." {
+		t.Errorf("description = %q", saved.OpenGraphTags.Description)
+	}
+
+	if _, ok := store.Saved(2); ok {
+		t.Error("replayed missing page was saved")
+	}
+	if response := store.responses[2]; response.StatusCode != 404 {
+		t.Errorf("missing page replayed with status %d", response.StatusCode)
+	}
+}
+
+func TestCassetteFailsUnrecordedUrls(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pages.json")
+	err := ioutil.WriteFile(path, []byte("[]"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := newCassetteFetcher(CassetteConfig{Path: path, Mode: cassetteReplay}, failingFetcher{})
+
+	page := fetcher.FetchPage(Post{}, "https://example.com/never-recorded")
+	if page.Err == nil {
+		t.Error("fetching an unrecorded url didn't fail")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	fourByteReplace = "replace"
+	fourByteStrip   = "strip"
+)
+
+// cp1252 maps the bytes windows-1252 puts where latin-1 has control
+// characters, e.g. the curly quotes word processors produce.
+var cp1252 = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž',
+	0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+}
+
+// repairUtf8 makes text valid utf-8. Pages that aren't are mostly utf-8 with
+// a few windows-1252 (or latin-1) bytes pasted in, so invalid bytes are
+// decoded as windows-1252 rather than dropped.
+func repairUtf8(text string) string {
+	if utf8.ValidString(text) {
+		return text
+	}
+
+	var b strings.Builder
+	b.Grow(len(text) + 16)
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r == utf8.RuneError && size == 1 {
+			if mapped, ok := cp1252[text[i]]; ok {
+				b.WriteRune(mapped)
+			} else if text[i] >= 0xa0 {
+				b.WriteRune(rune(text[i]))
+			}
+			i++
+			continue
+		}
+
+		b.WriteString(text[i : i+size])
+		i += size
+	}
+
+	return b.String()
+}
+
+// limitFourByteChars strips or replaces the characters outside the basic
+// multilingual plane, such as emoji, which take four bytes in utf-8.
+func limitFourByteChars(text string, mode string) string {
+	if mode == "" {
+		return text
+	}
+
+	fits := true
+	for i := 0; i < len(text); i++ {
+		if text[i] >= 0xf0 {
+			fits = false
+			break
+		}
+	}
+
+	if fits {
+		return text
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r <= 0xffff {
+			return r
+		}
+		if mode == fourByteStrip {
+			return -1
+		}
+		return utf8.RuneError
+	}, text)
+}
+
+// fourByteMode is how the characters the columns can't hold are handled, or
+// "" when they can hold everything.
+func (c DbConfig) fourByteMode() string {
+	switch strings.ToLower(c.Charset) {
+	case "utf8", "utf8mb3":
+	default:
+		return ""
+	}
+
+	if c.FourByteChars == fourByteStrip {
+		return fourByteStrip
+	}
+
+	return fourByteReplace
+}
+
+// safeText is text as it can be written to the db, valid utf-8 that the
+// columns' charset can hold.
+func (s *sqlStore) safeText(text string) string {
+	return limitFourByteChars(repairUtf8(text), s.fourByte)
+}
+
+// safeArgs applies safeText to the text arguments of a query.
+func (s *sqlStore) safeArgs(args []interface{}) []interface{} {
+	for i, arg := range args {
+		switch value := arg.(type) {
+		case string:
+			args[i] = s.safeText(value)
+		case sql.NullString:
+			value.String = s.safeText(value.String)
+			args[i] = value
+		}
+	}
+
+	return args
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const checkConfigTimeout = 10 * time.Second
+
+// configReport collects the outcome of each check-config step.
+type configReport struct {
+	failed int
+}
+
+func (r *configReport) result(what string, err error) {
+	if err != nil {
+		r.failed++
+		fmt.Println("FAIL", what+":", err.Error())
+		return
+	}
+
+	fmt.Println("ok  ", what)
+}
+
+// runCheckConfig validates the config file and connects to everything it
+// points at, so deployment mistakes show up before the first cycle:
+// ogparser check-config
+func runCheckConfig() {
+	report := &configReport{}
+
+	config, err := loadConfig(configPath)
+	report.result("loading "+configPath, err)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	problems := validateConfig(config)
+	for _, problem := range problems {
+		report.result("validating config", problem)
+	}
+
+	if len(problems) == 0 {
+		report.result("validating config", nil)
+	}
+
+	for _, tc := range config.tenantConfigs() {
+		tenantConfig := config.forTenant(tc)
+		suffix := " for tenant " + tc.Name
+
+		report.result("connecting to the db"+suffix, checkDb(tc.Db))
+
+		if tenantConfig.solrEnabled() {
+			report.result("reaching solr"+suffix, checkSolr(tenantConfig))
+		}
+
+		if tc.Sinks.Jsonl.Path != "" && (tc.Sinks.Jsonl.Enabled == nil || *tc.Sinks.Jsonl.Enabled) {
+			report.result("finding the jsonl sink's directory"+suffix, checkDir(filepath.Dir(tc.Sinks.Jsonl.Path)))
+		}
+
+		for _, sink := range sinkAddresses(tc.Sinks) {
+			report.result("reaching the "+sink.name+" sink"+suffix, checkReachable(sink.address))
+		}
+	}
+
+	if report.failed > 0 {
+		fmt.Println(report.failed, "checks failed")
+		os.Exit(1)
+	}
+
+	fmt.Println("Config is valid")
+}
+
+func checkDb(config DbConfig) error {
+	store, err := newSqlStore(config)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = store.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkConfigTimeout)
+	defer cancel()
+
+	return store.Ping(ctx)
+}
+
+// checkSolr pings the core or collection and, if the schema is checked at
+// startup, checks it without creating anything.
+func checkSolr(config AppConfig) error {
+	coreUrl, err := config.solrCoreUrl()
+	if err != nil {
+		return err
+	}
+
+	status, err := getSolrJson(&http.Client{Timeout: checkConfigTimeout}, coreUrl+"/admin/ping", nil)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return fmt.Errorf("ping returned status %d", status)
+	}
+
+	if config.SolrSchema.Check {
+		schemaConfig := config.SolrSchema
+		schemaConfig.Create = false
+
+		return checkSolrSchema(coreUrl, config.solrTimeout(), schemaConfig)
+	}
+
+	return nil
+}
+
+func checkDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	return nil
+}
+
+type sinkAddress struct {
+	name    string
+	address string
+}
+
+// sinkAddresses are the urls of the enabled network sinks.
+func sinkAddresses(config SinksConfig) []sinkAddress {
+	addresses := make([]sinkAddress, 0)
+
+	for _, sink := range []struct {
+		name, address string
+		enabled       *bool
+	}{
+		{"amqp", config.Amqp.Url, config.Amqp.Enabled},
+		{"mqtt", config.Mqtt.Broker, config.Mqtt.Enabled},
+		{"meilisearch", config.Meilisearch.Host, config.Meilisearch.Enabled},
+		{"opensearch", config.OpenSearch.Endpoint, config.OpenSearch.Enabled},
+		{"typesense", config.Typesense.Host, config.Typesense.Enabled},
+	} {
+		if sink.address != "" && (sink.enabled == nil || *sink.enabled) {
+			addresses = append(addresses, sinkAddress{name: sink.name, address: sink.address})
+		}
+	}
+
+	return addresses
+}
+
+// checkReachable opens a tcp connection to a url's host, without speaking
+// the sink's protocol or sending credentials.
+func checkReachable(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{
+			"http": "80", "https": "443", "ws": "80", "wss": "443",
+			"amqp": "5672", "amqps": "5671",
+			"tcp": "1883", "mqtt": "1883", "ssl": "8883", "tls": "8883", "mqtts": "8883",
+		}[u.Scheme]
+	}
+
+	if u.Hostname() == "" || port == "" {
+		return fmt.Errorf("can't tell which host and port %q is", rawUrl)
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), checkConfigTimeout)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
@@ -0,0 +1,52 @@
+package main
+
+import "time"
+
+// Clock is where scheduling, waits and stored timestamps get the time from,
+// so they can be frozen or stepped deterministically. Deadlines and
+// timestamps handed to the outside world, such as socket deadlines or
+// request signatures, use the time package instead.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	// After sends the time once d has passed, like time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+var clock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Reset(d time.Duration) {
+	t.ticker.Reset(d)
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
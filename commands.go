@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// runCommand runs a one-off subcommand instead of the scraping service.
+func runCommand(name string, args []string) {
+	switch name {
+	case "migrate":
+		runMigrate()
+	case "check-config":
+		runCheckConfig()
+	case "prioritize":
+		runPrioritize(args)
+	case "backfill":
+		runBackfill(args)
+	case "stats":
+		runStats(args)
+	case "audit":
+		runAudit(args)
+	case "scrape-file":
+		runScrapeFile(args)
+	case "export":
+		runExport(args)
+	case "reparse":
+		runReparse(args)
+	case "reindex-solr":
+		runReindexSolr(args)
+	case "conformance":
+		runConformance(args)
+	default:
+		fmt.Println("unknown command", name)
+		os.Exit(2)
+	}
+}
+
+func runMigrate() {
+	config, err := loadConfig(configPath)
+	if err != nil {
+		kill("loading config file", err)
+	}
+
+	store, err := newSqlStore(config.Db)
+	if err != nil {
+		kill("opening db connection", err)
+	}
+
+	defer func() {
+		_ = store.Close()
+	}()
+
+	err = store.Migrate(context.Background())
+	if err != nil {
+		kill("migrating db", err)
+	}
+
+	fmt.Println("Database is up to date")
+}
+
+// runPrioritize sets the priority of posts, e.g. ones readers are viewing
+// right now: ogparser prioritize <priority> <post id>...
+func runPrioritize(args []string) {
+	if len(args) < 2 {
+		fmt.Println("usage: ogparser prioritize <priority> <post id>...")
+		os.Exit(2)
+	}
+
+	priority, err := strconv.Atoi(args[0])
+	if err != nil {
+		kill("parsing priority", err)
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		kill("loading config file", err)
+	}
+
+	store, err := newSqlStore(config.Db)
+	if err != nil {
+		kill("opening db connection", err)
+	}
+
+	defer func() {
+		_ = store.Close()
+	}()
+
+	for _, arg := range args[1:] {
+		postID, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			kill("parsing post id", err)
+		}
+
+		err = store.SetPriority(context.Background(), postID, priority)
+		if err != nil {
+			kill("setting post priority", err)
+		}
+	}
+
+	fmt.Println("Updated priority of", len(args)-1, "posts")
+}
+
+// runStats reports the domains that are scraped least successfully, to show
+// where a site-specific extractor would help most.
+func runStats(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	days := flags.Int("days", 7, "how many days of scrape attempts to look at")
+	limit := flags.Int("limit", 25, "how many domains to list")
+	minAttempts := flags.Int("min-attempts", 5, "ignore domains with fewer attempts")
+	_ = flags.Parse(args)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		kill("loading config file", err)
+	}
+
+	store, err := newSqlStore(config.Db)
+	if err != nil {
+		kill("opening db connection", err)
+	}
+
+	defer func() {
+		_ = store.Close()
+	}()
+
+	since := clock.Now().Add(-time.Duration(*days) * 24 * time.Hour)
+
+	attempts, err := store.AttemptsSince(context.Background(), since)
+	if err != nil {
+		kill("loading scrape attempts", err)
+	}
+
+	domains := make([]DomainStats, 0)
+	for _, d := range aggregateDomainStats(attempts) {
+		if d.Attempts >= *minAttempts && len(domains) < *limit {
+			domains = append(domains, d)
+		}
+	}
+
+	fmt.Printf("%d scrape attempts since %s\n\n", len(attempts), since.Format(time.RFC1123Z))
+
+	err = writeDomainStats(os.Stdout, domains)
+	if err != nil {
+		kill("writing stats", err)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const configPath = "config/config.json"
+
+const defaultInterval = 7 * time.Minute
+
+const defaultSolrTimeout = 10 * time.Second
+
+const defaultFetchWorkers = 32
+
+const defaultPersistWorkers = 4
+
+func loadConfig(path string) (AppConfig, error) {
+	config := AppConfig{}
+
+	encodedJson, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("reading config file: %w", err)
+	}
+
+	err = json.Unmarshal(encodedJson, &config)
+	if err != nil {
+		return config, fmt.Errorf("parsing json from config file: %w", err)
+	}
+
+	err = resolveSecrets(&config)
+	if err != nil {
+		return config, fmt.Errorf("resolving secrets: %w", err)
+	}
+
+	config.softNotFound = compileSoftNotFoundPatterns(config.SoftNotFoundPatterns)
+
+	return config, nil
+}
+
+// interval is how long to wait between cycles, falling back to the default
+// when unset or unparseable.
+func (c AppConfig) interval() time.Duration {
+	if c.Interval == "" {
+		return defaultInterval
+	}
+
+	interval, err := time.ParseDuration(c.Interval)
+	if err != nil || interval <= 0 {
+		fmt.Println("invalid interval", c.Interval, "using", defaultInterval)
+		return defaultInterval
+	}
+
+	return interval
+}
+
+func (c AppConfig) solrTimeout() time.Duration {
+	timeout := parseDurationOr(c.SolrTimeout, defaultSolrTimeout)
+	if timeout <= 0 {
+		return defaultSolrTimeout
+	}
+
+	return timeout
+}
+
+// persistWorkers is how many parsed pages are saved at once.
+func (c AppConfig) persistWorkers() int {
+	if c.PersistWorkers <= 0 {
+		return defaultPersistWorkers
+	}
+
+	return c.PersistWorkers
+}
+
+// fetchWorkers is how many pages are fetched at once.
+func (c AppConfig) fetchWorkers() int {
+	if c.FetchWorkers <= 0 {
+		return defaultFetchWorkers
+	}
+
+	return c.FetchWorkers
+}
+
+// parseWorkers is how many fetched pages are parsed at once.
+func (c AppConfig) parseWorkers() int {
+	if c.ParseWorkers <= 0 {
+		return runtime.NumCPU()
+	}
+
+	return c.ParseWorkers
+}
+
+func parseDurationOr(value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Println("invalid duration", value, "using", fallback)
+		return fallback
+	}
+
+	return duration
+}
+
+var (
+	appliedConfigMu sync.Mutex
+	appliedConfig   AppConfig
+)
+
+// currentConfig is the config last applied, for the servers running next to
+// the cycle loop, which see reloads as the cycles do.
+func currentConfig() AppConfig {
+	appliedConfigMu.Lock()
+	defer appliedConfigMu.Unlock()
+
+	return appliedConfig
+}
+
+// applyConfig updates process-wide state that is derived from the config.
+func applyConfig(config AppConfig) {
+	appliedConfigMu.Lock()
+	appliedConfig = config
+	appliedConfigMu.Unlock()
+
+	alerts.configure(config.Alerts)
+	metrics.configure(config.Metrics)
+	enrichment.configure(config)
+	setFieldPrecedence(config.FieldPrecedence)
+
+	reporter, err := newErrorReporter(config.Sentry)
+	if err != nil {
+		fmt.Println("could not configure error reporting", err.Error())
+		return
+	}
+
+	errorReporter = reporter
+}
+
+// reloadConfig re-reads the config file, keeping the current config if the
+// new one cannot be loaded. Settings that need a restart are reported but
+// otherwise ignored.
+func reloadConfig(current AppConfig) AppConfig {
+	fmt.Println("Reloading config from", configPath)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Println("could not reload config, keeping the previous one", err.Error())
+		alerts.reloadFailed(err.Error())
+		return current
+	}
+
+	if problems := validateConfig(config); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Println("invalid config:", problem.Error())
+		}
+
+		fmt.Println("could not reload config, keeping the previous one")
+		alerts.reloadFailed(fmt.Sprintf("%d problems found", len(problems)))
+		return current
+	}
+
+	if config.Db != current.Db {
+		fmt.Println("db settings changed, restart to apply them")
+		config.Db = current.Db
+	}
+
+	if config.DebugAddr != current.DebugAddr {
+		fmt.Println("debug address changed, restart to apply it")
+		config.DebugAddr = current.DebugAddr
+	}
+
+	if config.GrpcAddr != current.GrpcAddr {
+		fmt.Println("grpc address changed, restart to apply it")
+		config.GrpcAddr = current.GrpcAddr
+	}
+
+	applyConfig(config)
+	alerts.reloaded()
+
+	return config
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// conformanceDiff is a field whose extracted value or source differs from
+// the expected one.
+type conformanceDiff struct {
+	field    string
+	expected string
+	got      string
+}
+
+// conformanceFixture is an html page and the json of the Result expected
+// from parsing it, kept next to it with the same name.
+type conformanceFixture struct {
+	htmlPath     string
+	expectedPath string
+}
+
+// runConformance parses fixture pages and compares the results with the
+// expected ones, for checking extractor changes against real pages:
+// ogparser conformance [-update] ./testdata/...
+// A path ending in /... is searched recursively.
+func runConformance(args []string) {
+	flags := flag.NewFlagSet("conformance", flag.ExitOnError)
+	update := flags.Bool("update", false, "write the current results as the expected ones")
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Println("usage: ogparser conformance [-update] <dir or dir/...>...")
+		os.Exit(2)
+	}
+
+	fixtures := make([]conformanceFixture, 0)
+	for _, pattern := range flags.Args() {
+		found, err := findConformanceFixtures(pattern)
+		if err != nil {
+			kill("finding fixtures", err)
+		}
+		fixtures = append(fixtures, found...)
+	}
+
+	if len(fixtures) == 0 {
+		fmt.Println("no fixtures found")
+		os.Exit(2)
+	}
+
+	failed := 0
+	for _, fixture := range fixtures {
+		if *update {
+			err := updateConformanceFixture(fixture)
+			if err != nil {
+				kill("updating "+fixture.expectedPath, err)
+			}
+			fmt.Println("updated", fixture.expectedPath)
+			continue
+		}
+
+		diffs, err := checkConformanceFixture(fixture)
+		if err != nil {
+			failed++
+			fmt.Println("FAIL", fixture.htmlPath+":", err.Error())
+			continue
+		}
+
+		if len(diffs) == 0 {
+			fmt.Println("ok  ", fixture.htmlPath)
+			continue
+		}
+
+		failed++
+		fmt.Println("FAIL", fixture.htmlPath)
+		for _, diff := range diffs {
+			fmt.Printf("     %s\n       - %s\n       + %s\n", diff.field, diff.expected, diff.got)
+		}
+	}
+
+	if *update {
+		return
+	}
+
+	fmt.Printf("%d of %d fixtures passed\n", len(fixtures)-failed, len(fixtures))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// findConformanceFixtures lists the html files in dir, or under it for
+// dir/..., in name order.
+func findConformanceFixtures(pattern string) ([]conformanceFixture, error) {
+	recursive := false
+	dir := pattern
+	if strings.HasSuffix(pattern, "/...") || pattern == "..." {
+		recursive = true
+		dir = strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+		if dir == "" {
+			dir = "."
+		}
+	}
+
+	fixtures := make([]conformanceFixture, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if ext := strings.ToLower(filepath.Ext(path)); ext == ".html" || ext == ".htm" {
+			fixtures = append(fixtures, conformanceFixture{
+				htmlPath:     path,
+				expectedPath: strings.TrimSuffix(path, filepath.Ext(path)) + ".json",
+			})
+		}
+
+		return nil
+	})
+
+	sort.Slice(fixtures, func(i, j int) bool {
+		return fixtures[i].htmlPath < fixtures[j].htmlPath
+	})
+
+	return fixtures, err
+}
+
+// parseConformanceFixture parses the page as if it had been fetched from
+// the url in its expected json, so relative links resolve the same way.
+func parseConformanceFixture(fixture conformanceFixture, pageUrl string) (Result, error) {
+	page, err := ioutil.ReadFile(fixture.htmlPath)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if pageUrl == "" {
+		pageUrl = "https://example.com/" + filepath.ToSlash(filepath.Base(fixture.htmlPath))
+	}
+
+	return Parse(pageUrl, string(page)), nil
+}
+
+func checkConformanceFixture(fixture conformanceFixture) ([]conformanceDiff, error) {
+	data, err := ioutil.ReadFile(fixture.expectedPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading expected result: %w", err)
+	}
+
+	var expected Result
+	err = json.Unmarshal(data, &expected)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", fixture.expectedPath, err)
+	}
+
+	got, err := parseConformanceFixture(fixture, expected.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffResults(expected, got), nil
+}
+
+// diffResults compares the value and source of every field either result
+// has. The raw values aren't compared, as they are only there to explain
+// the sources.
+func diffResults(expected Result, got Result) []conformanceDiff {
+	fields := make([]string, 0, len(expected.Fields)+len(got.Fields))
+	for field := range expected.Fields {
+		fields = append(fields, field)
+	}
+	for field := range got.Fields {
+		if _, ok := expected.Fields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	describe := func(field ResultField, ok bool) string {
+		if !ok {
+			return "(missing)"
+		}
+		return fmt.Sprintf("%q from %s", field.Value, field.Source)
+	}
+
+	diffs := make([]conformanceDiff, 0)
+	for _, field := range fields {
+		want, wantOk := expected.Fields[field]
+		have, haveOk := got.Fields[field]
+
+		if wantOk == haveOk && want.Value == have.Value && want.Source == have.Source {
+			continue
+		}
+
+		diffs = append(diffs, conformanceDiff{
+			field:    field,
+			expected: describe(want, wantOk),
+			got:      describe(have, haveOk),
+		})
+	}
+
+	return diffs
+}
+
+// updateConformanceFixture writes what the page parses to now, keeping the
+// url of an existing expected result.
+func updateConformanceFixture(fixture conformanceFixture) error {
+	pageUrl := ""
+	if data, err := ioutil.ReadFile(fixture.expectedPath); err == nil {
+		var existing Result
+		if json.Unmarshal(data, &existing) == nil {
+			pageUrl = existing.Url
+		}
+	}
+
+	result, err := parseConformanceFixture(fixture, pageUrl)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	err = encoder.Encode(result)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fixture.expectedPath, buf.Bytes(), 0644)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestConformance parses every fixture in testdata/conformance and compares
+// it with the expected result next to it. After a deliberate extractor
+// change, refresh them with: ogparser conformance -update ./testdata/conformance/...
+func TestConformance(t *testing.T) {
+	fixtures, err := findConformanceFixtures("testdata/conformance/...")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures found in testdata/conformance")
+	}
+
+	for _, fixture := range fixtures {
+		fixture := fixture
+		t.Run(filepath.Base(fixture.htmlPath), func(t *testing.T) {
+			diffs, err := checkConformanceFixture(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, diff := range diffs {
+				t.Errorf("%s\n- %s\n+ %s", diff.field, diff.expected, diff.got)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
+)
+
+// sqlDialect holds the queries that differ between the supported databases.
+type sqlDialect struct {
+	name string
+	// recentPostsQuery selects the posts created in the last hour. The
+	// cutoff is taken on the database's side, in the time zone posts.created
+	// is written in, so it doesn't follow the injectable clock.
+	recentPostsQuery  string
+	insertIgnoreQuery string
+	// upsertCheckpointQuery takes name, last_post_id and updated
+	upsertCheckpointQuery string
+	// sameMetadataCondition compares the metadata column to a json string,
+	// NULLs included
+	sameMetadataCondition string
+	// upsertResponseQuery takes fk_post_id, status_code, final_url,
+	// content_type, content_length, server, duration_ms and fetched
+	upsertResponseQuery string
+	// upsertSiteBrandingQuery takes domain, site_name, icon, theme_color,
+	// tile_color, tile_image and updated, keeping the stored values for the
+	// NULL ones
+	upsertSiteBrandingQuery string
+}
+
+var mysqlDialect = sqlDialect{
+	name:              "mysql",
+	recentPostsQuery:  "SELECT pk_post_id, link, description, priority, fk_feed_id FROM posts WHERE created > (NOW() - interval 60 minute) AND permanent_failure IS NULL",
+	insertIgnoreQuery: "INSERT IGNORE INTO",
+	upsertCheckpointQuery: "INSERT INTO backfill_checkpoints (name, last_post_id, updated) VALUES (?, ?, ?) " +
+		"ON DUPLICATE KEY UPDATE last_post_id = VALUES(last_post_id), updated = VALUES(updated)",
+	// a json column never equals a string, only the json it's cast to
+	sameMetadataCondition: "metadata <=> CAST(? AS JSON)",
+	upsertResponseQuery: "INSERT INTO post_responses " +
+		"(fk_post_id, status_code, final_url, content_type, content_length, server, duration_ms, fetched) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?) " +
+		"ON DUPLICATE KEY UPDATE status_code = VALUES(status_code), final_url = VALUES(final_url), " +
+		"content_type = VALUES(content_type), content_length = VALUES(content_length), server = VALUES(server), " +
+		"duration_ms = VALUES(duration_ms), fetched = VALUES(fetched)",
+	upsertSiteBrandingQuery: "INSERT INTO domains (domain, site_name, icon, theme_color, tile_color, tile_image, updated) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?) " +
+		"ON DUPLICATE KEY UPDATE site_name = COALESCE(VALUES(site_name), site_name), icon = COALESCE(VALUES(icon), icon), " +
+		"theme_color = COALESCE(VALUES(theme_color), theme_color), tile_color = COALESCE(VALUES(tile_color), tile_color), " +
+		"tile_image = COALESCE(VALUES(tile_image), tile_image), updated = VALUES(updated)",
+}
+
+var sqliteDialect = sqlDialect{
+	name:              "sqlite",
+	recentPostsQuery:  "SELECT pk_post_id, link, description, priority, fk_feed_id FROM posts WHERE created > datetime('now', '-60 minutes') AND permanent_failure IS NULL",
+	insertIgnoreQuery: "INSERT OR IGNORE INTO",
+	upsertCheckpointQuery: "INSERT INTO backfill_checkpoints (name, last_post_id, updated) VALUES (?, ?, ?) " +
+		"ON CONFLICT (name) DO UPDATE SET last_post_id = excluded.last_post_id, updated = excluded.updated",
+	sameMetadataCondition: "metadata IS ?",
+	upsertResponseQuery: "INSERT INTO post_responses " +
+		"(fk_post_id, status_code, final_url, content_type, content_length, server, duration_ms, fetched) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?) " +
+		"ON CONFLICT (fk_post_id) DO UPDATE SET status_code = excluded.status_code, final_url = excluded.final_url, " +
+		"content_type = excluded.content_type, content_length = excluded.content_length, server = excluded.server, " +
+		"duration_ms = excluded.duration_ms, fetched = excluded.fetched",
+	upsertSiteBrandingQuery: "INSERT INTO domains (domain, site_name, icon, theme_color, tile_color, tile_image, updated) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?) " +
+		"ON CONFLICT (domain) DO UPDATE SET site_name = COALESCE(excluded.site_name, site_name), " +
+		"icon = COALESCE(excluded.icon, icon), theme_color = COALESCE(excluded.theme_color, theme_color), " +
+		"tile_color = COALESCE(excluded.tile_color, tile_color), tile_image = COALESCE(excluded.tile_image, tile_image), " +
+		"updated = excluded.updated",
+}
+
+func openDb(config DbConfig) (*sql.DB, sqlDialect, error) {
+	switch config.Driver {
+	case "", "mysql":
+		db, err := openMysql(config)
+		return db, mysqlDialect, err
+	case "sqlite":
+		db, err := openSqlite(config)
+		return db, sqliteDialect, err
+	default:
+		return nil, sqlDialect{}, fmt.Errorf("unsupported db driver %s", config.Driver)
+	}
+}
+
+func openMysql(config DbConfig) (*sql.DB, error) {
+	dbParams := make(map[string]string)
+	dbParams["charset"] = "utf8mb4"
+
+	dbConfig := mysql.Config{
+		User:   config.User,
+		Passwd: config.Password,
+		Net:    "tcp",
+		Addr:   config.Server,
+		DBName: config.DbName,
+		Params: dbParams,
+	}
+
+	return sql.Open("mysql", dbConfig.FormatDSN())
+}
+
+// openSqlite opens (creating if needed) a local database and brings its
+// schema up to date, so the parser can run without a mysql server.
+func openSqlite(config DbConfig) (*sql.DB, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("db.path is required for sqlite")
+	}
+
+	db, err := sql.Open("sqlite", "file:"+config.Path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite allows a single writer
+	db.SetMaxOpenConns(1)
+
+	err = migrate(context.Background(), db, sqliteDialect)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("bootstrapping sqlite schema: %w", err)
+	}
+
+	return db, nil
+}
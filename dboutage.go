@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDbBufferSize        = 1000
+	defaultDbReconnectAttempts = 5
+	defaultDbReconnectBackoff  = 2 * time.Second
+	maxDbReconnectBackoff      = time.Minute
+)
+
+// DbOutageConfig keeps a cycle going while the db is unreachable, holding on
+// to the writes it couldn't make until the db is back.
+type DbOutageConfig struct {
+	// BufferSize caps the saves held in memory, 0 uses the default
+	BufferSize int `json:"bufferSize"`
+	// SpillFile takes the saves that don't fit in the buffer, and those
+	// still pending when the process stops, so they survive a restart.
+	// Tenants other than the default one get their name appended.
+	SpillFile string `json:"spillFile"`
+	// ReconnectAttempts and ReconnectBackoff retry the ping a cycle starts
+	// with, doubling the wait every time.
+	ReconnectAttempts int    `json:"reconnectAttempts"`
+	ReconnectBackoff  string `json:"reconnectBackoff"`
+}
+
+func (c DbOutageConfig) bufferSize() int {
+	if c.BufferSize > 0 {
+		return c.BufferSize
+	}
+
+	return defaultDbBufferSize
+}
+
+func (c DbOutageConfig) reconnectAttempts() int {
+	if c.ReconnectAttempts > 0 {
+		return c.ReconnectAttempts
+	}
+
+	return defaultDbReconnectAttempts
+}
+
+func (c DbOutageConfig) spillPath(tenantName string) string {
+	if c.SpillFile == "" || tenantName == primaryTenantName {
+		return c.SpillFile
+	}
+
+	return c.SpillFile + "." + tenantName
+}
+
+// pendingSave is a write that failed while the db was down. Only one of its
+// fields is set, spill files written before the others existed only have
+// scraped.
+type pendingSave struct {
+	Scraped  *PostScraped      `json:"scraped,omitempty"`
+	Opts     SaveOptions       `json:"opts"`
+	Hash     *pendingHash      `json:"contentHash,omitempty"`
+	Response *ResponseMetadata `json:"response,omitempty"`
+	Branding *SiteBranding     `json:"branding,omitempty"`
+	Attempt  *ScrapeAttempt    `json:"attempt,omitempty"`
+	Audit    *pendingAudit     `json:"audit,omitempty"`
+}
+
+type pendingHash struct {
+	PostID int64  `json:"postId"`
+	Hash   string `json:"hash"`
+}
+
+// pendingAudit is an AuditEntry with every field kept, as its own json only
+// has the lists stored in the details column.
+type pendingAudit struct {
+	PostID     int64     `json:"postId"`
+	Created    time.Time `json:"created"`
+	Url        string    `json:"url"`
+	StatusCode int       `json:"statusCode"`
+	Bytes      int       `json:"bytes"`
+	Outcome    string    `json:"outcome"`
+	Fields     []string  `json:"fields,omitempty"`
+	Sinks      []string  `json:"sinks,omitempty"`
+	Notes      []string  `json:"notes,omitempty"`
+}
+
+// apply makes the write against store.
+func (save pendingSave) apply(ctx context.Context, store Store) error {
+	switch {
+	case save.Scraped != nil:
+		_, err := store.SaveMetadata(ctx, *save.Scraped, save.Opts)
+		return err
+	case save.Hash != nil:
+		return store.SaveContentHash(ctx, save.Hash.PostID, save.Hash.Hash)
+	case save.Response != nil:
+		return store.SaveResponse(ctx, *save.Response)
+	case save.Branding != nil:
+		return store.SaveSiteBranding(ctx, *save.Branding)
+	case save.Attempt != nil:
+		return store.RecordAttempt(ctx, *save.Attempt)
+	case save.Audit != nil:
+		return store.RecordAudit(ctx, AuditEntry(*save.Audit))
+	}
+
+	return nil
+}
+
+func (save pendingSave) String() string {
+	switch {
+	case save.Scraped != nil:
+		return "og values for " + save.Scraped.Post.Url
+	case save.Hash != nil:
+		return fmt.Sprint("content hash of post ", save.Hash.PostID)
+	case save.Response != nil:
+		return fmt.Sprint("response metadata of post ", save.Response.PostID)
+	case save.Branding != nil:
+		return "site branding of " + save.Branding.Domain
+	case save.Attempt != nil:
+		return fmt.Sprint("scrape attempt of post ", save.Attempt.PostID)
+	case save.Audit != nil:
+		return fmt.Sprint("audit entry of post ", save.Audit.PostID)
+	}
+
+	return "nothing"
+}
+
+// bufferingStore holds saves that fail as the db connection is lost and
+// replays them, oldest first, once a save or ping gets through again.
+type bufferingStore struct {
+	Store
+	config    DbOutageConfig
+	spillPath string
+
+	mu       sync.Mutex
+	pending  []pendingSave
+	retryAt  time.Time
+	backoff  time.Duration
+	flushing bool
+}
+
+func newBufferingStore(store Store, config DbOutageConfig, tenantName string) *bufferingStore {
+	return &bufferingStore{
+		Store:     store,
+		config:    config,
+		spillPath: config.spillPath(tenantName),
+	}
+}
+
+// Ping retries with backoff, so a db restarting as a cycle starts doesn't
+// cost the whole cycle, and replays what was buffered once it's back.
+func (s *bufferingStore) Ping(ctx context.Context) error {
+	backoff := parseDurationOr(s.config.ReconnectBackoff, defaultDbReconnectBackoff)
+	attempts := s.config.reconnectAttempts()
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = s.Store.Ping(ctx)
+		if err == nil {
+			s.flush(ctx, true)
+			return nil
+		}
+
+		if attempt == attempts {
+			break
+		}
+
+		fmt.Printf("could not ping db (attempt %d of %d), retrying in %s: %s\n", attempt, attempts, backoff, err.Error())
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-clock.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxDbReconnectBackoff {
+			backoff = maxDbReconnectBackoff
+		}
+	}
+
+	return err
+}
+
+// SaveMetadata reports a save it had to buffer as written, so the rest of
+// the pipeline carries on as it will be once the db is back.
+func (s *bufferingStore) SaveMetadata(ctx context.Context, scraped PostScraped, opts SaveOptions) (bool, error) {
+	if s.queued(ctx) {
+		s.buffer(pendingSave{Scraped: &scraped, Opts: opts})
+		return true, nil
+	}
+
+	changed, err := s.Store.SaveMetadata(ctx, scraped, opts)
+	if err == nil || !isConnectionError(err) {
+		return changed, err
+	}
+
+	s.unreachable(pendingSave{Scraped: &scraped, Opts: opts}, err)
+
+	return true, nil
+}
+
+func (s *bufferingStore) SaveContentHash(ctx context.Context, postID int64, hash string) error {
+	return s.write(ctx, pendingSave{Hash: &pendingHash{PostID: postID, Hash: hash}})
+}
+
+func (s *bufferingStore) SaveResponse(ctx context.Context, response ResponseMetadata) error {
+	return s.write(ctx, pendingSave{Response: &response})
+}
+
+func (s *bufferingStore) SaveSiteBranding(ctx context.Context, branding SiteBranding) error {
+	return s.write(ctx, pendingSave{Branding: &branding})
+}
+
+func (s *bufferingStore) RecordAttempt(ctx context.Context, attempt ScrapeAttempt) error {
+	return s.write(ctx, pendingSave{Attempt: &attempt})
+}
+
+func (s *bufferingStore) RecordAudit(ctx context.Context, entry AuditEntry) error {
+	audit := pendingAudit(entry)
+	return s.write(ctx, pendingSave{Audit: &audit})
+}
+
+// write makes a save, or buffers it if the db is unreachable.
+func (s *bufferingStore) write(ctx context.Context, save pendingSave) error {
+	if s.queued(ctx) {
+		s.buffer(save)
+		return nil
+	}
+
+	err := save.apply(ctx, s.Store)
+	if err == nil || !isConnectionError(err) {
+		return err
+	}
+
+	s.unreachable(save, err)
+
+	return nil
+}
+
+// queued replays what's buffered if it's time to, and reports whether
+// anything is still waiting. New saves then queue up behind it, as a
+// content hash replayed after its post's metadata was saved again would
+// otherwise have that metadata skipped as unchanged.
+func (s *bufferingStore) queued(ctx context.Context) bool {
+	s.flush(ctx, false)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.pending) > 0 || s.flushing || s.hasSpill()
+}
+
+func (s *bufferingStore) unreachable(save pendingSave, err error) {
+	fmt.Println("db is unreachable, buffering the", save.String(), err.Error())
+	s.buffer(save)
+	s.failed()
+}
+
+// Close makes a last attempt at replaying what is buffered, and spills what
+// is still left so it can be replayed after a restart.
+func (s *bufferingStore) Close() error {
+	s.flush(context.Background(), true)
+
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if len(pending) > 0 {
+		if s.spillPath == "" {
+			fmt.Println("dropping", len(pending), "buffered saves as no db spill file is configured")
+		} else if err := appendSpill(s.spillPath, pending); err != nil {
+			fmt.Println("could not spill buffered saves", err.Error())
+		}
+	}
+
+	return s.Store.Close()
+}
+
+func (s *bufferingStore) buffer(save pendingSave) {
+	// the fetch error doesn't matter for saving, and can't be decoded again
+	if save.Scraped != nil {
+		scraped := *save.Scraped
+		scraped.FetchErr = nil
+		save.Scraped = &scraped
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) < s.config.bufferSize() {
+		s.pending = append(s.pending, save)
+		return
+	}
+
+	if s.spillPath != "" {
+		err := appendSpill(s.spillPath, []pendingSave{save})
+		if err == nil {
+			return
+		}
+		fmt.Println("could not spill buffered save", err.Error())
+	}
+
+	fmt.Println("db buffer is full, dropping the", save.String())
+}
+
+// failed holds off replaying for a while, doubling the wait up to a minute.
+func (s *bufferingStore) failed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.backoff == 0 {
+		s.backoff = parseDurationOr(s.config.ReconnectBackoff, defaultDbReconnectBackoff)
+	} else if s.backoff < maxDbReconnectBackoff {
+		s.backoff *= 2
+		if s.backoff > maxDbReconnectBackoff {
+			s.backoff = maxDbReconnectBackoff
+		}
+	}
+
+	s.retryAt = clock.Now().Add(s.backoff)
+}
+
+// flush replays the buffered saves, then the spilled ones, stopping at the
+// first that fails for want of a connection. force ignores the backoff.
+func (s *bufferingStore) flush(ctx context.Context, force bool) {
+	s.mu.Lock()
+	if s.flushing || (!force && clock.Now().Before(s.retryAt)) {
+		s.mu.Unlock()
+		return
+	}
+
+	s.flushing = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.flushing = false
+		s.mu.Unlock()
+	}()
+
+	// saves made while replaying queue up behind it, so go again for those
+	for s.replayPending(ctx) {
+	}
+}
+
+// replayPending replays what is buffered and spilled, reporting whether it
+// all went through and more saves were buffered meanwhile.
+func (s *bufferingStore) replayPending(ctx context.Context) bool {
+	s.mu.Lock()
+	if len(s.pending) == 0 && !s.hasSpill() {
+		s.mu.Unlock()
+		return false
+	}
+
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	remaining := s.replay(ctx, pending)
+	if len(remaining) > 0 {
+		s.mu.Lock()
+		s.pending = append(remaining, s.pending...)
+		s.mu.Unlock()
+		s.failed()
+		return false
+	}
+
+	if s.spillPath != "" && s.hasSpill() {
+		spilled, err := readSpill(s.spillPath)
+		if err != nil {
+			fmt.Println("could not read db spill file", err.Error())
+			return false
+		}
+
+		remaining = s.replay(ctx, spilled)
+		err = writeSpill(s.spillPath, remaining)
+		if err != nil {
+			fmt.Println("could not rewrite db spill file", err.Error())
+		}
+
+		if len(remaining) > 0 {
+			s.failed()
+			return false
+		}
+	}
+
+	s.recovered()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.pending) > 0
+}
+
+func (s *bufferingStore) recovered() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.backoff = 0
+	s.retryAt = time.Time{}
+}
+
+// replay saves each pending write, returning those from the first one that
+// couldn't reach the db onwards.
+func (s *bufferingStore) replay(ctx context.Context, pending []pendingSave) []pendingSave {
+	for i, save := range pending {
+		err := save.apply(ctx, s.Store)
+		if err != nil && isConnectionError(err) {
+			return pending[i:]
+		}
+
+		if err != nil {
+			fmt.Println("could not save buffered", save.String(), err.Error())
+			if save.Scraped != nil {
+				reportError("db", save.Scraped.Post, err)
+			}
+			continue
+		}
+
+		fmt.Println("saved buffered", save.String())
+	}
+
+	return nil
+}
+
+func (s *bufferingStore) hasSpill() bool {
+	if s.spillPath == "" {
+		return false
+	}
+
+	info, err := os.Stat(s.spillPath)
+
+	return err == nil && info.Size() > 0
+}
+
+// appendSpill writes saves as json lines to the end of the spill file.
+func appendSpill(path string, saves []pendingSave) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(f)
+	for _, save := range saves {
+		err = encoder.Encode(save)
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+
+	return f.Close()
+}
+
+func readSpill(path string) ([]pendingSave, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	saves := make([]pendingSave, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 64<<20)
+
+	for scanner.Scan() {
+		var save pendingSave
+		err = json.Unmarshal(scanner.Bytes(), &save)
+		if err != nil {
+			fmt.Println("skipping unreadable line in db spill file", err.Error())
+			continue
+		}
+
+		saves = append(saves, save)
+	}
+
+	return saves, scanner.Err()
+}
+
+// writeSpill replaces the spill file with the saves still pending, going
+// through a temporary file so a crash can't lose the lot.
+func writeSpill(path string, saves []pendingSave) error {
+	if len(saves) == 0 {
+		return os.Remove(path)
+	}
+
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, nil, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = appendSpill(tmp, saves)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// isConnectionError tells a lost or refused db connection, which is worth
+// retrying, from a query the db rejected.
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	message := err.Error()
+	for _, text := range []string{"invalid connection", "connection refused", "broken pipe", "connection reset", "bad connection", "unexpected EOF"} {
+		if strings.Contains(message, text) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+)
+
+// downStore fails every write with a lost connection while down is set.
+type downStore struct {
+	*memoryStore
+
+	mu   sync.Mutex
+	down bool
+}
+
+func (s *downStore) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.down = down
+}
+
+func (s *downStore) err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.down {
+		return driver.ErrBadConn
+	}
+
+	return nil
+}
+
+func (s *downStore) Ping(ctx context.Context) error {
+	return s.err()
+}
+
+func (s *downStore) SaveMetadata(ctx context.Context, scraped PostScraped, opts SaveOptions) (bool, error) {
+	if err := s.err(); err != nil {
+		return false, err
+	}
+
+	return s.memoryStore.SaveMetadata(ctx, scraped, opts)
+}
+
+func (s *downStore) SaveContentHash(ctx context.Context, postID int64, hash string) error {
+	if err := s.err(); err != nil {
+		return err
+	}
+
+	return s.memoryStore.SaveContentHash(ctx, postID, hash)
+}
+
+func (s *downStore) SaveSiteBranding(ctx context.Context, branding SiteBranding) error {
+	if err := s.err(); err != nil {
+		return err
+	}
+
+	return s.memoryStore.SaveSiteBranding(ctx, branding)
+}
+
+func (s *downStore) RecordAttempt(ctx context.Context, attempt ScrapeAttempt) error {
+	if err := s.err(); err != nil {
+		return err
+	}
+
+	return s.memoryStore.RecordAttempt(ctx, attempt)
+}
+
+func TestBufferingStoreReplaysEveryWrite(t *testing.T) {
+	ctx := context.Background()
+	post := Post{PostID: 1, Url: "https://example.com/post"}
+	db := &downStore{memoryStore: newMemoryStore([]Post{post}), down: true}
+	store := newBufferingStore(db, DbOutageConfig{}, primaryTenantName)
+
+	scraped := PostScraped{Post: post, OpenGraphTags: OpenGraphTags{Description: "buffered"}}
+	opts := SaveOptions{}
+
+	changed, err := store.SaveMetadata(ctx, scraped, opts)
+	if err != nil || !changed {
+		t.Fatalf("SaveMetadata = %v, %v, want the save buffered", changed, err)
+	}
+
+	writes := []error{
+		store.SaveContentHash(ctx, 1, scraped.contentHash(opts)),
+		store.SaveSiteBranding(ctx, SiteBranding{Domain: "example.com", SiteName: "Example"}),
+		store.RecordAttempt(ctx, ScrapeAttempt{PostID: 1, Success: true}),
+	}
+	for _, err := range writes {
+		if err != nil {
+			t.Fatalf("write was not buffered: %v", err)
+		}
+	}
+
+	if _, ok := db.Saved(1); ok {
+		t.Fatal("metadata was saved while the db was down")
+	}
+
+	db.setDown(false)
+	if err := store.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	if _, ok := db.Saved(1); !ok {
+		t.Error("buffered metadata was not replayed")
+	}
+	if db.brandings["example.com"].SiteName != "Example" {
+		t.Error("buffered site branding was not replayed")
+	}
+	if len(db.Attempts()) != 1 {
+		t.Errorf("replayed %d attempts, want 1", len(db.Attempts()))
+	}
+
+	// the hash was replayed after the metadata it belongs to, so the same
+	// values are now seen as unchanged
+	changed, err = store.SaveMetadata(ctx, scraped, opts)
+	if err != nil || changed {
+		t.Errorf("SaveMetadata after replay = %v, %v, want unchanged", changed, err)
+	}
+}
+
+func TestBufferingStoreWaitsOutItsBackoff(t *testing.T) {
+	manual := useManualClock(t)
+
+	ctx := context.Background()
+	db := &downStore{memoryStore: newMemoryStore(nil), down: true}
+	store := newBufferingStore(db, DbOutageConfig{ReconnectBackoff: "10s"}, primaryTenantName)
+
+	for postID := int64(1); postID <= 2; postID++ {
+		if postID == 2 {
+			db.setDown(false)
+		}
+
+		err := store.RecordAttempt(ctx, ScrapeAttempt{PostID: postID})
+		if err != nil {
+			t.Fatalf("attempt %d was not buffered: %v", postID, err)
+		}
+	}
+
+	if attempts := db.Attempts(); len(attempts) != 0 {
+		t.Fatalf("%d attempts were written before the backoff was up", len(attempts))
+	}
+
+	manual.Advance(11 * time.Second)
+
+	err := store.RecordAttempt(ctx, ScrapeAttempt{PostID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := db.Attempts()
+	if len(attempts) != 3 {
+		t.Fatalf("%d attempts were written once the backoff was up, want 3", len(attempts))
+	}
+	for i, attempt := range attempts {
+		if attempt.PostID != int64(i+1) {
+			t.Errorf("attempt %d is for post %d, want them in order", i, attempt.PostID)
+		}
+	}
+}
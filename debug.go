@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+)
+
+// startDebugServer exposes the pprof handlers on their own listener so they
+// are never reachable through anything public. Goroutine dumps are available
+// at /debug/pprof/goroutine?debug=2.
+func startDebugServer(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	go func() {
+		fmt.Println("Starting debug server on", addr)
+		err := http.ListenAndServe(addr, mux)
+		if err != nil {
+			fmt.Println("debug server stopped", err.Error())
+		}
+	}()
+}
@@ -0,0 +1,85 @@
+package main
+
+import "unicode/utf8"
+
+// DescriptionLimitsConfig caps descriptions as they are written, e.g. so they
+// fit the description column of a strict mode mysql instead of failing the
+// update. Descriptions are cut at a sentence or a word, ending with an
+// ellipsis when cut at a word. Feed descriptions saved for pages without one
+// are cut too.
+type DescriptionLimitsConfig struct {
+	// Db is in bytes as the column's charset stores them, since that's
+	// what a TEXT column is limited by
+	Db int `json:"db"`
+	// Solr is in characters
+	Solr int `json:"solr"`
+}
+
+// withDescriptionLimit is the post as it's saved with descriptions of at
+// most max bytes in the db's charset, leaving what goes to the sinks as it
+// was.
+func (scraped PostScraped) withDescriptionLimit(max int, db DbConfig) PostScraped {
+	fourByte := db.fourByteMode()
+	scraped.OpenGraphTags.Description = truncateDescriptionBytes(scraped.OpenGraphTags.Description, max, fourByte)
+	scraped.Post.OrigDescription = truncateDescriptionBytes(scraped.Post.OrigDescription, max, fourByte)
+
+	return scraped
+}
+
+// truncateDescriptionBytes is truncateDescription with max counted in the
+// bytes text takes once written with fourByte, see storedLength.
+func truncateDescriptionBytes(text string, max int, fourByte string) string {
+	if max <= 0 || storedLength(text, fourByte) <= max {
+		return text
+	}
+
+	// the runes that fit are an upper bound, the ellipsis can take a few more
+	// bytes than the characters it replaces
+	limit := 0
+	size := 0
+	for _, r := range text {
+		size += storedRuneLength(r, fourByte)
+		if size > max {
+			break
+		}
+		limit++
+	}
+
+	for ; limit > 0; limit-- {
+		truncated := truncateDescription(text, limit)
+		if storedLength(truncated, fourByte) <= max {
+			return truncated
+		}
+	}
+
+	return ""
+}
+
+// storedLength is how many bytes text takes in a column: as utf-8 with
+// utf8mb4, while utf8 (utf8mb3) columns get the four byte characters
+// replaced or stripped, as limitFourByteChars does.
+func storedLength(text string, fourByte string) int {
+	size := 0
+	for _, r := range text {
+		size += storedRuneLength(r, fourByte)
+	}
+
+	return size
+}
+
+func storedRuneLength(r rune, fourByte string) int {
+	size := utf8.RuneLen(r)
+	if size < 0 {
+		// invalid utf-8 is repaired to U+FFFD before writing
+		return utf8.RuneLen(utf8.RuneError)
+	}
+
+	if size == 4 && fourByte == fourByteStrip {
+		return 0
+	}
+	if size == 4 && fourByte == fourByteReplace {
+		return utf8.RuneLen(utf8.RuneError)
+	}
+
+	return size
+}
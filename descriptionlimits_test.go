@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithDescriptionLimitCountsBytes(t *testing.T) {
+	description := "Ünïcödé wörds 😀 everywhere. " + strings.Repeat("Ärger über Öl 😀 ", 20)
+
+	tests := []struct {
+		charset string
+		max     int
+	}{
+		{"utf8mb4", 60},
+		{"utf8", 60},
+		{"utf8mb4", 200},
+		{"utf8", 7},
+	}
+
+	for _, test := range tests {
+		db := DbConfig{Charset: test.charset}
+		scraped := PostScraped{
+			Post:          Post{OrigDescription: description},
+			OpenGraphTags: OpenGraphTags{Description: description},
+		}
+
+		saved := scraped.withDescriptionLimit(test.max, db)
+
+		for _, text := range []string{saved.OpenGraphTags.Description, saved.Post.OrigDescription} {
+			written := limitFourByteChars(text, db.fourByteMode())
+			if len(written) > test.max {
+				t.Errorf("%s, %d bytes: %q takes %d bytes", test.charset, test.max, written, len(written))
+			}
+			if text == "" || !strings.HasPrefix(description, strings.TrimSuffix(text, "…")) {
+				t.Errorf("%s, %d bytes: %q isn't a cut of the description", test.charset, test.max, text)
+			}
+		}
+	}
+
+	if saved := (PostScraped{OpenGraphTags: OpenGraphTags{Description: description}}).withDescriptionLimit(0, DbConfig{}); saved.OpenGraphTags.Description != description {
+		t.Error("a limit of 0 cut the description")
+	}
+}
+
+func TestNormalizeDoesNotAddAnEllipsis(t *testing.T) {
+	tags := OpenGraphTags{Description: "One two three four five six"}
+	tags.normalize(10)
+
+	if tags.Description != "One two th" {
+		t.Errorf("normalize cut the description to %q", tags.Description)
+	}
+}
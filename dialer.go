@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// defaultFallbackDelay matches net.Dialer's wait before racing the other
+// address family.
+const defaultFallbackDelay = 300 * time.Millisecond
+
+// AddressFamilyOptions work around hosts publishing broken AAAA records.
+type AddressFamilyOptions struct {
+	PreferIPv4 bool
+	// IPv4OnlyHosts are never dialled over IPv6. Subdomains are included.
+	IPv4OnlyHosts []string
+	// FallbackDelay is how long to wait on the preferred family before also
+	// trying the other one, or negative to try addresses strictly in order.
+	FallbackDelay time.Duration
+}
+
+// dialContext resolves the host (through the dns cache when there is one)
+// and dials its addresses in order of preference.
+func (f *httpFetcher) dialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return f.dialer.DialContext(ctx, network, addr)
+	}
+
+	var addrs []string
+	if f.dnsCache != nil {
+		addrs, err = f.dnsCache.LookupHost(ctx, host)
+	} else {
+		addrs, err = f.resolver.LookupHost(ctx, host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	primaries, fallbacks := f.partitionAddrs(host, addrs)
+	if len(primaries) == 0 {
+		return nil, &net.DNSError{Err: "no usable addresses", Name: host, IsNotFound: true}
+	}
+
+	if len(fallbacks) == 0 || f.families.FallbackDelay < 0 {
+		return f.dialSerial(ctx, network, append(primaries, fallbacks...), port)
+	}
+
+	return f.dialParallel(ctx, network, primaries, fallbacks, port)
+}
+
+// partitionAddrs splits addresses into the preferred family, tried first, and
+// the other family.
+func (f *httpFetcher) partitionAddrs(host string, addrs []string) ([]string, []string) {
+	ipv4Only := f.isIPv4OnlyHost(host)
+
+	preferIPv4 := f.families.PreferIPv4 || ipv4Only
+	if !preferIPv4 && len(addrs) > 0 {
+		// otherwise keep the resolver's preference
+		preferIPv4 = isIPv4(addrs[0])
+	}
+
+	primaries := make([]string, 0, len(addrs))
+	fallbacks := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if isIPv4(addr) == preferIPv4 {
+			primaries = append(primaries, addr)
+		} else if !ipv4Only {
+			fallbacks = append(fallbacks, addr)
+		}
+	}
+
+	if len(primaries) == 0 {
+		return fallbacks, nil
+	}
+
+	return primaries, fallbacks
+}
+
+func (f *httpFetcher) isIPv4OnlyHost(host string) bool {
+	return hostMatches(host, f.families.IPv4OnlyHosts) || f.domains.forHost(host).Ipv4Only
+}
+
+func isIPv4(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.To4() != nil
+}
+
+func (f *httpFetcher) dialSerial(ctx context.Context, network string, addrs []string, port string) (net.Conn, error) {
+	var err error
+	for _, ip := range addrs {
+		var conn net.Conn
+		conn, err = f.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, err
+}
+
+// dialParallel dials the primary addresses, racing the fallbacks once the
+// fallback delay has passed or the primaries have all failed.
+func (f *httpFetcher) dialParallel(
+	ctx context.Context, network string, primaries []string, fallbacks []string, port string,
+) (net.Conn, error) {
+	type dialResult struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, 2)
+	dial := func(addrs []string, primary bool) {
+		conn, err := f.dialSerial(ctx, network, addrs, port)
+		results <- dialResult{conn: conn, err: err, primary: primary}
+	}
+
+	go dial(primaries, true)
+	pending := 1
+
+	fallbackDelay := f.families.FallbackDelay
+	if fallbackDelay == 0 {
+		fallbackDelay = defaultFallbackDelay
+	}
+
+	fallbackTimer := time.NewTimer(fallbackDelay)
+	defer fallbackTimer.Stop()
+	fallbackStarted := false
+
+	var firstErr error
+	for {
+		select {
+		case <-fallbackTimer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go dial(fallbacks, false)
+			}
+		case result := <-results:
+			pending--
+
+			if result.err == nil {
+				// close the loser if it connects before seeing the cancel
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if late := <-results; late.conn != nil {
+							_ = late.conn.Close()
+						}
+					}
+				}(pending)
+
+				return result.conn, nil
+			}
+
+			if firstErr == nil || result.primary {
+				firstErr = result.err
+			}
+
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go dial(fallbacks, false)
+			}
+
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
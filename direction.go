@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	directionRtl = "rtl"
+	directionLtr = "ltr"
+)
+
+// rtlLanguages are written right to left.
+var rtlLanguages = map[string]bool{
+	"ar":  true,
+	"he":  true,
+	"fa":  true,
+	"ur":  true,
+	"yi":  true,
+	"ps":  true,
+	"sd":  true,
+	"ug":  true,
+	"dv":  true,
+	"ckb": true,
+}
+
+// normalizeDirection keeps a dir attribute that sets a direction, ignoring
+// "auto".
+func normalizeDirection(dir string) string {
+	switch dir = strings.ToLower(strings.TrimSpace(dir)); dir {
+	case directionRtl, directionLtr:
+		return dir
+	}
+
+	return ""
+}
+
+// detectDirection prefers the dir attribute of the page, then the direction
+// of the description's text and finally that of the language. It also
+// returns which of those the direction came from.
+func detectDirection(tags OpenGraphTags) (string, string) {
+	if dir := normalizeDirection(tags.HtmlDir); dir != "" {
+		return dir, sourceHtml
+	}
+
+	if dir := textDirection(tags.Description); dir != "" {
+		return dir, sourceHeuristic
+	}
+
+	if tags.Language == "" {
+		return "", ""
+	}
+
+	source := tags.Sources["language"].Source
+	if rtlLanguages[tags.Language] {
+		return directionRtl, source
+	}
+
+	return directionLtr, source
+}
+
+// textDirection is the direction of most of the letters in text, as the
+// first one, which browsers go by, is often a latin brand name.
+func textDirection(text string) string {
+	rtl, ltr := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko):
+			rtl++
+		case unicode.IsLetter(r):
+			ltr++
+		}
+	}
+
+	switch {
+	case rtl == 0 && ltr == 0:
+		return ""
+	case rtl > ltr:
+		return directionRtl
+	default:
+		return directionLtr
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDnsCacheTtl = time.Minute
+	// dnsCacheFailureTtl is how long a failed lookup is remembered, so a dead
+	// host doesn't send a query for every one of its posts
+	dnsCacheFailureTtl = 5 * time.Second
+	// dnsCacheSize is how many hosts are remembered at most
+	dnsCacheSize = 10000
+)
+
+// dnsCache remembers resolved addresses so a cycle fetching many pages from
+// the same hosts doesn't ask the resolver every time. Entries live for the
+// records' TTL when the resolver reports it, ttl at most. The stdlib resolver
+// doesn't, so its entries live for ttl.
+type dnsCache struct {
+	resolver hostResolver
+	ttl      time.Duration
+	// config is what resolver was built from
+	config string
+
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+	// hosts are the keys of entries in the order they were added
+	hosts []string
+}
+
+type dnsCacheEntry struct {
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+// ttlResolver is a resolver that knows how long its answers may be cached.
+type ttlResolver interface {
+	lookupHostTtl(ctx context.Context, host string) ([]string, time.Duration, error)
+}
+
+func newDnsCache(resolver hostResolver, ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		resolver: resolver,
+		ttl:      ttl,
+		entries:  make(map[string]dnsCacheEntry),
+	}
+}
+
+var (
+	sharedDnsCacheMu sync.Mutex
+	sharedDnsCache   *dnsCache
+)
+
+// dnsCacheFor returns the process-wide cache, so entries outlive the fetcher
+// of a single cycle. Changing the ttl or the dns servers starts a new cache.
+func dnsCacheFor(ttl time.Duration, config DnsConfig) *dnsCache {
+	sharedDnsCacheMu.Lock()
+	defer sharedDnsCacheMu.Unlock()
+
+	key := fmt.Sprintf("%+v", config)
+	if sharedDnsCache == nil || sharedDnsCache.ttl != ttl || sharedDnsCache.config != key {
+		sharedDnsCache = newDnsCache(newHostResolver(config), ttl)
+		sharedDnsCache.config = key
+	}
+
+	return sharedDnsCache
+}
+
+func (c *dnsCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	now := clock.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+
+	if ok && now.Before(entry.expires) {
+		return entry.addrs, entry.err
+	}
+
+	addrs, ttl, err := c.lookup(ctx, host)
+	if err != nil {
+		// a lookup given up on by the caller says nothing about the host
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		ttl = dnsCacheFailureTtl
+	}
+
+	if ttl > c.ttl {
+		ttl = c.ttl
+	}
+
+	c.add(host, dnsCacheEntry{addrs: addrs, err: err, expires: now.Add(ttl)})
+
+	return addrs, err
+}
+
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, time.Duration, error) {
+	if resolver, ok := c.resolver.(ttlResolver); ok {
+		return resolver.lookupHostTtl(ctx, host)
+	}
+
+	addrs, err := c.resolver.LookupHost(ctx, host)
+
+	return addrs, c.ttl, err
+}
+
+// add remembers an entry, forgetting the oldest host when the cache is full.
+func (c *dnsCache) add(host string, entry dnsCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[host]; !ok {
+		if len(c.hosts) >= dnsCacheSize {
+			delete(c.entries, c.hosts[0])
+			c.hosts = c.hosts[1:]
+		}
+
+		c.hosts = append(c.hosts, host)
+	}
+
+	c.entries[host] = entry
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// countingResolver answers every host with one address, counting lookups.
+type countingResolver struct {
+	lookups map[string]int
+	ttl     time.Duration
+	err     error
+}
+
+func (r *countingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lookups[host]++
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return []string{"192.0.2.1"}, nil
+}
+
+// ttlCountingResolver also reports a record TTL.
+type ttlCountingResolver struct {
+	*countingResolver
+}
+
+func (r ttlCountingResolver) lookupHostTtl(ctx context.Context, host string) ([]string, time.Duration, error) {
+	addrs, err := r.LookupHost(ctx, host)
+
+	return addrs, r.ttl, err
+}
+
+func TestDnsCacheHonoursRecordTtl(t *testing.T) {
+	manual := useManualClock(t)
+	ctx := context.Background()
+
+	resolver := &countingResolver{lookups: make(map[string]int), ttl: 10 * time.Second}
+	cache := newDnsCache(ttlCountingResolver{resolver}, time.Minute)
+
+	_, _ = cache.LookupHost(ctx, "example.com")
+	manual.Advance(5 * time.Second)
+	_, _ = cache.LookupHost(ctx, "example.com")
+	if resolver.lookups["example.com"] != 1 {
+		t.Fatalf("looked up %d times within the record ttl, want 1", resolver.lookups["example.com"])
+	}
+
+	manual.Advance(6 * time.Second)
+	_, _ = cache.LookupHost(ctx, "example.com")
+	if resolver.lookups["example.com"] != 2 {
+		t.Errorf("looked up %d times after the record ttl, want 2", resolver.lookups["example.com"])
+	}
+
+	// a record ttl longer than the cache's is capped
+	resolver.ttl = time.Hour
+	manual.Advance(time.Hour)
+	_, _ = cache.LookupHost(ctx, "example.com")
+	manual.Advance(2 * time.Minute)
+	_, _ = cache.LookupHost(ctx, "example.com")
+	if resolver.lookups["example.com"] != 4 {
+		t.Errorf("looked up %d times, want the record ttl capped", resolver.lookups["example.com"])
+	}
+}
+
+func TestDnsCacheRemembersFailuresBriefly(t *testing.T) {
+	manual := useManualClock(t)
+	ctx := context.Background()
+
+	resolver := &countingResolver{
+		lookups: make(map[string]int),
+		err:     &net.DNSError{Err: "no such host", Name: "gone.example", IsNotFound: true},
+	}
+	cache := newDnsCache(resolver, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		_, err := cache.LookupHost(ctx, "gone.example")
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) {
+			t.Fatalf("LookupHost = %v, want the dns error", err)
+		}
+	}
+
+	if resolver.lookups["gone.example"] != 1 {
+		t.Fatalf("looked up %d times, want the failure remembered", resolver.lookups["gone.example"])
+	}
+
+	manual.Advance(dnsCacheFailureTtl + time.Second)
+	_, _ = cache.LookupHost(ctx, "gone.example")
+	if resolver.lookups["gone.example"] != 2 {
+		t.Errorf("looked up %d times, want the failure forgotten", resolver.lookups["gone.example"])
+	}
+}
+
+func TestDnsCacheIsBounded(t *testing.T) {
+	useManualClock(t)
+	ctx := context.Background()
+
+	resolver := &countingResolver{lookups: make(map[string]int)}
+	cache := newDnsCache(resolver, time.Minute)
+
+	for i := 0; i <= dnsCacheSize; i++ {
+		_, _ = cache.LookupHost(ctx, fmt.Sprintf("host%d.example", i))
+	}
+
+	if len(cache.entries) != dnsCacheSize {
+		t.Errorf("cache holds %d hosts, want %d", len(cache.entries), dnsCacheSize)
+	}
+
+	// the oldest host was forgotten, the newest kept
+	_, _ = cache.LookupHost(ctx, "host0.example")
+	_, _ = cache.LookupHost(ctx, fmt.Sprintf("host%d.example", dnsCacheSize))
+	if resolver.lookups["host0.example"] != 2 {
+		t.Error("the oldest host was not evicted")
+	}
+	if resolver.lookups[fmt.Sprintf("host%d.example", dnsCacheSize)] != 1 {
+		t.Error("the newest host was evicted")
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DomainConfig gathers the fetch settings for the pages on some hosts.
+// Entries are tried in order and only the first matching one applies, with
+// settings it leaves unset falling back to the global ones. A feed
+// preference matching the post still takes precedence over it.
+type DomainConfig struct {
+	// Match is a domain, also matching its subdomains, a glob such as
+	// "*.blogspot.com", or a regular expression between slashes such as
+	// "/^news[0-9]*\\.example\\.com$/".
+	Match     string            `json:"match"`
+	UserAgent string            `json:"userAgent"`
+	Headers   map[string]string `json:"headers"`
+	Cookies   map[string]string `json:"cookies"`
+	// Interval spaces out requests to each matching host, instead of
+	// fetch.hostInterval.
+	Interval   string `json:"interval"`
+	MaxPerHost int    `json:"maxPerHost"`
+	// Proxy replaces fetch.proxy, or is "direct" to not use one.
+	Proxy              string `json:"proxy"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	Http1Only          bool   `json:"http1Only"`
+	Ipv4Only           bool   `json:"ipv4Only"`
+	// Enrichers are run on the matching pages after the global ones, e.g.
+	// a site-specific extractor registered as an enricher.
+	Enrichers []string `json:"enrichers"`
+}
+
+const directProxy = "direct"
+
+type domainRule struct {
+	config  DomainConfig
+	pattern *regexp.Regexp
+	proxy   *url.URL
+}
+
+// domainRules are the compiled domains config.
+type domainRules []domainRule
+
+// compileDomains skips the entries that can't be used, returning what is
+// wrong with them.
+func compileDomains(configs []DomainConfig) (domainRules, []error) {
+	rules := make(domainRules, 0, len(configs))
+	problems := make([]error, 0)
+
+	for i, config := range configs {
+		rule := domainRule{config: config}
+		match := config.Match
+
+		switch {
+		case match == "":
+			problems = append(problems, fmt.Errorf("domains[%d].match is required", i))
+			continue
+		case len(match) > 2 && strings.HasPrefix(match, "/") && strings.HasSuffix(match, "/"):
+			pattern, err := regexp.Compile("(?i)" + match[1:len(match)-1])
+			if err != nil {
+				problems = append(problems, fmt.Errorf("domains[%d].match: %s", i, err.Error()))
+				continue
+			}
+			rule.pattern = pattern
+		default:
+			if _, err := path.Match(match, ""); err != nil {
+				problems = append(problems, fmt.Errorf("domains[%d].match: %q is not a valid glob", i, match))
+				continue
+			}
+		}
+
+		if config.Proxy != "" && config.Proxy != directProxy {
+			proxyUrl, err := url.Parse(config.Proxy)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("domains[%d].proxy: %s", i, err.Error()))
+				continue
+			}
+			rule.proxy = proxyUrl
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, problems
+}
+
+func (r domainRule) matches(host string) bool {
+	host = strings.ToLower(host)
+
+	if r.pattern != nil {
+		return r.pattern.MatchString(host)
+	}
+
+	match := strings.ToLower(r.config.Match)
+	if !strings.ContainsAny(match, "*?[") {
+		return hostMatches(host, []string{match})
+	}
+
+	matched, _ := path.Match(match, host)
+
+	return matched
+}
+
+// match returns the index of the first rule matching host.
+func (r domainRules) match(host string) (int, bool) {
+	if host == "" {
+		return 0, false
+	}
+
+	for i, rule := range r {
+		if rule.matches(host) {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// forHost is the config of the first rule matching host, or an empty one.
+func (r domainRules) forHost(host string) DomainConfig {
+	i, ok := r.match(host)
+	if !ok {
+		return DomainConfig{}
+	}
+
+	return r[i].config
+}
+
+func (r domainRules) insecure(host string) bool {
+	return r.forHost(host).InsecureSkipVerify
+}
+
+func (r domainRules) http1Only(host string) bool {
+	return r.forHost(host).Http1Only
+}
+
+// anySet reports whether a rule has a setting, e.g. so the http/1.1 transport
+// is only set up when some domain needs it.
+func (r domainRules) anySet(set func(config DomainConfig) bool) bool {
+	for _, rule := range r {
+		if set(rule.config) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// proxy wraps the global proxy func with the per domain ones.
+func (r domainRules) proxy(fallback func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if i, ok := r.match(req.URL.Hostname()); ok {
+			switch {
+			case r[i].proxy != nil:
+				return r[i].proxy, nil
+			case r[i].config.Proxy == directProxy:
+				return nil, nil
+			}
+		}
+
+		if fallback == nil {
+			return nil, nil
+		}
+
+		return fallback(req)
+	}
+}
+
+// WithDomains applies the settings of the domain matching each request.
+func WithDomains(rules domainRules) Option {
+	return func(f *httpFetcher) {
+		f.domains = rules
+	}
+}
+
+// domainRateLimiter spaces out the requests to hosts with a domain interval
+// with a limiter of their own, and the rest with the fetcher's.
+type domainRateLimiter struct {
+	base     RateLimiter
+	rules    domainRules
+	limiters []RateLimiter
+}
+
+func newDomainRateLimiter(base RateLimiter, rules domainRules) RateLimiter {
+	limiters := make([]RateLimiter, len(rules))
+	custom := false
+
+	for i, rule := range rules {
+		if interval := parseDurationOr(rule.config.Interval, 0); interval > 0 {
+			limiters[i] = NewHostRateLimiter(interval)
+			custom = true
+		}
+	}
+
+	if !custom {
+		return base
+	}
+
+	return &domainRateLimiter{base: base, rules: rules, limiters: limiters}
+}
+
+func (l *domainRateLimiter) limiterFor(host string) RateLimiter {
+	if i, ok := l.rules.match(host); ok && l.limiters[i] != nil {
+		return l.limiters[i]
+	}
+
+	return l.base
+}
+
+func (l *domainRateLimiter) Wait(ctx context.Context, host string) error {
+	return l.limiterFor(host).Wait(ctx, host)
+}
+
+func (l *domainRateLimiter) Backoff(host string, until time.Time) {
+	l.limiterFor(host).Backoff(host, until)
+}
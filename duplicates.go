@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+)
+
+const (
+	// simhashBands split a simhash into 16 bit values. Two hashes that
+	// differ in at most maxDuplicateDistance bits share at least one band,
+	// which is how candidates are looked up.
+	simhashBands         = 4
+	maxDuplicateDistance = 3
+	simhashShingleWords  = 3
+	// minSimhashWords leaves out pages too short to compare reliably
+	minSimhashWords        = 50
+	duplicatesEnricherName = "duplicates"
+)
+
+func init() {
+	registerEnricher(duplicatesEnricherName, func(config AppConfig) (Enricher, error) {
+		return duplicatesEnricher{}, nil
+	})
+}
+
+// duplicatesEnricher fingerprints the article text so the store can flag
+// posts that repeat one seen before, such as syndicated articles.
+type duplicatesEnricher struct{}
+
+func (duplicatesEnricher) Name() string {
+	return duplicatesEnricherName
+}
+
+func (duplicatesEnricher) Enrich(ctx context.Context, scraped *PostScraped) error {
+	scraped.OpenGraphTags.Simhash = simhash(scraped.OpenGraphTags.articleText())
+
+	return nil
+}
+
+// simhash hashes the three word shingles of text into a 64 bit fingerprint
+// in which similar texts differ in few bits. It's 0 for short texts.
+func simhash(text string) uint64 {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) < minSimhashWords {
+		return 0
+	}
+
+	var weights [64]int
+	for i := 0; i+simhashShingleWords <= len(words); i++ {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(strings.Join(words[i:i+simhashShingleWords], " ")))
+		sum := h.Sum64()
+
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << uint(bit)
+		}
+	}
+
+	return fingerprint
+}
+
+func simhashBand(fingerprint uint64, band int) int {
+	return int(fingerprint >> uint(band*16) & 0xffff)
+}
+
+func isDuplicate(a uint64, b uint64) bool {
+	return bits.OnesCount64(a^b) <= maxDuplicateDistance
+}
+
+// duplicateCandidate is a post sharing a simhash band with the one being
+// saved.
+type duplicateCandidate struct {
+	postID      int64
+	simhash     uint64
+	duplicateOf int64
+}
+
+// canonicalPost returns the earliest post the post duplicates, following
+// candidates that are duplicates themselves, or 0.
+func canonicalPost(postID int64, fingerprint uint64, candidates []duplicateCandidate) int64 {
+	var canonical int64
+
+	for _, candidate := range candidates {
+		if candidate.postID == postID || !isDuplicate(fingerprint, candidate.simhash) {
+			continue
+		}
+
+		original := candidate.postID
+		if candidate.duplicateOf != 0 {
+			original = candidate.duplicateOf
+		}
+
+		if original < postID && (canonical == 0 || original < canonical) {
+			canonical = original
+		}
+	}
+
+	return canonical
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// Enricher adds to the metadata of a parsed page before it's saved, e.g. by
+// tagging or classifying it. Enrich is called from several parse workers at
+// once.
+type Enricher interface {
+	Name() string
+	Enrich(ctx context.Context, scraped *PostScraped) error
+}
+
+// enricherFactories are the enrichers that can be named in the enrichers
+// config. Custom enrichers register themselves from an init func in their
+// own file.
+var enricherFactories = map[string]func(config AppConfig) (Enricher, error){}
+
+func registerEnricher(name string, factory func(config AppConfig) (Enricher, error)) {
+	enricherFactories[name] = factory
+}
+
+// cycleEnricher is implemented by enrichers that budget their work per
+// cycle.
+type cycleEnricher interface {
+	startCycle()
+}
+
+type enricherChain struct {
+	mu        sync.RWMutex
+	enrichers []Enricher
+	// domainEnrichers are run after the others on the pages of the domain
+	// rule with the same index
+	domains         domainRules
+	domainEnrichers [][]Enricher
+}
+
+// enrichment is configured by applyConfig.
+var enrichment = &enricherChain{}
+
+// configure builds the chain in the order the enrichers are named, skipping
+// any that are unknown or fail to start.
+func (c *enricherChain) configure(config AppConfig) {
+	enrichers := newEnrichers(config, config.Enrichers)
+
+	domains, _ := compileDomains(config.Domains)
+	domainEnrichers := make([][]Enricher, len(domains))
+	for i, rule := range domains {
+		domainEnrichers[i] = newEnrichers(config, rule.config.Enrichers)
+	}
+
+	c.mu.Lock()
+	c.enrichers = enrichers
+	c.domains = domains
+	c.domainEnrichers = domainEnrichers
+	c.mu.Unlock()
+}
+
+func newEnrichers(config AppConfig, names []string) []Enricher {
+	enrichers := make([]Enricher, 0, len(names))
+
+	for _, name := range names {
+		factory, ok := enricherFactories[name]
+		if !ok {
+			fmt.Println("unknown enricher", name)
+			continue
+		}
+
+		enricher, err := factory(config)
+		if err != nil {
+			fmt.Println("could not configure enricher", name, err.Error())
+			continue
+		}
+
+		enrichers = append(enrichers, enricher)
+	}
+
+	return enrichers
+}
+
+// run passes the page through each enricher in turn. An enricher that fails
+// is reported and the rest of the chain still runs.
+func (c *enricherChain) run(ctx context.Context, scraped *PostScraped) {
+	c.mu.RLock()
+	enrichers := c.enrichers
+	if u, err := url.Parse(scraped.Post.Url); err == nil {
+		if i, ok := c.domains.match(u.Hostname()); ok && len(c.domainEnrichers[i]) > 0 {
+			enrichers = append(append([]Enricher{}, enrichers...), c.domainEnrichers[i]...)
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, enricher := range enrichers {
+		err := enricher.Enrich(ctx, scraped)
+		if err != nil {
+			fmt.Println("enricher", enricher.Name(), "failed for", scraped.Post.Url, err.Error())
+			reportError("enrich", scraped.Post, err)
+			scraped.note("enricher %s failed: %s", enricher.Name(), err.Error())
+		}
+	}
+}
+
+// startCycle resets the per-cycle budgets of the enrichers.
+func (c *enricherChain) startCycle() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, enricher := range c.enrichers {
+		if e, ok := enricher.(cycleEnricher); ok {
+			e.startCycle()
+		}
+	}
+
+	for _, enrichers := range c.domainEnrichers {
+		for _, enricher := range enrichers {
+			if e, ok := enricher.(cycleEnricher); ok {
+				e.startCycle()
+			}
+		}
+	}
+}
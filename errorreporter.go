@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type SentryConfig struct {
+	Dsn         string `json:"dsn"`
+	Environment string `json:"environment"`
+}
+
+// ErrorContext describes where an error happened so it can be found again in
+// the error tracker, rather than just the message that went to stdout.
+type ErrorContext struct {
+	Phase  string
+	Tenant string
+	PostID int64
+	Url    string
+}
+
+type ErrorReporter interface {
+	Report(err error, errCtx ErrorContext)
+}
+
+type nopErrorReporter struct{}
+
+func (nopErrorReporter) Report(err error, errCtx ErrorContext) {}
+
+// errorReporter is replaced by applyConfig on every load and reload of the
+// config, with a sentry reporter when a dsn is configured.
+var errorReporter ErrorReporter = nopErrorReporter{}
+
+func newErrorReporter(config SentryConfig) (ErrorReporter, error) {
+	if config.Dsn == "" {
+		return nopErrorReporter{}, nil
+	}
+
+	return newSentryReporter(config)
+}
+
+func reportError(phase string, post Post, err error) {
+	errorReporter.Report(err, ErrorContext{
+		Phase:  phase,
+		Tenant: currentTenant,
+		PostID: post.PostID,
+		Url:    post.Url,
+	})
+}
+
+func reportPanic(phase string, r interface{}) {
+	errorReporter.Report(panicError(r), ErrorContext{Phase: phase, Tenant: currentTenant})
+}
+
+// reportPostPanic reports a panic recovered while working on a single post.
+func reportPostPanic(phase string, post Post, r interface{}) {
+	reportError(phase, post, panicError(r))
+}
+
+func panicError(r interface{}) error {
+	err, ok := r.(error)
+	if !ok {
+		err = fmt.Errorf("%v", r)
+	}
+
+	return err
+}
+
+// reportPhaseError reports an error that isn't about a single post.
+func reportPhaseError(phase string, err error) {
+	errorReporter.Report(err, ErrorContext{Phase: phase, Tenant: currentTenant})
+}
+
+type sentryReporter struct {
+	storeUrl    string
+	authHeader  string
+	environment string
+	httpClient  *http.Client
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	Environment string            `json:"environment,omitempty"`
+	Message     string            `json:"message"`
+	Tags        map[string]string `json:"tags"`
+	Extra       map[string]string `json:"extra"`
+}
+
+// newSentryReporter parses a dsn of the form https://<key>@<host>/<project>
+// and posts events to the project's store endpoint.
+func newSentryReporter(config SentryConfig) (*sentryReporter, error) {
+	dsn, err := url.Parse(config.Dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if dsn.User == nil || dsn.User.Username() == "" {
+		return nil, errors.New("sentry dsn is missing a public key")
+	}
+
+	projectID := strings.Trim(dsn.Path, "/")
+	if projectID == "" {
+		return nil, errors.New("sentry dsn is missing a project id")
+	}
+
+	storeUrl := fmt.Sprintf("%s://%s/api/%s/store/", dsn.Scheme, dsn.Host, projectID)
+	authHeader := fmt.Sprintf(
+		"Sentry sentry_version=7, sentry_client=abt-og-parser/1.0, sentry_key=%s", dsn.User.Username(),
+	)
+
+	return &sentryReporter{
+		storeUrl:    storeUrl,
+		authHeader:  authHeader,
+		environment: config.Environment,
+		httpClient:  &http.Client{},
+	}, nil
+}
+
+func (s *sentryReporter) Report(err error, errCtx ErrorContext) {
+	if err == nil {
+		return
+	}
+
+	event := sentryEvent{
+		EventID:     newEventID(),
+		Timestamp:   clock.Now().UTC().Format(time.RFC3339),
+		Level:       "error",
+		Platform:    "go",
+		Logger:      "abt-og-parser",
+		Environment: s.environment,
+		Message:     err.Error(),
+		Tags:        map[string]string{"phase": errCtx.Phase},
+		Extra:       map[string]string{},
+	}
+
+	if errCtx.Tenant != "" {
+		event.Tags["tenant"] = errCtx.Tenant
+	}
+
+	if errCtx.PostID != 0 {
+		event.Extra["post_id"] = fmt.Sprint(errCtx.PostID)
+	}
+
+	if errCtx.Url != "" {
+		event.Extra["url"] = errCtx.Url
+		if u, err := url.Parse(errCtx.Url); err == nil {
+			event.Tags["domain"] = u.Hostname()
+		}
+	}
+
+	postBody, err := json.Marshal(event)
+	if err != nil {
+		fmt.Println("could not encode sentry event", err.Error())
+		return
+	}
+
+	req, err := http.NewRequest("POST", s.storeUrl, bytes.NewBuffer(postBody))
+	if err != nil {
+		fmt.Println("could not create sentry request", err.Error())
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.authHeader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	resp, err := s.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		fmt.Println("could not send event to sentry", err.Error())
+		return
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		fmt.Println("sentry rejected event with status", resp.StatusCode)
+	}
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportedPost is a post's metadata as written by the export command.
+type ExportedPost struct {
+	ID            int64        `json:"id"`
+	Url           string       `json:"url"`
+	Title         string       `json:"title,omitempty"`
+	Description   string       `json:"description,omitempty"`
+	FeaturedImage string       `json:"featured_image,omitempty"`
+	Language      string       `json:"language,omitempty"`
+	Modified      string       `json:"modified,omitempty"`
+	Metadata      PostMetadata `json:"metadata"`
+}
+
+var exportCsvHeader = []string{"id", "url", "title", "description", "featured_image", "language", "modified"}
+
+// runExport writes the stored metadata of posts as json lines, a json array
+// or csv: ogparser export [-ids 1,2,3] [-since 24h] [-reparse] [-format jsonl|json|csv] [-out file]
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	ids := flags.String("ids", "", "comma separated ids of the posts to export")
+	since := flags.String("since", "", "only export posts saved since a date (2006-01-02) or for a duration (72h)")
+	reparse := flags.Bool("reparse", false, "extract the metadata again from the stored html")
+	format := flags.String("format", "jsonl", "jsonl, json or csv")
+	out := flags.String("out", "", "file to write to instead of stdout")
+	batchSize := flags.Int("batch", 500, "how many posts to load at once")
+	tenantName := flags.String("tenant", primaryTenantName, "which tenant's posts to export")
+	_ = flags.Parse(args)
+
+	query := StoredPostsQuery{WithContent: *reparse, Limit: *batchSize}
+
+	for _, id := range strings.Split(*ids, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+
+		postID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			kill("parsing post id", err)
+		}
+		query.IDs = append(query.IDs, postID)
+	}
+
+	if *since != "" {
+		var err error
+		query.ModifiedSince, err = parseSince(*since)
+		if err != nil {
+			kill("parsing -since", err)
+		}
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		kill("loading config file", err)
+	}
+
+	if *reparse {
+		err = config.StoredHtml.reparsable()
+		if err != nil {
+			kill("reparsing stored html", err)
+		}
+	}
+
+	applyConfig(config)
+
+	tenantConfig, ok := findTenantConfig(config, *tenantName)
+	if !ok {
+		kill("finding tenant", fmt.Errorf("no tenant named %s", *tenantName))
+	}
+
+	config = config.forTenant(tenantConfig)
+
+	store, err := newSqlStore(config.Db)
+	if err != nil {
+		kill("opening db connection", err)
+	}
+
+	defer func() {
+		_ = store.Close()
+	}()
+
+	// the export's own messages go to stderr, out of the way of the posts
+	logs := io.Writer(os.Stderr)
+	w := io.Writer(os.Stdout)
+
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			kill("creating output file", err)
+		}
+
+		defer func() {
+			_ = file.Close()
+		}()
+
+		w = file
+	}
+
+	buffered := bufio.NewWriter(w)
+	writer, err := newExportWriter(buffered, *format)
+	if err != nil {
+		kill("exporting posts", err)
+	}
+
+	exported := 0
+	for {
+		posts, err := store.StoredPosts(context.Background(), query)
+		if err != nil {
+			kill("loading posts", err)
+		}
+
+		if len(posts) == 0 {
+			break
+		}
+
+		for _, stored := range posts {
+			post := exportStoredPost(stored)
+			if *reparse {
+				post = exportScrapedPost(reparseStoredPost(config, stored), stored)
+			}
+
+			err = writer.write(post)
+			if err != nil {
+				kill("writing posts", err)
+			}
+			exported++
+		}
+
+		query.AfterID = posts[len(posts)-1].Post.PostID
+	}
+
+	err = writer.close()
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		kill("writing posts", err)
+	}
+
+	fmt.Fprintln(logs, "Exported", exported, "posts")
+}
+
+// parseSince reads a date, a timestamp or a duration back from now.
+func parseSince(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return clock.Now().Add(-d), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.Parse("2006-01-02", value)
+}
+
+func exportStoredPost(stored StoredPost) ExportedPost {
+	post := ExportedPost{
+		ID:            stored.Post.PostID,
+		Url:           stored.Post.Url,
+		Title:         stored.Title,
+		Description:   stored.Description,
+		FeaturedImage: stored.FeaturedImage,
+		Language:      stored.Language,
+		Metadata:      stored.Metadata,
+	}
+
+	if !stored.Modified.IsZero() {
+		post.Modified = stored.Modified.Format(time.RFC3339)
+	}
+
+	return post
+}
+
+func exportScrapedPost(scraped PostScraped, stored StoredPost) ExportedPost {
+	tags := scraped.OpenGraphTags
+
+	post := exportStoredPost(stored)
+	post.Title = tags.Title
+	post.Description = scraped.description()
+	post.FeaturedImage = tags.FeaturedImage
+	post.Language = tags.Language
+	post.Metadata = tags.postMetadata()
+
+	return post
+}
+
+type exportWriter struct {
+	format string
+	w      io.Writer
+	csv    *csv.Writer
+	count  int
+}
+
+func newExportWriter(w io.Writer, format string) (*exportWriter, error) {
+	writer := &exportWriter{format: format, w: w}
+
+	switch format {
+	case "jsonl":
+	case "json":
+		_, err := io.WriteString(w, "[\n")
+		return writer, err
+	case "csv":
+		writer.csv = csv.NewWriter(w)
+		return writer, writer.csv.Write(exportCsvHeader)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	return writer, nil
+}
+
+func (e *exportWriter) write(post ExportedPost) error {
+	defer func() {
+		e.count++
+	}()
+
+	if e.csv != nil {
+		return e.csv.Write([]string{
+			strconv.FormatInt(post.ID, 10),
+			post.Url,
+			post.Title,
+			post.Description,
+			post.FeaturedImage,
+			post.Language,
+			post.Modified,
+		})
+	}
+
+	line, err := json.Marshal(post)
+	if err != nil {
+		return err
+	}
+
+	if e.format == "json" && e.count > 0 {
+		_, err = io.WriteString(e.w, ",\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = e.w.Write(line)
+	if err == nil && e.format == "jsonl" {
+		_, err = io.WriteString(e.w, "\n")
+	}
+
+	return err
+}
+
+func (e *exportWriter) close() error {
+	switch e.format {
+	case "json":
+		_, err := io.WriteString(e.w, "\n]\n")
+		return err
+	case "csv":
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// permanentStatusCodes won't change however often the page is retried.
+var permanentStatusCodes = map[int]bool{
+	http.StatusNotFound:                   true,
+	http.StatusGone:                       true,
+	http.StatusUnavailableForLegalReasons: true,
+}
+
+// parkedDomainTitles match the titles of domains that have lapsed and been
+// parked, which won't host the post again.
+var parkedDomainTitles = regexp.MustCompile(
+	`(?i)(domain (is )?for sale|buy this domain|parked (free|domain)|this domain (may be|is) for sale)`,
+)
+
+// permanentFailureReason returns why a post's page can never be scraped, or
+// an empty string if the failure (if any) may be transient. It is checked
+// after the fallbacks have had their go.
+func permanentFailureReason(scraped PostScraped) string {
+	if scraped.Html == "" && permanentStatusCodes[scraped.StatusCode] {
+		return fmt.Sprintf("status %d %s", scraped.StatusCode, http.StatusText(scraped.StatusCode))
+	}
+
+	if scraped.Html != "" && parkedDomainTitles.MatchString(scraped.OpenGraphTags.Title) {
+		return "parked domain: " + scraped.OpenGraphTags.Title
+	}
+
+	return ""
+}
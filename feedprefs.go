@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// FeedPreference changes how the posts of some feeds, or on some domains,
+// are scraped. Settings left unset fall back to the global config.
+type FeedPreference struct {
+	FeedIDs []int64  `json:"feedIds"`
+	Domains []string `json:"domains"`
+	// Scrape set to false never fetches the posts, e.g. for feeds whose
+	// owners provide full content and don't want to be crawled.
+	Scrape          *bool  `json:"scrape"`
+	AmpFallback     *bool  `json:"ampFallback"`
+	WaybackFallback *bool  `json:"waybackFallback"`
+	UserAgent       string `json:"userAgent"`
+	// Interval spaces out fetches of all the matching posts.
+	Interval string `json:"interval"`
+}
+
+// feedPreference returns the first preference matching the post, and
+// whether there was one.
+func feedPreference(preferences []FeedPreference, post Post) (int, bool) {
+	host := ""
+	if u, err := url.Parse(post.Url); err == nil {
+		host = u.Hostname()
+	}
+
+	for i, preference := range preferences {
+		if post.FeedID != 0 {
+			for _, feedID := range preference.FeedIDs {
+				if feedID == post.FeedID {
+					return i, true
+				}
+			}
+		}
+
+		if host != "" && hostMatches(host, preference.Domains) {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// preferenceFor is the preference applying to a post, or an empty one.
+func (c AppConfig) preferenceFor(post Post) FeedPreference {
+	i, ok := feedPreference(c.FeedPreferences, post)
+	if !ok {
+		return FeedPreference{}
+	}
+
+	return c.FeedPreferences[i]
+}
+
+func (p FeedPreference) ampFallback(fallback bool) bool {
+	if p.AmpFallback != nil {
+		return *p.AmpFallback
+	}
+
+	return fallback
+}
+
+func (p FeedPreference) waybackFallback(fallback bool) bool {
+	if p.WaybackFallback != nil {
+		return *p.WaybackFallback
+	}
+
+	return fallback
+}
+
+// scrapablePosts leaves out the posts of feeds that opted out of scraping.
+func scrapablePosts(preferences []FeedPreference, posts []Post) []Post {
+	if len(preferences) == 0 {
+		return posts
+	}
+
+	kept := make([]Post, 0, len(posts))
+	for _, post := range posts {
+		i, ok := feedPreference(preferences, post)
+		if ok && preferences[i].Scrape != nil && !*preferences[i].Scrape {
+			fmt.Println("not scraping", post.Url, "as its feed opted out")
+			continue
+		}
+
+		kept = append(kept, post)
+	}
+
+	return kept
+}
+
+// WithFeedPreferences applies the user agent and interval of the preference
+// matching each post fetched.
+func WithFeedPreferences(preferences []FeedPreference) Option {
+	return func(f *httpFetcher) {
+		f.preferences = preferences
+		f.preferenceLimiters = make([]RateLimiter, len(preferences))
+
+		for i, preference := range preferences {
+			if interval := parseDurationOr(preference.Interval, 0); interval > 0 {
+				f.preferenceLimiters[i] = NewHostRateLimiter(interval)
+			}
+		}
+	}
+}
+
+// waitForPreference returns the user agent the post's preference sets, if
+// any, once the preference allows another fetch.
+func (f *httpFetcher) waitForPreference(post Post) (string, error) {
+	i, ok := feedPreference(f.preferences, post)
+	if !ok {
+		return "", nil
+	}
+
+	// the matching posts share one slot whichever host they are on
+	if limiter := f.preferenceLimiters[i]; limiter != nil {
+		err := limiter.Wait(context.Background(), "")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return f.preferences[i].UserAgent, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+type FeedDiscoveryConfig struct {
+	Enabled bool   `json:"enabled"`
+	Webhook string `json:"webhook"`
+}
+
+type discoveredFeedEvent struct {
+	PostID  int64    `json:"post_id"`
+	PageUrl string   `json:"page_url"`
+	Feeds   []string `json:"feeds"`
+}
+
+func isFeedLink(rel string, linkType string) bool {
+	return rel == "alternate" && feedTypes[strings.ToLower(strings.TrimSpace(linkType))]
+}
+
+// resolveFeeds turns the feed links found on a page into absolute urls.
+func resolveFeeds(pageUrl string, feeds []string) []string {
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return nil
+	}
+
+	resolved := make([]string, 0, len(feeds))
+	seen := make(map[string]bool)
+	for _, feed := range feeds {
+		feedUrl, err := base.Parse(feed)
+		if err != nil || seen[feedUrl.String()] {
+			continue
+		}
+
+		seen[feedUrl.String()] = true
+		resolved = append(resolved, feedUrl.String())
+	}
+
+	return resolved
+}
+
+// reportDiscoveredFeeds records feeds found on a post's page, and sends any
+// that had not been seen before to the webhook.
+func reportDiscoveredFeeds(ctx context.Context, store Store, config FeedDiscoveryConfig, scraped PostScraped) {
+	feeds := scraped.OpenGraphTags.Feeds
+	if len(feeds) == 0 {
+		return
+	}
+
+	newFeeds, err := store.SaveDiscoveredFeeds(ctx, scraped.Post, feeds)
+	if err != nil {
+		fmt.Println("could not record discovered feeds", scraped.Post.Url, err.Error())
+		reportError("db", scraped.Post, err)
+		return
+	}
+
+	if len(newFeeds) == 0 || config.Webhook == "" {
+		return
+	}
+
+	fmt.Println("discovered", len(newFeeds), "new feeds on", scraped.Post.Url)
+
+	postBody, err := json.Marshal(discoveredFeedEvent{
+		PostID:  scraped.Post.PostID,
+		PageUrl: scraped.Post.Url,
+		Feeds:   newFeeds,
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	req, err := http.NewRequest("POST", config.Webhook, bytes.NewBuffer(postBody))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		fmt.Println("could not send discovered feeds to webhook", err.Error())
+		reportError("feeds", scraped.Post, err)
+		return
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		fmt.Println("feed discovery webhook returned status", resp.StatusCode)
+	}
+}
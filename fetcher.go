@@ -0,0 +1,779 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFetchTimeout = 10 * time.Second
+	defaultUserAgent    = "@bateszi OG parser"
+	// defaultMaxBodySize bounds the memory a single page can take up, as
+	// every worker of the pipeline's stages can be holding one.
+	defaultMaxBodySize = 8 << 20
+	// defaultMaxRetryAfter is the longest Retry-After that is waited for.
+	defaultMaxRetryAfter = 2 * time.Minute
+	// defaultMaxPerHost is how many requests one host gets at once, however
+	// many fetch workers there are.
+	defaultMaxPerHost = 2
+)
+
+type FetchConfig struct {
+	// Timeout bounds a whole request, including reading the body. The other
+	// timeouts bound its phases.
+	Timeout        string `json:"timeout"`
+	ConnectTimeout string `json:"connectTimeout"`
+	TlsTimeout     string `json:"tlsTimeout"`
+	HeaderTimeout  string `json:"headerTimeout"`
+	ImageTimeout   string `json:"imageTimeout"`
+	// DnsCacheTtl is how long resolved addresses are reused at most, "0" to
+	// resolve every time.
+	DnsCacheTtl string    `json:"dnsCacheTtl"`
+	Dns         DnsConfig `json:"dns"`
+	// PreferIpv4 dials IPv4 addresses first, racing IPv6 only after
+	// FallbackDelay. Ipv4OnlyHosts are never dialled over IPv6.
+	PreferIpv4    bool      `json:"preferIpv4"`
+	Ipv4OnlyHosts []string  `json:"ipv4OnlyHosts"`
+	FallbackDelay string    `json:"fallbackDelay"`
+	Tls           TlsConfig `json:"tls"`
+
+	UserAgent    string `json:"userAgent"`
+	MaxBodyBytes int64  `json:"maxBodyBytes"`
+	Proxy        string `json:"proxy"`
+	Retries      int    `json:"retries"`
+	RetryBackoff string `json:"retryBackoff"`
+	HostInterval string `json:"hostInterval"`
+	// MaxRetryAfter caps how long a host asking to be retried later holds
+	// back its pages.
+	MaxRetryAfter string `json:"maxRetryAfter"`
+	// BreakerFailures is how many fetches from a host can fail in a row
+	// before its pages are skipped for BreakerCooldown, -1 to never skip.
+	BreakerFailures int    `json:"breakerFailures"`
+	BreakerCooldown string `json:"breakerCooldown"`
+	// MaxPerHost caps concurrent requests to one host, -1 for no cap.
+	MaxPerHost int `json:"maxPerHost"`
+	// MaxBytesPerSecond caps the download rate of all fetches together.
+	MaxBytesPerSecond int64 `json:"maxBytesPerSecond"`
+	// Http1Only never uses http/2, Http1Hosts only for these hosts and their
+	// subdomains.
+	Http1Only  bool     `json:"http1Only"`
+	Http1Hosts []string `json:"http1Hosts"`
+	// Cassette records or replays every fetch, for tests and development
+	Cassette CassetteConfig `json:"cassette"`
+}
+
+// RetryPolicy controls how often a failed fetch is retried. Only network
+// errors and 5xx/429 responses are retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// TransportTimeouts bound the phases of a request. Zero leaves a phase bounded
+// only by the overall timeout.
+type TransportTimeouts struct {
+	Connect        time.Duration
+	TLSHandshake   time.Duration
+	ResponseHeader time.Duration
+}
+
+// RateLimiter is asked before every request to a host.
+type RateLimiter interface {
+	Wait(ctx context.Context, host string) error
+	// Backoff holds back requests to host until the given time, e.g. when it
+	// answered with a Retry-After.
+	Backoff(host string, until time.Time)
+}
+
+// Fetcher fetches the html of pages, and probes images, for the posts being
+// scraped. Implementations are safe for concurrent use.
+type Fetcher interface {
+	// Fetch fetches a page on behalf of a post, returning an empty string if
+	// the page could not be fetched along with the status code or error.
+	Fetch(post Post, pageUrl string) (string, int, error)
+	// FetchPage is Fetch, also returning the response headers.
+	FetchPage(post Post, pageUrl string) FetchedPage
+	// ProbeImage learns the format and size of an image.
+	ProbeImage(imageUrl string) (imageInfo, error)
+	// Close is called once a cycle is done fetching.
+	Close() error
+}
+
+// httpFetcher fetches pages over http.
+type httpFetcher struct {
+	client      *http.Client
+	transport   *http.Transport
+	dialer      *net.Dialer
+	dnsCache    *dnsCache
+	resolver    hostResolver
+	families    AddressFamilyOptions
+	timeout     time.Duration
+	userAgent   string
+	maxBodySize int64
+	retryPolicy RetryPolicy
+	rateLimiter RateLimiter
+	// maxRetryAfter caps the Retry-After of 429 and 503 responses
+	maxRetryAfter time.Duration
+	// breaker skips the pages of hosts that keep failing
+	breaker *circuitBreaker
+	// proxy is set on the transport once every option has been applied
+	proxy        *url.URL
+	imageTimeout time.Duration
+	// preferences override the user agent and space out fetches for some
+	// feeds, each with its own limiter
+	preferences        []FeedPreference
+	preferenceLimiters []RateLimiter
+	// hostSlots hold a token for each request in flight to a host
+	maxPerHost  int
+	hostSlotsMu sync.Mutex
+	hostSlots   map[string]chan struct{}
+	// http/2 is used where servers offer it, except for these
+	http1Only  bool
+	http1Hosts []string
+	// insecureHosts' certificates aren't verified
+	insecureHosts []string
+	bandwidth     *bandwidthLimiter
+	// domains override the settings above for the hosts they match
+	domains           domainRules
+	transportWrappers []func(http.RoundTripper) http.RoundTripper
+}
+
+type Option func(*httpFetcher)
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(f *httpFetcher) {
+		f.timeout = timeout
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(f *httpFetcher) {
+		f.userAgent = userAgent
+	}
+}
+
+// WithMaxBodySize truncates response bodies to at most n bytes, or leaves them
+// unbounded if n is negative.
+func WithMaxBodySize(n int64) Option {
+	return func(f *httpFetcher) {
+		f.maxBodySize = n
+	}
+}
+
+// WithProxy sends requests through proxyUrl, except for domains with a proxy
+// of their own.
+func WithProxy(proxyUrl *url.URL) Option {
+	return func(f *httpFetcher) {
+		f.proxy = proxyUrl
+	}
+}
+
+func WithTransportTimeouts(timeouts TransportTimeouts) Option {
+	return func(f *httpFetcher) {
+		if timeouts.Connect > 0 {
+			f.dialer.Timeout = timeouts.Connect
+		}
+
+		if timeouts.TLSHandshake > 0 {
+			f.transport.TLSHandshakeTimeout = timeouts.TLSHandshake
+		}
+
+		f.transport.ResponseHeaderTimeout = timeouts.ResponseHeader
+	}
+}
+
+// WithDnsCache resolves hosts through cache instead of on every dial.
+func WithDnsCache(cache *dnsCache) Option {
+	return func(f *httpFetcher) {
+		f.dnsCache = cache
+	}
+}
+
+func WithAddressFamilies(families AddressFamilyOptions) Option {
+	return func(f *httpFetcher) {
+		f.families = families
+	}
+}
+
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(f *httpFetcher) {
+		f.transport.TLSClientConfig = tlsConfig
+	}
+}
+
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(f *httpFetcher) {
+		f.retryPolicy = policy
+	}
+}
+
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(f *httpFetcher) {
+		f.rateLimiter = limiter
+	}
+}
+
+func WithMaxRetryAfter(d time.Duration) Option {
+	return func(f *httpFetcher) {
+		f.maxRetryAfter = d
+	}
+}
+
+func WithImageTimeout(timeout time.Duration) Option {
+	return func(f *httpFetcher) {
+		f.imageTimeout = timeout
+	}
+}
+
+// WithMaxPerHost caps concurrent requests to one host, or lifts the cap if n
+// is negative.
+func WithMaxPerHost(n int) Option {
+	return func(f *httpFetcher) {
+		f.maxPerHost = n
+	}
+}
+
+// WithTransport wraps the fetcher's http transport, e.g. for a test double.
+// Wrappers are applied in order, each around the previous one.
+func WithTransport(wrap func(base http.RoundTripper) http.RoundTripper) Option {
+	return func(f *httpFetcher) {
+		f.transportWrappers = append(f.transportWrappers, wrap)
+	}
+}
+
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(f *httpFetcher) {
+		f.client.Jar = jar
+	}
+}
+
+func NewFetcher(opts ...Option) Fetcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	f := &httpFetcher{
+		client:    &http.Client{Transport: transport},
+		transport: transport,
+		dialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+		resolver:    net.DefaultResolver,
+		timeout:     defaultFetchTimeout,
+		userAgent:   defaultUserAgent,
+		maxBodySize: defaultMaxBodySize,
+		retryPolicy: RetryPolicy{MaxAttempts: 1},
+		// without a host interval this only applies Retry-After backoffs
+		rateLimiter:   NewHostRateLimiter(0),
+		maxRetryAfter: defaultMaxRetryAfter,
+		imageTimeout:  defaultImageTimeout,
+		maxPerHost:    defaultMaxPerHost,
+		hostSlots:     make(map[string]chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	transport.DialContext = f.dialContext
+
+	if f.proxy != nil {
+		transport.Proxy = http.ProxyURL(f.proxy)
+	}
+
+	if len(f.domains) > 0 {
+		transport.Proxy = f.domains.proxy(transport.Proxy)
+		f.rateLimiter = newDomainRateLimiter(f.rateLimiter, f.domains)
+	}
+
+	var roundTripper http.RoundTripper = f.protocolTransport(transport)
+	if len(f.insecureHosts) > 0 || f.domains.anySet(func(d DomainConfig) bool { return d.InsecureSkipVerify }) {
+		insecure := f.protocolTransport(insecureTransport(transport))
+		roundTripper = &hostTransport{base: roundTripper, match: f.isInsecureHost, transport: insecure}
+	}
+
+	for _, wrap := range f.transportWrappers {
+		roundTripper = wrap(roundTripper)
+	}
+
+	if f.bandwidth != nil {
+		roundTripper = &throttledTransport{base: roundTripper, limiter: f.bandwidth}
+	}
+
+	f.client.Transport = roundTripper
+
+	return f
+}
+
+// newFetcherFromConfig builds the fetcher used for a cycle. Its cookie jar is
+// seeded with the static cookies from the config, and keeps any cookies sites
+// set for the rest of the cycle.
+func newFetcherFromConfig(config AppConfig) Fetcher {
+	opts := make([]Option, 0)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		fmt.Println("could not create cookie jar", err.Error())
+	} else {
+		for domain, cookies := range config.Cookies {
+			seedCookies(jar, domain, cookies)
+		}
+		opts = append(opts, WithCookieJar(jar))
+	}
+
+	fetchConfig := config.Fetch
+
+	if timeout := parseDurationOr(fetchConfig.Timeout, 0); timeout > 0 {
+		opts = append(opts, WithTimeout(timeout))
+	}
+
+	if timeout := parseDurationOr(fetchConfig.ImageTimeout, 0); timeout > 0 {
+		opts = append(opts, WithImageTimeout(timeout))
+	}
+
+	opts = append(opts, WithTransportTimeouts(TransportTimeouts{
+		Connect:        parseDurationOr(fetchConfig.ConnectTimeout, 0),
+		TLSHandshake:   parseDurationOr(fetchConfig.TlsTimeout, 0),
+		ResponseHeader: parseDurationOr(fetchConfig.HeaderTimeout, 0),
+	}))
+
+	if ttl := parseDurationOr(fetchConfig.DnsCacheTtl, defaultDnsCacheTtl); ttl > 0 {
+		opts = append(opts, WithDnsCache(dnsCacheFor(ttl, fetchConfig.Dns)))
+	} else {
+		opts = append(opts, WithResolver(newHostResolver(fetchConfig.Dns)))
+	}
+
+	opts = append(opts, WithAddressFamilies(AddressFamilyOptions{
+		PreferIPv4:    fetchConfig.PreferIpv4,
+		IPv4OnlyHosts: fetchConfig.Ipv4OnlyHosts,
+		FallbackDelay: parseDurationOr(fetchConfig.FallbackDelay, 0),
+	}))
+
+	domains, _ := compileDomains(config.Domains)
+	if len(domains) > 0 {
+		opts = append(opts, WithDomains(domains))
+	}
+
+	tlsConfig, err := newFetchTlsConfig(fetchConfig.Tls)
+	if err != nil {
+		fmt.Println("ignoring invalid tls config", err.Error())
+	} else if tlsConfig != nil {
+		opts = append(opts, WithTLSConfig(tlsConfig))
+	}
+
+	if len(fetchConfig.Tls.InsecureHosts) > 0 {
+		opts = append(opts, WithInsecureHosts(fetchConfig.Tls.InsecureHosts))
+	}
+
+	if fetchConfig.UserAgent != "" {
+		opts = append(opts, WithUserAgent(fetchConfig.UserAgent))
+	}
+
+	if fetchConfig.MaxBodyBytes != 0 {
+		opts = append(opts, WithMaxBodySize(fetchConfig.MaxBodyBytes))
+	}
+
+	if fetchConfig.Proxy != "" {
+		proxyUrl, err := url.Parse(fetchConfig.Proxy)
+		if err != nil {
+			fmt.Println("ignoring invalid proxy", fetchConfig.Proxy, err.Error())
+		} else {
+			opts = append(opts, WithProxy(proxyUrl))
+		}
+	}
+
+	if fetchConfig.Retries > 0 {
+		opts = append(opts, WithRetryPolicy(RetryPolicy{
+			MaxAttempts: fetchConfig.Retries + 1,
+			Backoff:     parseDurationOr(fetchConfig.RetryBackoff, time.Second),
+		}))
+	}
+
+	if interval := parseDurationOr(fetchConfig.HostInterval, 0); interval > 0 {
+		opts = append(opts, WithRateLimiter(NewHostRateLimiter(interval)))
+	}
+
+	if maxRetryAfter := parseDurationOr(fetchConfig.MaxRetryAfter, 0); maxRetryAfter > 0 {
+		opts = append(opts, WithMaxRetryAfter(maxRetryAfter))
+	}
+
+	if fetchConfig.BreakerFailures >= 0 {
+		failures := fetchConfig.BreakerFailures
+		if failures == 0 {
+			failures = defaultBreakerFailures
+		}
+
+		cooldown := parseDurationOr(fetchConfig.BreakerCooldown, defaultBreakerCooldown)
+		opts = append(opts, WithCircuitBreaker(circuitBreakerFor(failures, cooldown)))
+	}
+
+	if len(config.FeedPreferences) > 0 {
+		opts = append(opts, WithFeedPreferences(config.FeedPreferences))
+	}
+
+	if fetchConfig.MaxPerHost != 0 {
+		opts = append(opts, WithMaxPerHost(fetchConfig.MaxPerHost))
+	}
+
+	if fetchConfig.Http1Only {
+		opts = append(opts, WithHttp1Only())
+	} else if len(fetchConfig.Http1Hosts) > 0 {
+		opts = append(opts, WithHttp1Hosts(fetchConfig.Http1Hosts))
+	}
+
+	if fetchConfig.MaxBytesPerSecond > 0 {
+		opts = append(opts, WithBandwidthLimit(bandwidthLimiterFor(fetchConfig.MaxBytesPerSecond)))
+	}
+
+	fetcher := NewFetcher(opts...)
+	if fetchConfig.Cassette.Path != "" {
+		fetcher = newCassetteFetcher(fetchConfig.Cassette, fetcher)
+	}
+
+	return fetcher
+}
+
+// FetchedPage is a fetched page along with the parts of the response other
+// than the body.
+type FetchedPage struct {
+	Html       string
+	StatusCode int
+	Header     http.Header
+	// FinalUrl is where the redirects, if any, ended up
+	FinalUrl string
+	// ContentLength is as the server declared it, or the bytes read when it
+	// didn't, and -1 when neither is known
+	ContentLength int64
+	Err           error
+}
+
+func (f *httpFetcher) Fetch(post Post, pageUrl string) (string, int, error) {
+	page := f.FetchPage(post, pageUrl)
+
+	return page.Html, page.StatusCode, page.Err
+}
+
+func (f *httpFetcher) FetchPage(post Post, pageUrl string) FetchedPage {
+	fmt.Println("fetching", pageUrl)
+
+	var (
+		page       FetchedPage
+		retryAfter time.Duration
+	)
+
+	// the breaker tells services on different ports apart
+	host, hostPort := "", ""
+	if u, parseErr := url.Parse(pageUrl); parseErr == nil {
+		host, hostPort = u.Hostname(), u.Host
+	}
+
+	userAgent, err := f.waitForPreference(post)
+	if err != nil {
+		return FetchedPage{Err: err}
+	}
+
+	// a feed preference's user agent wins over the domain's
+	if userAgent == "" {
+		userAgent = f.domains.forHost(host).UserAgent
+	}
+
+	if userAgent == "" {
+		userAgent = f.userAgent
+	}
+
+	if f.breaker != nil {
+		err = f.breaker.allow(hostPort)
+		if err != nil {
+			fmt.Println("skipping", pageUrl, err.Error())
+			metrics.count("fetch.circuit_open", 1)
+			return FetchedPage{Err: err}
+		}
+	}
+
+	fetchStarted := clock.Now()
+
+	for attempt := 1; ; attempt++ {
+		page, retryAfter = f.fetchOnce(pageUrl, userAgent)
+		if !isRetryable(page.StatusCode, page.Err) {
+			break
+		}
+
+		if retryAfter > 0 {
+			// the host's other pages wait too
+			f.rateLimiter.Backoff(host, clock.Now().Add(minDuration(retryAfter, f.maxRetryAfter)))
+
+			// a Retry-After earns a retry even without a retry policy
+			if retryAfter > f.maxRetryAfter || attempt >= maxInt(f.retryPolicy.MaxAttempts, 2) {
+				break
+			}
+
+			fmt.Println("retrying", pageUrl, "after", retryAfter, "attempt", attempt+1)
+			continue
+		}
+
+		if attempt >= f.retryPolicy.MaxAttempts {
+			break
+		}
+
+		<-clock.After(f.retryPolicy.Backoff * time.Duration(attempt))
+		fmt.Println("retrying", pageUrl, "attempt", attempt+1)
+	}
+
+	metrics.timing("fetch.duration", clock.Now().Sub(fetchStarted))
+
+	if f.breaker != nil {
+		f.breaker.record(hostPort, isRetryable(page.StatusCode, page.Err))
+	}
+
+	if page.Err != nil {
+		fmt.Println(page.Err.Error())
+		reportError("fetch", post, page.Err)
+		metrics.count("fetch.errors", 1)
+	} else {
+		metrics.count(fmt.Sprintf("fetch.status.%d", page.StatusCode), 1)
+	}
+
+	return page
+}
+
+func (f *httpFetcher) Close() error {
+	f.transport.CloseIdleConnections()
+
+	return nil
+}
+
+// fetchOnce makes a single request, also returning how long the host asked
+// to wait before retrying a 429 or 503.
+func (f *httpFetcher) fetchOnce(pageUrl string, userAgent string) (FetchedPage, time.Duration) {
+	req, err := http.NewRequest("GET", pageUrl, nil)
+	if err != nil {
+		return FetchedPage{Err: err}, 0
+	}
+
+	domain := f.domains.forHost(req.URL.Hostname())
+	for name, value := range domain.Headers {
+		req.Header.Set(name, value)
+	}
+
+	for name, value := range domain.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+
+	// tumblr gdpr nonsense, unless a consent cookie has been configured
+	if !strings.Contains(pageUrl, "tumblr.com") || len(domain.Cookies) > 0 || f.hasCookies(req.URL) {
+		req.Header.Add("User-Agent", userAgent)
+	} else {
+		req.Header.Add("User-Agent", "Baiduspider")
+	}
+
+	// waiting for the host's turn doesn't count towards the request timeout
+	if f.rateLimiter != nil {
+		err = f.rateLimiter.Wait(context.Background(), req.URL.Hostname())
+		if err != nil {
+			return FetchedPage{Err: err}, 0
+		}
+	}
+
+	release := f.acquireHostSlot(req.URL.Hostname())
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return FetchedPage{Err: err}, 0
+	}
+
+	defer func(resp *http.Response) {
+		_ = resp.Body.Close()
+	}(resp)
+
+	page := FetchedPage{StatusCode: resp.StatusCode, Header: resp.Header, ContentLength: resp.ContentLength}
+	if resp.Request != nil && resp.Request.URL != nil {
+		page.FinalUrl = resp.Request.URL.String()
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		return page, parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return page, 0
+	}
+
+	var body io.Reader = resp.Body
+	if f.maxBodySize > 0 {
+		body = io.LimitReader(resp.Body, f.maxBodySize)
+	}
+
+	buf := getBodyBuffer()
+	defer putBodyBuffer(buf)
+
+	if resp.ContentLength > 0 && (f.maxBodySize <= 0 || resp.ContentLength <= f.maxBodySize) {
+		buf.Grow(int(resp.ContentLength))
+	}
+
+	_, err = buf.ReadFrom(body)
+	if err != nil {
+		page.Err = err
+		return page, 0
+	}
+
+	// the page outlives the buffer, which goes back to the pool, so the body
+	// is still copied into a string once; pooling only saves growing a fresh
+	// slice for every response
+	page.Html = buf.String()
+	if page.ContentLength < 0 {
+		page.ContentLength = int64(len(page.Html))
+	}
+
+	return page, 0
+}
+
+// acquireHostSlot waits until fewer than maxPerHost requests to host are in
+// flight, returning a func that frees the slot again.
+func (f *httpFetcher) acquireHostSlot(host string) func() {
+	maxPerHost := f.maxPerHost
+	if domainMax := f.domains.forHost(host).MaxPerHost; domainMax != 0 {
+		maxPerHost = domainMax
+	}
+
+	if maxPerHost < 0 {
+		return func() {}
+	}
+
+	f.hostSlotsMu.Lock()
+	slots, ok := f.hostSlots[host]
+	if !ok {
+		slots = make(chan struct{}, maxInt(maxPerHost, 1))
+		f.hostSlots[host] = slots
+	}
+	f.hostSlotsMu.Unlock()
+
+	slots <- struct{}{}
+
+	return func() {
+		<-slots
+	}
+}
+
+// parseRetryAfter reads a Retry-After given in seconds or as an http date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+
+	return 0
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+func isRetryable(statusCode int, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+func (f *httpFetcher) hasCookies(u *url.URL) bool {
+	return f.client.Jar != nil && len(f.client.Jar.Cookies(u)) > 0
+}
+
+// seedCookies adds cookies for a domain and its subdomains, over both http
+// and https.
+func seedCookies(jar http.CookieJar, domain string, cookies map[string]string) {
+	domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+
+	jarCookies := make([]*http.Cookie, 0, len(cookies))
+	for name, value := range cookies {
+		jarCookies = append(jarCookies, &http.Cookie{
+			Name:   name,
+			Value:  value,
+			Path:   "/",
+			Domain: domain,
+		})
+	}
+
+	for _, scheme := range []string{"http", "https"} {
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: domain, Path: "/"}, jarCookies)
+	}
+}
+
+// hostRateLimiter spaces out requests to the same host by a fixed interval,
+// and holds them back while the host has asked to be retried later.
+type hostRateLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     map[string]time.Time
+}
+
+func NewHostRateLimiter(interval time.Duration) RateLimiter {
+	return &hostRateLimiter{
+		interval: interval,
+		next:     make(map[string]time.Time),
+	}
+}
+
+func (l *hostRateLimiter) Wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := clock.Now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	select {
+	case <-clock.After(slot.Sub(now)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *hostRateLimiter) Backoff(host string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until.After(l.next[host]) {
+		l.next[host] = until
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithProxyIgnoresOptionOrder(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		_, _ = w.Write([]byte("<html><head><title>proxied</title></head></html>"))
+	}))
+	defer proxy.Close()
+
+	proxyUrl, _ := url.Parse(proxy.URL)
+	domains, problems := compileDomains([]DomainConfig{{Match: "other.example", UserAgent: "other"}})
+	if len(problems) > 0 {
+		t.Fatal(problems)
+	}
+
+	orders := [][]Option{
+		{WithProxy(proxyUrl), WithDomains(domains), WithHttp1Only()},
+		{WithHttp1Only(), WithDomains(domains), WithProxy(proxyUrl)},
+	}
+
+	for i, opts := range orders {
+		fetcher := NewFetcher(opts...)
+
+		html, status, err := fetcher.Fetch(Post{}, "http://proxied.example/post")
+		if err != nil || status != http.StatusOK || html == "" {
+			t.Errorf("order %d: Fetch = %d, %v, want the page from the proxy", i, status, err)
+		}
+
+		_ = fetcher.Close()
+	}
+
+	if got := atomic.LoadInt32(&proxied); got != int32(len(orders)) {
+		t.Errorf("the proxy got %d requests, want %d", got, len(orders))
+	}
+}
@@ -0,0 +1,157 @@
+//go:build grpc
+
+// The gRPC server is only built with -tags grpc, after generating ogparserpb
+// with go generate.
+//go:generate protoc --go_out=. --go_opt=module=github.com/bateszi/abt-og-parser --go-grpc_out=. --go-grpc_opt=module=github.com/bateszi/abt-og-parser proto/ogparser.proto
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bateszi/abt-og-parser/ogparserpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net"
+)
+
+// grpcServer parses with the current config, so reloads apply to it too.
+type grpcServer struct {
+	ogparserpb.UnimplementedOgParserServer
+}
+
+func init() {
+	startGrpcServer = func(addr string) {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			fmt.Println("could not start grpc server", err.Error())
+			return
+		}
+
+		server := grpc.NewServer()
+		ogparserpb.RegisterOgParserServer(server, &grpcServer{})
+
+		go func() {
+			fmt.Println("Starting grpc server on", addr)
+			err := server.Serve(listener)
+			if err != nil {
+				fmt.Println("grpc server stopped", err.Error())
+			}
+		}()
+	}
+}
+
+func (s *grpcServer) ParseURL(ctx context.Context, req *ogparserpb.ParseURLRequest) (*ogparserpb.ParseResponse, error) {
+	if req.GetUrl() == "" {
+		return nil, status.Error(codes.InvalidArgument, "url is required")
+	}
+
+	config := currentConfig()
+	fetcher := newFetcherFromConfig(config)
+
+	defer func() {
+		_ = fetcher.Close()
+	}()
+
+	return s.parseUrl(fetcher, config, req.GetUrl()), nil
+}
+
+func (s *grpcServer) ParseHTML(ctx context.Context, req *ogparserpb.ParseHTMLRequest) (*ogparserpb.ParseResponse, error) {
+	scrapedPost := PostScraped{
+		Post: Post{Url: req.GetUrl()},
+		Html: req.GetHtml(),
+	}
+
+	config := currentConfig()
+	getOgTagsFromHtml(&scrapedPost)
+	scrapedPost.OpenGraphTags.normalize(config.MaxDescriptionLength)
+	scrapedPost.OpenGraphTags.cleanUrls(config.TrackingParams)
+
+	return toParseResponse(scrapedPost), nil
+}
+
+// ParseBatch keeps the config current when the stream started for all of it.
+func (s *grpcServer) ParseBatch(stream ogparserpb.OgParser_ParseBatchServer) error {
+	config := currentConfig()
+	fetcher := newFetcherFromConfig(config)
+
+	defer func() {
+		_ = fetcher.Close()
+	}()
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(s.parseUrl(fetcher, config, req.GetUrl()))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *grpcServer) parseUrl(fetcher Fetcher, config AppConfig, pageUrl string) *ogparserpb.ParseResponse {
+	scrapedPost := PostScraped{
+		Post: Post{Url: pageUrl},
+	}
+
+	scrapedPost.Html, scrapedPost.StatusCode, scrapedPost.FetchErr = fetcher.Fetch(scrapedPost.Post, pageUrl)
+	if scrapedPost.Html == "" {
+		resp := &ogparserpb.ParseResponse{Url: pageUrl, Error: fmt.Sprintf("status %d", scrapedPost.StatusCode)}
+		if scrapedPost.FetchErr != nil {
+			resp.Error = scrapedPost.FetchErr.Error()
+		}
+		return resp
+	}
+
+	parseScrapedPost(fetcher, config, &scrapedPost)
+
+	return toParseResponse(scrapedPost)
+}
+
+func toParseResponse(scraped PostScraped) *ogparserpb.ParseResponse {
+	tags := scraped.OpenGraphTags
+
+	return &ogparserpb.ParseResponse{
+		Url: scraped.Post.Url,
+		Metadata: &ogparserpb.Metadata{
+			Title:         tags.Title,
+			Description:   tags.Description,
+			FeaturedImage: tags.FeaturedImage,
+			CanonicalUrl:  tags.canonicalUrl(),
+			Language:      tags.Language,
+			Icon:          tags.Icon,
+			Keywords:      tags.Keywords,
+			Feeds:         tags.Feeds,
+			Article: &ogparserpb.Article{
+				PublishedTime: tags.Article.PublishedTime,
+				ModifiedTime:  tags.Article.ModifiedTime,
+				Authors:       tags.Article.Authors,
+				Section:       tags.Article.Section,
+				Tags:          tags.Article.Tags,
+			},
+			Video: toMedia(tags.Video),
+			Audio: toMedia(tags.Audio),
+		},
+	}
+}
+
+func toMedia(media MediaMetadata) *ogparserpb.Media {
+	if media.empty() {
+		return nil
+	}
+
+	return &ogparserpb.Media{
+		Url:       media.Url,
+		SecureUrl: media.SecureUrl,
+		Type:      media.Type,
+	}
+}
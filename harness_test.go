@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fixtureSite serves the pages in testdata/site, along with a missing page
+// and a redirect, counting the requests made for each path.
+type fixtureSite struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	hits map[string]int
+}
+
+func newFixtureSite(t *testing.T) *fixtureSite {
+	t.Helper()
+
+	site := &fixtureSite{hits: make(map[string]int)}
+	files := http.FileServer(http.Dir("testdata/site"))
+
+	site.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site.mu.Lock()
+		site.hits[r.URL.Path]++
+		site.mu.Unlock()
+
+		switch r.URL.Path {
+		case "/missing.html":
+			http.NotFound(w, r)
+		case "/moved.html":
+			http.Redirect(w, r, "/article.html", http.StatusMovedPermanently)
+		default:
+			files.ServeHTTP(w, r)
+		}
+	}))
+	t.Cleanup(site.Close)
+
+	return site
+}
+
+func (s *fixtureSite) hitsFor(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.hits[path]
+}
+
+// testConfig is a config for running cycles against a fixtureSite, with
+// nothing that would reach outside of it.
+func testConfig() AppConfig {
+	return AppConfig{
+		FetchWorkers:   2,
+		ParseWorkers:   2,
+		PersistWorkers: 2,
+	}
+}
+
+// runCycle runs one full cycle of the scraper over the store's posts.
+func runCycle(t *testing.T, store Store, config AppConfig, sinks ...Sink) {
+	t.Helper()
+
+	err := start(store, config, sinks)
+	if err != nil {
+		t.Fatalf("cycle failed: %v", err)
+	}
+}
+
+// useManualClock swaps the clock for a manual one for the rest of the test.
+func useManualClock(t *testing.T) *manualClock {
+	manual := newManualClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	clock = manual
+	t.Cleanup(func() {
+		clock = realClock{}
+	})
+
+	return manual
+}
+
+// memorySink keeps every event written to it.
+type memorySink struct {
+	mu     sync.Mutex
+	events []ScrapedEvent
+}
+
+func (s *memorySink) Name() string {
+	return "memory"
+}
+
+func (s *memorySink) Write(scraped PostScraped) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, newScrapedEvent(scraped))
+
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func (s *memorySink) Events() []ScrapedEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]ScrapedEvent(nil), s.events...)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// HreflangAlternate is a translation of the page a site links to with
+// <link rel="alternate" hreflang="...">.
+type HreflangAlternate struct {
+	// Hreflang is a language tag such as "de" or "pt-br", or "x-default"
+	Hreflang string `json:"hreflang"`
+	Url      string `json:"url"`
+}
+
+func (t *OpenGraphTags) addAlternate(hreflang string, href string) {
+	hreflang = strings.ToLower(strings.TrimSpace(hreflang))
+	if hreflang == "" || len(hreflang) > 35 {
+		return
+	}
+
+	t.Alternates = append(t.Alternates, HreflangAlternate{Hreflang: hreflang, Url: href})
+}
+
+// resolveAlternates makes the alternates' urls absolute, keeping the first
+// one given for each language.
+func resolveAlternates(pageUrl string, alternates []HreflangAlternate) []HreflangAlternate {
+	if len(alternates) == 0 {
+		return nil
+	}
+
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return nil
+	}
+
+	resolved := make([]HreflangAlternate, 0, len(alternates))
+	seen := make(map[string]bool)
+	for _, alternate := range alternates {
+		alternateUrl, err := base.Parse(strings.TrimSpace(alternate.Url))
+		if err != nil || seen[alternate.Hreflang] || alternateUrl.Host == "" {
+			continue
+		}
+
+		seen[alternate.Hreflang] = true
+		resolved = append(resolved, HreflangAlternate{Hreflang: alternate.Hreflang, Url: alternateUrl.String()})
+	}
+
+	return resolved
+}
+
+func (s *sqlStore) saveAlternates(ctx context.Context, postID int64, alternates []HreflangAlternate) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM post_alternates WHERE fk_post_id = ?", postID)
+	if err != nil {
+		return fmt.Errorf("clearing post alternates: %w", err)
+	}
+
+	for _, alternate := range alternates {
+		_, err = s.db.ExecContext(
+			ctx, "INSERT INTO post_alternates (fk_post_id, hreflang, url) VALUES (?, ?, ?)",
+			postID, alternate.Hreflang, s.safeText(truncateRunes(alternate.Url, 2000)),
+		)
+		if err != nil {
+			return fmt.Errorf("inserting post alternate: %w", err)
+		}
+	}
+
+	return nil
+}
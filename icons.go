@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type iconLink struct {
+	Href  string
+	Rel   string
+	Sizes string
+}
+
+// resolveSiteIcon picks the best icon a page links to as an absolute url,
+// preferring apple-touch-icons as they are larger, then the largest icon.
+// Sites that link no icon fall back to /favicon.ico.
+func resolveSiteIcon(pageUrl string, icons []iconLink) string {
+	base, err := url.Parse(pageUrl)
+	if err != nil || base.Host == "" {
+		return ""
+	}
+
+	best := iconLink{}
+	bestScore := -1
+	for _, icon := range icons {
+		score := iconSize(icon.Sizes)
+		if strings.HasPrefix(icon.Rel, "apple-touch-icon") {
+			score += 1000000
+		}
+
+		if score > bestScore {
+			best, bestScore = icon, score
+		}
+	}
+
+	if bestScore == -1 {
+		return base.Scheme + "://" + base.Host + "/favicon.ico"
+	}
+
+	resolved, err := base.Parse(best.Href)
+	if err != nil {
+		return ""
+	}
+
+	return resolved.String()
+}
+
+// iconSize returns the largest width from a sizes attribute such as
+// "16x16 32x32", or 0 when it is missing or "any".
+func iconSize(sizes string) int {
+	largest := 0
+	for _, size := range strings.Fields(strings.ToLower(sizes)) {
+		width, err := strconv.Atoi(strings.SplitN(size, "x", 2)[0])
+		if err == nil && width > largest {
+			largest = width
+		}
+	}
+
+	return largest
+}
+
+// resolveIconUrl makes an icon's href, such as msapplication-TileImage,
+// absolute.
+func resolveIconUrl(pageUrl string, href string) string {
+	if href == "" {
+		return ""
+	}
+
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return ""
+	}
+
+	resolved, err := base.Parse(href)
+	if err != nil {
+		return ""
+	}
+
+	return resolved.String()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const defaultMinImageSize = 50
+
+// defaultPlaceholderImages are fragments of the urls of generic images sites
+// fall back to when a post has none of its own.
+var defaultPlaceholderImages = []string{
+	"gravatar.com/avatar/",
+	"secure.gravatar.com/blavatar/",
+	"s.w.org/images/core/emoji/",
+	"/wp-includes/images/media/default.png",
+	"/wp-includes/images/blank.gif",
+	"/wp-content/plugins/jetpack/images/",
+	"s0.wp.com/i/blank.jpg",
+	"s0.wp.com/i/webclip.png",
+}
+
+// ImagePolicyConfig decides which featured images are worth keeping. Sizes
+// are checked when the page declares them or probeImages is set.
+type ImagePolicyConfig struct {
+	MinWidth  int `json:"minWidth"`
+	MinHeight int `json:"minHeight"`
+	// MinAspectRatio and MaxAspectRatio bound width / height, e.g. 0.25 and 4
+	// to drop banners and skyscrapers.
+	MinAspectRatio float64 `json:"minAspectRatio"`
+	MaxAspectRatio float64 `json:"maxAspectRatio"`
+	// RejectFormats defaults to ico; add svg to reject those too.
+	RejectFormats []string `json:"rejectFormats"`
+	// DenyUrls are fragments of placeholder image urls, replacing the
+	// defaults when set.
+	DenyUrls []string `json:"denyUrls"`
+}
+
+// rejectReason returns why the featured image should be dropped, or an empty
+// string if it is acceptable.
+func (p ImagePolicyConfig) rejectReason(tags OpenGraphTags) string {
+	imageUrl := strings.ToLower(tags.FeaturedImage)
+
+	denyUrls := p.DenyUrls
+	if denyUrls == nil {
+		denyUrls = defaultPlaceholderImages
+	}
+
+	for _, fragment := range denyUrls {
+		if fragment != "" && strings.Contains(imageUrl, strings.ToLower(fragment)) {
+			return "placeholder image"
+		}
+	}
+
+	rejectFormats := p.RejectFormats
+	if rejectFormats == nil {
+		rejectFormats = []string{"ico"}
+	}
+
+	format := imageFormat(tags)
+	for _, rejected := range rejectFormats {
+		if format != "" && strings.EqualFold(format, rejected) {
+			return format + " image"
+		}
+	}
+
+	width, height := tags.ImageWidth, tags.ImageHeight
+	if width <= 0 || height <= 0 {
+		return ""
+	}
+
+	minWidth, minHeight := p.MinWidth, p.MinHeight
+	if minWidth == 0 {
+		minWidth = defaultMinImageSize
+	}
+	if minHeight == 0 {
+		minHeight = defaultMinImageSize
+	}
+
+	if width < minWidth || height < minHeight {
+		return fmt.Sprintf("%dx%d image is too small", width, height)
+	}
+
+	ratio := float64(width) / float64(height)
+	if (p.MinAspectRatio > 0 && ratio < p.MinAspectRatio) || (p.MaxAspectRatio > 0 && ratio > p.MaxAspectRatio) {
+		return fmt.Sprintf("%dx%d image has an unwanted aspect ratio", width, height)
+	}
+
+	return ""
+}
+
+// imageFormat is the probed format, or else a guess from the extension.
+func imageFormat(tags OpenGraphTags) string {
+	if tags.ImageFormat != "" {
+		return tags.ImageFormat
+	}
+
+	u, err := url.Parse(tags.FeaturedImage)
+	if err != nil {
+		return ""
+	}
+
+	switch ext := strings.ToLower(path.Ext(u.Path)); ext {
+	case ".jpg", ".jpeg":
+		return "jpeg"
+	case ".png", ".gif", ".webp", ".svg", ".ico":
+		return strings.TrimPrefix(ext, ".")
+	}
+
+	return ""
+}
+
+// applyImagePolicy drops a featured image the policy rejects.
+func applyImagePolicy(policy ImagePolicyConfig, scrapedPost *PostScraped) {
+	tags := &scrapedPost.OpenGraphTags
+	if tags.FeaturedImage == "" {
+		return
+	}
+
+	if reason := policy.rejectReason(*tags); reason != "" {
+		fmt.Println("dropping image", tags.FeaturedImage, "from", scrapedPost.Post.Url, reason)
+		scrapedPost.note("dropped image %s: %s", tags.FeaturedImage, reason)
+		tags.FeaturedImage = ""
+		delete(tags.Sources, "featured_image")
+		tags.ImageWidth, tags.ImageHeight, tags.ImageFormat = 0, 0, ""
+	}
+}
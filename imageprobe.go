@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// imageProbeBytes is enough to reach the dimensions of nearly every
+	// image, even jpegs with large exif blocks before the frame header.
+	imageProbeBytes = 64 << 10
+
+	defaultImageTimeout = 5 * time.Second
+)
+
+// imageInfo is what probing the start of an image tells us.
+type imageInfo struct {
+	Format string
+	Width  int
+	Height int
+}
+
+// ProbeImage reads just enough of an image to learn its format and size,
+// asking for a byte range so large files aren't downloaded.
+func (f *httpFetcher) ProbeImage(imageUrl string) (imageInfo, error) {
+	req, err := http.NewRequest("GET", imageUrl, nil)
+	if err != nil {
+		return imageInfo{}, err
+	}
+
+	req.Header.Set("User-Agent", f.userAgent)
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", imageProbeBytes-1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.imageTimeout)
+	defer cancel()
+
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return imageInfo{}, err
+	}
+
+	defer func(resp *http.Response) {
+		_ = resp.Body.Close()
+	}(resp)
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return imageInfo{}, fmt.Errorf("image returned status %d", resp.StatusCode)
+	}
+
+	// servers ignoring the range send the whole file, so stop reading early
+	head, err := ioutil.ReadAll(io.LimitReader(resp.Body, imageProbeBytes))
+	if err != nil && len(head) == 0 {
+		return imageInfo{}, err
+	}
+
+	info, ok := sniffImage(head)
+	if !ok {
+		return imageInfo{}, fmt.Errorf("could not recognise image of type %s", resp.Header.Get("Content-Type"))
+	}
+
+	return info, nil
+}
+
+// sniffImage reads the format and dimensions from the start of an image.
+// Svgs are recognised but have no intrinsic size.
+func sniffImage(head []byte) (imageInfo, bool) {
+	if config, format, err := image.DecodeConfig(bytes.NewReader(head)); err == nil {
+		return imageInfo{Format: format, Width: config.Width, Height: config.Height}, true
+	}
+
+	if info, ok := sniffWebp(head); ok {
+		return info, true
+	}
+
+	if len(head) >= 4 && bytes.Equal(head[:4], []byte{0, 0, 1, 0}) {
+		return imageInfo{Format: "ico"}, true
+	}
+
+	prefix := strings.ToLower(string(head[:minInt(len(head), 512)]))
+	if strings.Contains(prefix, "<svg") {
+		return imageInfo{Format: "svg"}, true
+	}
+
+	return imageInfo{}, false
+}
+
+// sniffWebp reads the canvas size of lossy, lossless and extended webps.
+func sniffWebp(head []byte) (imageInfo, bool) {
+	if len(head) < 30 || string(head[0:4]) != "RIFF" || string(head[8:12]) != "WEBP" {
+		return imageInfo{}, false
+	}
+
+	chunk := head[12:]
+	switch string(chunk[0:4]) {
+	case "VP8 ":
+		// frame tag, then the 9d 01 2a start code, then 14 bit dimensions
+		if chunk[11] != 0x9d || chunk[12] != 0x01 || chunk[13] != 0x2a {
+			return imageInfo{}, false
+		}
+		width := int(binary.LittleEndian.Uint16(chunk[14:16]) & 0x3fff)
+		height := int(binary.LittleEndian.Uint16(chunk[16:18]) & 0x3fff)
+		return imageInfo{Format: "webp", Width: width, Height: height}, true
+	case "VP8L":
+		if chunk[8] != 0x2f {
+			return imageInfo{}, false
+		}
+		bits := binary.LittleEndian.Uint32(chunk[9:13])
+		width := int(bits&0x3fff) + 1
+		height := int((bits>>14)&0x3fff) + 1
+		return imageInfo{Format: "webp", Width: width, Height: height}, true
+	case "VP8X":
+		width := int(uint32(chunk[12])|uint32(chunk[13])<<8|uint32(chunk[14])<<16) + 1
+		height := int(uint32(chunk[15])|uint32(chunk[16])<<8|uint32(chunk[17])<<16) + 1
+		return imageInfo{Format: "webp", Width: width, Height: height}, true
+	}
+
+	return imageInfo{}, false
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// probeFeaturedImage fills in the featured image's size, unless the page
+// declared it. An image that can't be probed is kept.
+func probeFeaturedImage(fetcher Fetcher, scrapedPost *PostScraped) {
+	tags := &scrapedPost.OpenGraphTags
+	if tags.FeaturedImage == "" || (tags.ImageWidth > 0 && tags.ImageHeight > 0) {
+		return
+	}
+
+	info, err := fetcher.ProbeImage(tags.FeaturedImage)
+	if err != nil {
+		fmt.Println("could not probe image", tags.FeaturedImage, err.Error())
+		scrapedPost.note("could not probe image %s: %s", tags.FeaturedImage, err.Error())
+		return
+	}
+
+	tags.ImageFormat = info.Format
+	tags.ImageWidth = info.Width
+	tags.ImageHeight = info.Height
+}
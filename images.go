@@ -0,0 +1,170 @@
+package main
+
+import (
+	"golang.org/x/net/html"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxBodyImages is how many in-body images are considered for the featured
+// image fallback, the lead image being near the top.
+const maxBodyImages = 10
+
+// minBodyImageSize skips images whose width or height attribute marks them
+// as icons or tracking pixels.
+const minBodyImageSize = 50
+
+// bodyImage is an <img>, or a <picture> and its <source>s, with every url it
+// offers.
+type bodyImage struct {
+	candidates []imageCandidate
+	width      int
+	height     int
+}
+
+type imageCandidate struct {
+	Url string
+	// Width is from a "480w" descriptor, Density from "2x". Neither is set
+	// for a plain src.
+	Width   int
+	Density float64
+}
+
+// addBodyImage collects <picture>, <source> and <img> tags for the featured
+// image fallback.
+func (t *OpenGraphTags) addBodyImage(token html.Token) {
+	if len(t.images) >= maxBodyImages && t.picture == nil {
+		return
+	}
+
+	switch token.Data {
+	case "picture":
+		if token.Type == html.StartTagToken {
+			t.picture = &bodyImage{}
+		} else if token.Type == html.EndTagToken && t.picture != nil {
+			t.images = append(t.images, *t.picture)
+			t.picture = nil
+		}
+	case "source":
+		if t.picture != nil {
+			t.picture.candidates = append(t.picture.candidates, parseSrcset(attrValue(token, "srcset"))...)
+		}
+	case "img":
+		image := t.picture
+		if image == nil {
+			image = &bodyImage{}
+		}
+
+		image.width, _ = strconv.Atoi(attrValue(token, "width"))
+		image.height, _ = strconv.Atoi(attrValue(token, "height"))
+		image.candidates = append(image.candidates, parseSrcset(attrValue(token, "srcset"))...)
+
+		if src := attrValue(token, "src"); src != "" && !strings.HasPrefix(src, "data:") {
+			image.candidates = append(image.candidates, imageCandidate{Url: src})
+		}
+
+		if t.picture == nil {
+			t.images = append(t.images, *image)
+		}
+	}
+}
+
+// parseSrcset reads "a.jpg 480w, b.jpg 800w" or "a.jpg, b.jpg 2x", following
+// the html spec in splitting candidates on the commas after descriptors.
+func parseSrcset(srcset string) []imageCandidate {
+	candidates := make([]imageCandidate, 0)
+
+	rest := srcset
+	for {
+		rest = strings.TrimLeft(rest, " \t\n\r\f,")
+		if rest == "" {
+			return candidates
+		}
+
+		end := strings.IndexAny(rest, " \t\n\r\f")
+		if end == -1 {
+			end = len(rest)
+		}
+
+		candidate := imageCandidate{Url: rest[:end]}
+		rest = rest[end:]
+
+		// a url ending in a comma has no descriptor
+		if strings.HasSuffix(candidate.Url, ",") {
+			candidate.Url = strings.TrimRight(candidate.Url, ",")
+		} else {
+			end = strings.IndexByte(rest, ',')
+			if end == -1 {
+				end = len(rest)
+			}
+
+			candidate.setDescriptor(strings.TrimSpace(rest[:end]))
+			rest = rest[end:]
+		}
+
+		if candidate.Url != "" && !strings.HasPrefix(candidate.Url, "data:") {
+			candidates = append(candidates, candidate)
+		}
+	}
+}
+
+func (c *imageCandidate) setDescriptor(descriptor string) {
+	switch {
+	case strings.HasSuffix(descriptor, "w"):
+		c.Width, _ = strconv.Atoi(strings.TrimSuffix(descriptor, "w"))
+	case strings.HasSuffix(descriptor, "x"):
+		c.Density, _ = strconv.ParseFloat(strings.TrimSuffix(descriptor, "x"), 64)
+	}
+}
+
+// resolveBodyImage picks the first in-body image that isn't marked as tiny,
+// returning its highest resolution candidate as an absolute url.
+func resolveBodyImage(pageUrl string, images []bodyImage) string {
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return ""
+	}
+
+	for _, image := range images {
+		if (image.width > 0 && image.width < minBodyImageSize) || (image.height > 0 && image.height < minBodyImageSize) {
+			continue
+		}
+
+		best, ok := largestCandidate(image.candidates)
+		if !ok {
+			continue
+		}
+
+		resolved, err := base.Parse(best.Url)
+		if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+			continue
+		}
+
+		return resolved.String()
+	}
+
+	return ""
+}
+
+// largestCandidate prefers the widest "w" candidate, then the densest "x"
+// one, then the plain src.
+func largestCandidate(candidates []imageCandidate) (imageCandidate, bool) {
+	if len(candidates) == 0 {
+		return imageCandidate{}, false
+	}
+
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		switch {
+		case candidate.Width > 0 || best.Width > 0:
+			if candidate.Width > best.Width {
+				best = candidate
+			}
+		case candidate.Density > best.Density:
+			best = candidate
+		}
+	}
+
+	return best, true
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+type JsonlSinkConfig struct {
+	// Enabled turns the sink off without removing its settings. It is on
+	// whenever it is configured unless set to false.
+	Enabled    *bool  `json:"enabled"`
+	Path       string `json:"path"`
+	MaxBytes   int64  `json:"maxBytes"`
+	MaxBackups int    `json:"maxBackups"`
+}
+
+// jsonlSink appends one json line per scraped post to a file, rotating it to
+// path.<timestamp> once it grows past MaxBytes.
+type jsonlSink struct {
+	config JsonlSinkConfig
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+}
+
+func newJsonlSink(config JsonlSinkConfig) (*jsonlSink, error) {
+	sink := &jsonlSink{config: config}
+
+	err := sink.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+func (s *jsonlSink) Name() string {
+	return "jsonl"
+}
+
+func (s *jsonlSink) Write(scraped PostScraped) error {
+	line, err := json.Marshal(newScrapedEvent(scraped))
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.MaxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.config.MaxBytes {
+		err = s.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+
+	return err
+}
+
+func (s *jsonlSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+func (s *jsonlSink) open() error {
+	file, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+
+	return nil
+}
+
+func (s *jsonlSink) rotate() error {
+	err := s.file.Close()
+	if err != nil {
+		return err
+	}
+
+	rotated := fmt.Sprintf("%s.%s", s.config.Path, clock.Now().UTC().Format("20060102T150405.000"))
+	err = os.Rename(s.config.Path, rotated)
+	if err != nil {
+		return err
+	}
+
+	s.removeOldBackups()
+
+	return s.open()
+}
+
+func (s *jsonlSink) removeOldBackups() {
+	if s.config.MaxBackups <= 0 {
+		return
+	}
+
+	backups, err := filepath.Glob(s.config.Path + ".*")
+	if err != nil || len(backups) <= s.config.MaxBackups {
+		return
+	}
+
+	// timestamps sort chronologically
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-s.config.MaxBackups] {
+		err = os.Remove(backup)
+		if err != nil {
+			fmt.Println("could not remove old jsonl file", backup, err.Error())
+		}
+	}
+}
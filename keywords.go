@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultMaxKeywords    = 8
+	maxKeywordPhraseWords = 3
+	minKeywordWordLength  = 3
+	minKeywordOccurrences = 2
+	keywordsEnricherName  = "keywords"
+)
+
+// KeywordsConfig configures the keywords enricher, which tags posts with the
+// key phrases of their article text.
+type KeywordsConfig struct {
+	MaxKeywords int `json:"maxKeywords"`
+}
+
+// keywordStopwords split english text into candidate phrases.
+var keywordStopwords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`a about above after again against all also am an and any are as at be
+		because been before being below between both but by can could did do does doing down during each few
+		for from further get got had has have having he her here hers herself him himself his how however i if
+		in into is it its itself just like make many me more most much must my myself new no nor not now of off
+		on once one only or other our ours ourselves out over own said same says see she should since so some
+		still such than that the their theirs them themselves then there these they this those through to too
+		two under until up us use used using very via was way we well were what when where which while who
+		whom why will with would yet you your yours yourself yourselves`) {
+		keywordStopwords[word] = true
+	}
+
+	registerEnricher(keywordsEnricherName, func(config AppConfig) (Enricher, error) {
+		return keywordEnricher{config: config.Keywords}, nil
+	})
+}
+
+type keywordEnricher struct {
+	config KeywordsConfig
+}
+
+func (e keywordEnricher) Name() string {
+	return keywordsEnricherName
+}
+
+// Enrich tags english pages with their highest scoring key phrases.
+func (e keywordEnricher) Enrich(ctx context.Context, scraped *PostScraped) error {
+	language := scraped.OpenGraphTags.Language
+	if language != "" && language != "en" {
+		return nil
+	}
+
+	maxKeywords := e.config.MaxKeywords
+	if maxKeywords <= 0 {
+		maxKeywords = defaultMaxKeywords
+	}
+
+	scraped.OpenGraphTags.Tags = extractKeywords(scraped.OpenGraphTags.articleText(), maxKeywords)
+
+	return nil
+}
+
+// extractKeywords ranks the phrases of text with RAKE: text is split into
+// phrases at stopwords and punctuation, each word scores its degree (the
+// length of the phrases it appears in) over its frequency, and a phrase
+// scores the sum of its words. Phrases seen only once are ignored.
+func extractKeywords(text string, max int) []string {
+	phrases := keywordPhrases(text)
+
+	frequency := make(map[string]int)
+	degree := make(map[string]int)
+	occurrences := make(map[string]int)
+
+	for _, phrase := range phrases {
+		for _, word := range phrase {
+			frequency[word]++
+			degree[word] += len(phrase)
+		}
+		occurrences[strings.Join(phrase, " ")]++
+	}
+
+	type scoredPhrase struct {
+		phrase string
+		score  float64
+	}
+
+	scored := make([]scoredPhrase, 0, len(occurrences))
+	for phrase, count := range occurrences {
+		if count < minKeywordOccurrences {
+			continue
+		}
+
+		score := 0.0
+		for _, word := range strings.Fields(phrase) {
+			score += float64(degree[word]) / float64(frequency[word])
+		}
+
+		scored = append(scored, scoredPhrase{phrase: phrase, score: score})
+	}
+
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].score != scored[j].score {
+			return scored[i].score > scored[j].score
+		}
+		return scored[i].phrase < scored[j].phrase
+	})
+
+	keywords := make([]string, 0, max)
+	for _, phrase := range scored {
+		if len(keywords) == max {
+			break
+		}
+		keywords = append(keywords, phrase.phrase)
+	}
+
+	return keywords
+}
+
+// keywordPhrases splits text into runs of up to three lower cased words
+// between stopwords and punctuation.
+func keywordPhrases(text string) [][]string {
+	phrases := make([][]string, 0)
+	phrase := make([]string, 0, maxKeywordPhraseWords)
+
+	endPhrase := func() {
+		if len(phrase) > 0 && len(phrase) <= maxKeywordPhraseWords {
+			phrases = append(phrases, phrase)
+		}
+		phrase = make([]string, 0, maxKeywordPhraseWords)
+	}
+
+	notWordChar := func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}
+
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		trimmedLeft := strings.TrimLeftFunc(field, notWordChar)
+		word := strings.TrimRightFunc(trimmedLeft, notWordChar)
+
+		// punctuation before a word, such as an opening quote, ends a phrase
+		if len(trimmedLeft) < len(field) {
+			endPhrase()
+		}
+
+		if word == "" || keywordStopwords[word] || !isKeywordWord(word) {
+			endPhrase()
+			continue
+		}
+
+		phrase = append(phrase, word)
+
+		if len(word) < len(trimmedLeft) {
+			endPhrase()
+		}
+	}
+
+	endPhrase()
+
+	return phrases
+}
+
+// isKeywordWord rejects short words and numbers.
+func isKeywordWord(word string) bool {
+	if len([]rune(word)) < minKeywordWordLength {
+		return false
+	}
+
+	return strings.IndexFunc(word, unicode.IsLetter) != -1
+}
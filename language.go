@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopwords used to tell latin script languages apart when a page doesn't
+// declare its language.
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "with", "for"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "ein", "eine", "auf"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "pour", "dans", "qui"},
+	"es": {"el", "la", "los", "las", "y", "que", "una", "por", "con", "para"},
+	"it": {"il", "di", "che", "e", "la", "per", "una", "sono", "non", "con"},
+	"pt": {"o", "os", "que", "e", "do", "da", "uma", "para", "com", "não"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "met", "voor"},
+}
+
+// scriptLanguages maps scripts that are (almost) unique to one language.
+var scriptLanguages = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Thai, "th"},
+	{unicode.Hebrew, "he"},
+	{unicode.Arabic, "ar"},
+	{unicode.Greek, "el"},
+	{unicode.Cyrillic, "ru"},
+}
+
+// normalizeLanguage turns a locale such as en_US or en-gb into its primary
+// language subtag.
+func normalizeLanguage(locale string) string {
+	locale = strings.TrimSpace(strings.ToLower(locale))
+	if i := strings.IndexAny(locale, "_-"); i != -1 {
+		locale = locale[:i]
+	}
+
+	if len(locale) < 2 || len(locale) > 3 {
+		return ""
+	}
+
+	for _, r := range locale {
+		if r < 'a' || r > 'z' {
+			return ""
+		}
+	}
+
+	return locale
+}
+
+// detectLanguage prefers what the page declares (og:locale, then the html
+// lang attribute) and only falls back to guessing from the description. It
+// also returns which of those the language came from.
+func detectLanguage(tags OpenGraphTags) (string, string) {
+	if language := normalizeLanguage(tags.Locale); language != "" {
+		return language, sourceOg
+	}
+
+	if language := normalizeLanguage(tags.HtmlLang); language != "" {
+		return language, sourceHtml
+	}
+
+	return guessLanguage(tags.Description), sourceHeuristic
+}
+
+func guessLanguage(text string) string {
+	counts := make(map[string]int)
+	letters := 0
+
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+
+		for _, script := range scriptLanguages {
+			if unicode.Is(script.table, r) {
+				counts[script.language]++
+				break
+			}
+		}
+	}
+
+	if letters == 0 {
+		return ""
+	}
+
+	// kana means japanese even when mixed with kanji
+	if counts["ja"] > 0 {
+		return "ja"
+	}
+
+	for _, script := range scriptLanguages {
+		if counts[script.language]*2 > letters {
+			return script.language
+		}
+	}
+
+	return guessLatinLanguage(text)
+}
+
+func guessLatinLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	if len(words) < 5 {
+		return ""
+	}
+
+	best, bestScore := "", 0
+	for language, stopwords := range languageStopwords {
+		score := 0
+		for _, word := range words {
+			for _, stopword := range stopwords {
+				if word == stopword {
+					score++
+					break
+				}
+			}
+		}
+
+		if score > bestScore || (score == bestScore && language < best) {
+			best, bestScore = language, score
+		}
+	}
+
+	// too few stopwords to be confident
+	if bestScore < 2 {
+		return ""
+	}
+
+	return best
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultLlmTimeout       = 30 * time.Second
+	defaultLlmMaxInputChars = 6000
+	defaultLlmMaxTokens     = 120
+	defaultLlmPrompt        = "Write a concise, neutral description of this article in one or two sentences, " +
+		"in the language of the article. Reply with the description only."
+	llmEnricherName = "llm"
+	// llmCacheSize is how many generated descriptions are remembered, so an
+	// unchanged page isn't summarized again every cycle
+	llmCacheSize = 10000
+)
+
+// LlmConfig configures the llm enricher, which asks a language model for a
+// description of pages that lack one.
+type LlmConfig struct {
+	// Provider is the api the endpoint speaks, only "openai" for now, which
+	// also covers compatible servers such as vLLM, Ollama or LiteLLM.
+	Provider string `json:"provider"`
+	Endpoint string `json:"endpoint"`
+	ApiKey   string `json:"apiKey"`
+	Model    string `json:"model"`
+	Prompt   string `json:"prompt"`
+	// MinLength is the shortest description, in characters, that is kept.
+	MinLength     int    `json:"minLength"`
+	MaxInputChars int    `json:"maxInputChars"`
+	MaxTokens     int    `json:"maxTokens"`
+	Timeout       string `json:"timeout"`
+	// RequestsPerMinute and MaxTokensPerCycle keep the cost down; once a
+	// scheduled cycle, of every tenant, has used up its tokens the rest of
+	// its pages are skipped. Posts scraped from the nats queue between
+	// cycles count towards the last cycle's tokens.
+	RequestsPerMinute int `json:"requestsPerMinute"`
+	MaxTokensPerCycle int `json:"maxTokensPerCycle"`
+}
+
+// Summarizer writes a description from a page's text.
+type Summarizer interface {
+	// Summarize returns the description and the tokens it cost.
+	Summarize(ctx context.Context, title string, text string) (string, int, error)
+}
+
+func init() {
+	registerEnricher(llmEnricherName, func(config AppConfig) (Enricher, error) {
+		return newLlmEnricher(config.Llm)
+	})
+}
+
+func newSummarizer(config LlmConfig) (Summarizer, error) {
+	switch config.Provider {
+	case "", "openai":
+		return newOpenAiSummarizer(config)
+	}
+
+	return nil, fmt.Errorf("unknown llm provider %q", config.Provider)
+}
+
+type llmEnricher struct {
+	config      LlmConfig
+	summarizer  Summarizer
+	rateLimiter RateLimiter
+
+	mu sync.Mutex
+	// cycleTokens are the tokens used since the cycle started, including
+	// those reserved by the calls still being made
+	cycleTokens int
+	// cache holds descriptions by the hash of what they were generated
+	// from, and cached its keys in the order they were added
+	cache  map[string]string
+	cached []string
+}
+
+func newLlmEnricher(config LlmConfig) (*llmEnricher, error) {
+	if config.MinLength <= 0 {
+		config.MinLength = defaultSummaryMinLength
+	}
+
+	if config.MaxInputChars <= 0 {
+		config.MaxInputChars = defaultLlmMaxInputChars
+	}
+
+	summarizer, err := newSummarizer(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var interval time.Duration
+	if config.RequestsPerMinute > 0 {
+		interval = time.Minute / time.Duration(config.RequestsPerMinute)
+	}
+
+	return &llmEnricher{
+		config:      config,
+		summarizer:  summarizer,
+		rateLimiter: NewHostRateLimiter(interval),
+		cache:       make(map[string]string),
+	}, nil
+}
+
+func (e *llmEnricher) Name() string {
+	return llmEnricherName
+}
+
+func (e *llmEnricher) startCycle() {
+	e.mu.Lock()
+	e.cycleTokens = 0
+	e.mu.Unlock()
+}
+
+// reserveTokens sets aside the most a call can cost before it's made, so
+// the parse workers calling at once can't all get past a budget that has
+// room for one of them. It reports false once the budget is spent.
+func (e *llmEnricher) reserveTokens() (int, bool) {
+	reserved := e.config.MaxTokens
+	if reserved <= 0 {
+		reserved = defaultLlmMaxTokens
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.config.MaxTokensPerCycle > 0 && e.cycleTokens >= e.config.MaxTokensPerCycle {
+		return 0, false
+	}
+
+	e.cycleTokens += reserved
+
+	return reserved, true
+}
+
+// spendTokens swaps a reservation for what the call really cost.
+func (e *llmEnricher) spendTokens(reserved int, tokens int) {
+	e.mu.Lock()
+	e.cycleTokens += tokens - reserved
+	e.mu.Unlock()
+}
+
+func (e *llmEnricher) Enrich(ctx context.Context, scraped *PostScraped) error {
+	if utf8.RuneCountInString(scraped.OpenGraphTags.Description) >= e.config.MinLength {
+		return nil
+	}
+
+	text := truncateRunes(scraped.OpenGraphTags.articleText(), e.config.MaxInputChars)
+	if text == "" {
+		return nil
+	}
+
+	key := llmCacheKey(scraped.OpenGraphTags.Title, text)
+	description, ok := e.cachedDescription(key)
+
+	if !ok {
+		reserved, ok := e.reserveTokens()
+		if !ok {
+			return nil
+		}
+
+		err := e.rateLimiter.Wait(ctx, llmEnricherName)
+		if err != nil {
+			e.spendTokens(reserved, 0)
+			return err
+		}
+
+		var tokens int
+		description, tokens, err = e.summarizer.Summarize(ctx, scraped.OpenGraphTags.Title, text)
+		e.spendTokens(reserved, tokens)
+
+		if err != nil {
+			return err
+		}
+
+		e.cacheDescription(key, description)
+	}
+
+	if normalized := normalizeText(description); normalized != "" {
+		scraped.OpenGraphTags.Description = normalized
+		scraped.OpenGraphTags.setSource("description", llmEnricherName, description)
+	}
+
+	return nil
+}
+
+// llmCacheKey hashes what a description is generated from.
+func llmCacheKey(title string, text string) string {
+	hash := sha256.Sum256([]byte(title + "\x00" + text))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func (e *llmEnricher) cachedDescription(key string) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	description, ok := e.cache[key]
+
+	return description, ok
+}
+
+// cacheDescription remembers a description, forgetting the oldest once the
+// cache is full.
+func (e *llmEnricher) cacheDescription(key string, description string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.cache[key]; ok {
+		return
+	}
+
+	if len(e.cached) >= llmCacheSize {
+		delete(e.cache, e.cached[0])
+		e.cached = e.cached[1:]
+	}
+
+	e.cache[key] = description
+	e.cached = append(e.cached, key)
+}
+
+// openAiSummarizer calls the chat completions api of OpenAI or a compatible
+// server.
+type openAiSummarizer struct {
+	config        LlmConfig
+	completionUrl string
+	httpClient    *http.Client
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionRequest struct {
+	Model     string        `json:"model"`
+	Messages  []chatMessage `json:"messages"`
+	MaxTokens int           `json:"max_tokens"`
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+func newOpenAiSummarizer(config LlmConfig) (*openAiSummarizer, error) {
+	if config.Model == "" {
+		return nil, errors.New("llm.model is required")
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.openai.com/v1"
+	}
+
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("llm.endpoint: %w", err)
+	}
+
+	if config.Prompt == "" {
+		config.Prompt = defaultLlmPrompt
+	}
+
+	if config.MaxTokens <= 0 {
+		config.MaxTokens = defaultLlmMaxTokens
+	}
+
+	return &openAiSummarizer{
+		config:        config,
+		completionUrl: strings.TrimRight(endpoint, "/") + "/chat/completions",
+		httpClient:    &http.Client{Timeout: parseDurationOr(config.Timeout, defaultLlmTimeout)},
+	}, nil
+}
+
+func (s *openAiSummarizer) Summarize(ctx context.Context, title string, text string) (string, int, error) {
+	content := text
+	if title != "" {
+		content = title + "\n\n" + text
+	}
+
+	body, err := json.Marshal(chatCompletionRequest{
+		Model: s.config.Model,
+		Messages: []chatMessage{
+			{Role: "system", Content: s.config.Prompt},
+			{Role: "user", Content: content},
+		},
+		MaxTokens: s.config.MaxTokens,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	req, err := http.NewRequest("POST", s.completionUrl, bytes.NewBuffer(body))
+	if err != nil {
+		return "", 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.config.ApiKey)
+	}
+
+	resp, err := s.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", 0, err
+	}
+
+	defer func(resp *http.Response) {
+		_ = resp.Body.Close()
+	}(resp)
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", 0, fmt.Errorf("llm returned status %d: %s", resp.StatusCode, respBody)
+	}
+
+	var completion chatCompletionResponse
+	err = json.NewDecoder(resp.Body).Decode(&completion)
+	if err != nil {
+		return "", 0, fmt.Errorf("decoding llm response: %w", err)
+	}
+
+	if len(completion.Choices) == 0 {
+		return "", completion.Usage.TotalTokens, errors.New("llm returned no choices")
+	}
+
+	return completion.Choices[0].Message.Content, completion.Usage.TotalTokens, nil
+}
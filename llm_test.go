@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingSummarizer words its description differently on every call, as a
+// language model does.
+type countingSummarizer struct {
+	calls int
+}
+
+func (s *countingSummarizer) Summarize(ctx context.Context, title string, text string) (string, int, error) {
+	s.calls++
+
+	return fmt.Sprintf("Summary number %d of the post.", s.calls), 10, nil
+}
+
+func newTestLlmEnricher(summarizer Summarizer, config LlmConfig) *llmEnricher {
+	return &llmEnricher{
+		config:      config,
+		summarizer:  summarizer,
+		rateLimiter: NewHostRateLimiter(0),
+		cache:       make(map[string]string),
+	}
+}
+
+func scrapedWithoutDescription() PostScraped {
+	scraped := PostScraped{
+		Post: Post{PostID: 1, Url: "https://example.com/posts/undescribed"},
+		Html: "<html><head><title>Undescribed</title></head><body>" +
+			"<p>A page that says a fair amount in its body, but nothing in its head.</p></body></html>",
+	}
+	getOgTagsFromHtml(&scraped)
+
+	return scraped
+}
+
+func TestLlmEnricherCachesDescriptions(t *testing.T) {
+	summarizer := &countingSummarizer{}
+	enricher := newTestLlmEnricher(summarizer, LlmConfig{MinLength: 80, MaxInputChars: 6000})
+
+	for cycle := 0; cycle < 3; cycle++ {
+		scraped := scrapedWithoutDescription()
+		err := enricher.Enrich(context.Background(), &scraped)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if scraped.OpenGraphTags.Description != "Summary number 1 of the post." {
+			t.Errorf("cycle %d described the page as %q", cycle, scraped.OpenGraphTags.Description)
+		}
+	}
+
+	if summarizer.calls != 1 {
+		t.Errorf("summarized the same page %d times, want once", summarizer.calls)
+	}
+}
+
+func TestLlmEnricherStopsAtItsBudget(t *testing.T) {
+	summarizer := &countingSummarizer{}
+	enricher := newTestLlmEnricher(summarizer, LlmConfig{MinLength: 80, MaxInputChars: 6000, MaxTokensPerCycle: 10})
+
+	for i := 0; i < 2; i++ {
+		scraped := scrapedWithoutDescription()
+		scraped.OpenGraphTags.Title = fmt.Sprint("page ", i)
+		_ = enricher.Enrich(context.Background(), &scraped)
+	}
+
+	if summarizer.calls != 1 {
+		t.Errorf("summarized %d pages, want the budget spent after one", summarizer.calls)
+	}
+
+	enricher.startCycle()
+
+	scraped := scrapedWithoutDescription()
+	scraped.OpenGraphTags.Title = "page 2"
+	_ = enricher.Enrich(context.Background(), &scraped)
+
+	if summarizer.calls != 2 {
+		t.Error("a new cycle didn't get a new budget")
+	}
+}
+
+// slowSummarizer takes a while to answer, counting calls from any goroutine.
+type slowSummarizer struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *slowSummarizer) Summarize(ctx context.Context, title string, text string) (string, int, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	return "A summary of the post.", 100, nil
+}
+
+func TestLlmEnricherBudgetHoldsForConcurrentCalls(t *testing.T) {
+	summarizer := &slowSummarizer{}
+	enricher := newTestLlmEnricher(summarizer, LlmConfig{MinLength: 80, MaxInputChars: 6000, MaxTokens: 100, MaxTokensPerCycle: 250})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			scraped := scrapedWithoutDescription()
+			scraped.OpenGraphTags.Title = fmt.Sprint("page ", i)
+			_ = enricher.Enrich(context.Background(), &scraped)
+		}(i)
+	}
+	wg.Wait()
+
+	if summarizer.calls != 3 {
+		t.Errorf("made %d calls at once, want the 3 that the budget has room for", summarizer.calls)
+	}
+}
+
+func TestContentHashIgnoresGeneratedDescriptions(t *testing.T) {
+	generated := func(description string) PostScraped {
+		scraped := scrapedWithoutDescription()
+		scraped.OpenGraphTags.Description = description
+		scraped.OpenGraphTags.setSource("description", llmEnricherName, description)
+		return scraped
+	}
+
+	first := generated("One way of putting it.").contentHash(SaveOptions{})
+	second := generated("Another way of putting it.").contentHash(SaveOptions{})
+
+	if first != second {
+		t.Error("rewording a generated description changed the content hash")
+	}
+}
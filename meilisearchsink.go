@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type MeilisearchSinkConfig struct {
+	// Enabled turns the sink off without removing its settings. It is on
+	// whenever it is configured unless set to false.
+	Enabled    *bool             `json:"enabled"`
+	Host       string            `json:"host"`
+	Index      string            `json:"index"`
+	ApiKey     string            `json:"apiKey"`
+	PrimaryKey string            `json:"primaryKey"`
+	Fields     map[string]string `json:"fields"`
+}
+
+// meilisearchSink adds or updates documents in an index. Meilisearch merges
+// partial documents into existing ones, like solr's atomic updates.
+type meilisearchSink struct {
+	config     MeilisearchSinkConfig
+	httpClient *http.Client
+}
+
+func newMeilisearchSink(config MeilisearchSinkConfig) *meilisearchSink {
+	if config.Index == "" {
+		config.Index = "posts"
+	}
+
+	if config.PrimaryKey == "" {
+		config.PrimaryKey = "id"
+	}
+
+	return &meilisearchSink{config: config, httpClient: &http.Client{}}
+}
+
+func (s *meilisearchSink) Name() string {
+	return "meilisearch"
+}
+
+func (s *meilisearchSink) searchIndex() {}
+
+func (s *meilisearchSink) Write(scraped PostScraped) error {
+	docs := []map[string]interface{}{
+		searchDocument(scraped, s.config.PrimaryKey, s.config.Fields),
+	}
+
+	documentsUrl := strings.TrimRight(s.config.Host, "/") + "/indexes/" + url.PathEscape(s.config.Index) +
+		"/documents?primaryKey=" + url.QueryEscape(s.config.PrimaryKey)
+
+	headers := map[string]string{}
+	if s.config.ApiKey != "" {
+		headers["Authorization"] = "Bearer " + s.config.ApiKey
+	}
+
+	return sendJson(s.httpClient, "PUT", documentsUrl, headers, docs)
+}
+
+func (s *meilisearchSink) Close() error {
+	return nil
+}
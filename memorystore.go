@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore is a Store kept entirely in memory. It backs dry runs and lets
+// a whole cycle run without a database.
+type memoryStore struct {
+	mu     sync.Mutex
+	posts  []Post
+	saved  map[int64]PostScraped
+	hashes map[int64]string
+	// modified is when a post's description or metadata last changed
+	modified map[int64]time.Time
+	attempts []ScrapeAttempt
+	audit    []AuditEntry
+	feeds    map[string]bool
+	outbox   []outboxEntry
+	// checkpoints are the last post ids saved by backfills
+	checkpoints map[string]int64
+	// permanentFailures are posts that are no longer picked up
+	permanentFailures map[int64]string
+	// duplicates map posts to the earlier post they duplicate
+	duplicates map[int64]int64
+	runs       []ScrapeRun
+	responses  map[int64]ResponseMetadata
+	brandings  map[string]SiteBranding
+}
+
+type outboxEntry struct {
+	post   Post
+	queued time.Time
+}
+
+func newMemoryStore(posts []Post) *memoryStore {
+	return &memoryStore{
+		posts:    posts,
+		saved:    make(map[int64]PostScraped),
+		hashes:   make(map[int64]string),
+		modified: make(map[int64]time.Time),
+		feeds:    make(map[string]bool),
+
+		duplicates:        make(map[int64]int64),
+		checkpoints:       make(map[string]int64),
+		permanentFailures: make(map[int64]string),
+		responses:         make(map[int64]ResponseMetadata),
+		brandings:         make(map[string]SiteBranding),
+	}
+}
+
+func (s *memoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// PostsToScrape ignores the filter's feeds, as posts added to a memoryStore
+// don't belong to one.
+func (s *memoryStore) PostsToScrape(ctx context.Context, filter PostFilter) ([]Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	posts := make([]Post, 0, len(s.posts))
+	for _, post := range s.posts {
+		if _, failed := s.permanentFailures[post.PostID]; failed {
+			continue
+		}
+
+		if filter.MissingDescription && post.OrigDescription != "" && post.Priority <= 0 {
+			continue
+		}
+
+		posts = append(posts, post)
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Priority > posts[j].Priority
+	})
+
+	return filter.byDomain(posts), nil
+}
+
+func (s *memoryStore) ClaimOutbox(ctx context.Context, limit int) ([]Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if limit > len(s.outbox) {
+		limit = len(s.outbox)
+	}
+
+	posts := make([]Post, 0, limit)
+	for _, entry := range s.outbox[:limit] {
+		posts = append(posts, entry.post)
+	}
+	s.outbox = s.outbox[limit:]
+
+	return posts, nil
+}
+
+func (s *memoryStore) ClearOutbox(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.outbox[:0]
+	for _, entry := range s.outbox {
+		if !entry.queued.Before(before) {
+			kept = append(kept, entry)
+		}
+	}
+	s.outbox = kept
+
+	return nil
+}
+
+// Insert adds a post as the aggregator would, queueing it in the outbox.
+func (s *memoryStore) Insert(post Post) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.posts = append(s.posts, post)
+	s.outbox = append(s.outbox, outboxEntry{post: post, queued: clock.Now()})
+}
+
+func (s *memoryStore) PostsAfterID(ctx context.Context, afterID int64, limit int) ([]Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	posts := make([]Post, 0)
+	for _, post := range s.posts {
+		if _, failed := s.permanentFailures[post.PostID]; failed {
+			continue
+		}
+
+		if post.PostID > afterID {
+			posts = append(posts, post)
+		}
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].PostID < posts[j].PostID
+	})
+
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+
+	return posts, nil
+}
+
+func (s *memoryStore) CountPostsAfterID(ctx context.Context, afterID int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, post := range s.posts {
+		if _, failed := s.permanentFailures[post.PostID]; failed {
+			continue
+		}
+
+		if post.PostID > afterID {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *memoryStore) MarkPermanentFailure(ctx context.Context, postID int64, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.permanentFailures[postID] = reason
+
+	return nil
+}
+
+func (s *memoryStore) LoadCheckpoint(ctx context.Context, name string) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lastPostID, ok := s.checkpoints[name]
+
+	return lastPostID, ok, nil
+}
+
+func (s *memoryStore) SaveCheckpoint(ctx context.Context, name string, lastPostID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints[name] = lastPostID
+
+	return nil
+}
+
+func (s *memoryStore) PostsByID(ctx context.Context, ids []int64) ([]Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	posts := make([]Post, 0, len(ids))
+	for _, post := range s.posts {
+		if wanted[post.PostID] {
+			posts = append(posts, post)
+		}
+	}
+
+	return posts, nil
+}
+
+func (s *memoryStore) SetPriority(ctx context.Context, postID int64, priority int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.posts {
+		if s.posts[i].PostID == postID {
+			s.posts[i].Priority = priority
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) StoredPosts(ctx context.Context, query StoredPostsQuery) ([]StoredPost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[int64]bool, len(query.IDs))
+	for _, id := range query.IDs {
+		wanted[id] = true
+	}
+
+	posts := make([]StoredPost, 0)
+	for _, post := range s.posts {
+		scraped, saved := s.saved[post.PostID]
+		description := post.OrigDescription
+		if saved {
+			description = scraped.description()
+		}
+
+		modified := s.modified[post.PostID]
+
+		if post.PostID <= query.AfterID || (len(wanted) > 0 && !wanted[post.PostID]) ||
+			(!query.ModifiedSince.IsZero() && (!saved || modified.Before(query.ModifiedSince))) ||
+			(query.WithDescription && description == "") {
+			continue
+		}
+
+		stored := StoredPost{Post: post, Description: description}
+		if saved {
+			stored.Modified = modified
+			stored.Title = scraped.OpenGraphTags.Title
+			stored.FeaturedImage = scraped.OpenGraphTags.FeaturedImage
+			stored.Language = scraped.OpenGraphTags.Language
+			stored.Metadata = scraped.OpenGraphTags.postMetadata()
+			if query.WithContent {
+				stored.Content = scraped.Html
+			}
+		}
+
+		posts = append(posts, stored)
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Post.PostID < posts[j].Post.PostID
+	})
+
+	if query.Limit > 0 && len(posts) > query.Limit {
+		posts = posts[:query.Limit]
+	}
+
+	return posts, nil
+}
+
+func (s *memoryStore) SaveMetadata(ctx context.Context, scraped PostScraped, opts SaveOptions) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hashes[scraped.Post.PostID] == scraped.contentHash(opts) {
+		return false, nil
+	}
+
+	candidates := make([]duplicateCandidate, 0)
+	for postID, saved := range s.saved {
+		if saved.OpenGraphTags.Simhash != 0 {
+			candidates = append(candidates, duplicateCandidate{
+				postID:      postID,
+				simhash:     saved.OpenGraphTags.Simhash,
+				duplicateOf: s.duplicates[postID],
+			})
+		}
+	}
+
+	delete(s.duplicates, scraped.Post.PostID)
+	if fingerprint := scraped.OpenGraphTags.Simhash; fingerprint != 0 {
+		if canonical := canonicalPost(scraped.Post.PostID, fingerprint, candidates); canonical != 0 {
+			s.duplicates[scraped.Post.PostID] = canonical
+		}
+	}
+
+	// like the db, modified only moves when the description or metadata do
+	previous, ok := s.saved[scraped.Post.PostID]
+	if !ok || previous.description() != scraped.description() ||
+		previous.OpenGraphTags.metadataJson() != scraped.OpenGraphTags.metadataJson() {
+		s.modified[scraped.Post.PostID] = clock.Now().UTC().Truncate(time.Second)
+	}
+
+	s.saved[scraped.Post.PostID] = scraped
+
+	return true, nil
+}
+
+func (s *memoryStore) SaveContentHash(ctx context.Context, postID int64, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hashes[postID] = hash
+
+	return nil
+}
+
+func (s *memoryStore) RecordAttempt(ctx context.Context, attempt ScrapeAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts = append(s.attempts, attempt)
+
+	return nil
+}
+
+func (s *memoryStore) SaveDiscoveredFeeds(ctx context.Context, post Post, feeds []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newFeeds := make([]string, 0)
+	for _, feed := range feeds {
+		if !s.feeds[feed] {
+			s.feeds[feed] = true
+			newFeeds = append(newFeeds, feed)
+		}
+	}
+
+	return newFeeds, nil
+}
+
+func (s *memoryStore) Migrate(ctx context.Context) error {
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+func (s *memoryStore) RecordAudit(ctx context.Context, entry AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.audit = append(s.audit, entry)
+
+	return nil
+}
+
+func (s *memoryStore) AuditTrail(ctx context.Context, postID int64, limit int) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]AuditEntry, 0)
+	for i := len(s.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		if s.audit[i].PostID == postID {
+			entries = append(entries, s.audit[i])
+		}
+	}
+
+	return entries, nil
+}
+
+func (s *memoryStore) AttemptsSince(ctx context.Context, since time.Time) ([]ScrapeAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := make([]ScrapeAttempt, 0)
+	for _, attempt := range s.attempts {
+		if !attempt.Attempted.Before(since) {
+			attempts = append(attempts, attempt)
+		}
+	}
+
+	return attempts, nil
+}
+
+// Saved returns what was saved for a post, if anything.
+func (s *memoryStore) Saved(postID int64) (PostScraped, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scraped, ok := s.saved[postID]
+
+	return scraped, ok
+}
+
+// Attempts returns every recorded scrape attempt in order.
+func (s *memoryStore) Attempts() []ScrapeAttempt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]ScrapeAttempt(nil), s.attempts...)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreModifiedSince(t *testing.T) {
+	manual := useManualClock(t)
+
+	ctx := context.Background()
+	posts := []Post{{PostID: 1}, {PostID: 2}}
+	store := newMemoryStore(posts)
+
+	for _, post := range posts {
+		scraped := PostScraped{Post: post, OpenGraphTags: OpenGraphTags{Description: "first"}}
+		if _, err := store.SaveMetadata(ctx, scraped, SaveOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manual.Advance(time.Hour)
+	since := clock.Now()
+
+	// post 1 is saved again unchanged, post 2 with a new description
+	unchanged := PostScraped{Post: posts[0], OpenGraphTags: OpenGraphTags{Description: "first"}}
+	changed := PostScraped{Post: posts[1], OpenGraphTags: OpenGraphTags{Description: "second"}}
+	for _, scraped := range []PostScraped{unchanged, changed} {
+		if _, err := store.SaveMetadata(ctx, scraped, SaveOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, err := store.StoredPosts(ctx, StoredPostsQuery{ModifiedSince: since})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stored) != 1 || stored[0].Post.PostID != 2 {
+		t.Fatalf("StoredPosts returned %d posts, want only post 2", len(stored))
+	}
+	if !stored[0].Modified.Equal(since) {
+		t.Errorf("Modified = %v, want %v", stored[0].Modified, since)
+	}
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/html"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ArticleMetadata struct {
+	PublishedTime string   `json:"published_time,omitempty"`
+	ModifiedTime  string   `json:"modified_time,omitempty"`
+	Authors       []string `json:"authors,omitempty"`
+	Section       string   `json:"section,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// MediaMetadata describes an og:video or og:audio. Only the first one a page
+// declares is kept.
+type MediaMetadata struct {
+	Url       string `json:"url,omitempty"`
+	SecureUrl string `json:"secure_url,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Width     string `json:"width,omitempty"`
+	Height    string `json:"height,omitempty"`
+}
+
+type DublinCoreMetadata struct {
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Creators    []string `json:"creators,omitempty"`
+}
+
+// PostMetadata is stored as json in posts.metadata.
+type PostMetadata struct {
+	Article    *ArticleMetadata    `json:"article,omitempty"`
+	DublinCore *DublinCoreMetadata `json:"dublin_core,omitempty"`
+	Keywords   []string            `json:"keywords,omitempty"`
+	Video      *MediaMetadata      `json:"video,omitempty"`
+	Audio      *MediaMetadata      `json:"audio,omitempty"`
+	Locale     string              `json:"locale,omitempty"`
+	FromAmp    bool                `json:"from_amp,omitempty"`
+	ArchivedAt string              `json:"archived_at,omitempty"`
+	Icon       string              `json:"icon,omitempty"`
+	ThemeColor string              `json:"theme_color,omitempty"`
+	TileColor  string              `json:"tile_color,omitempty"`
+	TileImage  string              `json:"tile_image,omitempty"`
+	Canonical  string              `json:"canonical_url,omitempty"`
+	Image      *ImageMetadata      `json:"image,omitempty"`
+	// OgType is only kept for the types that aren't handled as articles
+	OgType       string                `json:"og_type,omitempty"`
+	VideoDetails *VideoDetailsMetadata `json:"video_details,omitempty"`
+	Music        *MusicMetadata        `json:"music,omitempty"`
+	Profile      *ProfileMetadata      `json:"profile,omitempty"`
+}
+
+type ImageMetadata struct {
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Format string `json:"format,omitempty"`
+}
+
+var articleTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// metaKeyAndContent returns the property (or name) of a meta tag and its
+// content.
+func metaKeyAndContent(token html.Token) (string, string) {
+	property, name, content := "", "", ""
+	for _, attr := range token.Attr {
+		switch attr.Key {
+		case "property":
+			property = attr.Val
+		case "name":
+			name = attr.Val
+		case "content":
+			content = attr.Val
+		}
+	}
+
+	if property != "" {
+		return property, content
+	}
+
+	return name, content
+}
+
+// MetaTagsBlob is stored as json in posts.meta_tags when storeMetaTags is
+// enabled, so new fields can be derived later without re-scraping.
+type MetaTagsBlob struct {
+	Meta   map[string][]string `json:"meta"`
+	JsonLd []json.RawMessage   `json:"json_ld,omitempty"`
+}
+
+func isJsonLdScript(token html.Token) bool {
+	return strings.EqualFold(strings.TrimSpace(attrValue(token, "type")), "application/ld+json")
+}
+
+// setText handles the text content of the elements the parser asked for.
+func (t *OpenGraphTags) setText(element string, text string) {
+	switch element {
+	case "title":
+		// only the first title counts, svg images can have their own
+		t.addCandidate("title", sourceHtml, text)
+	case "script":
+		t.addJsonLd(text)
+	case "h1":
+		t.heading += text
+	case "p":
+		t.paragraphs[len(t.paragraphs)-1] += text
+	}
+}
+
+func (t *OpenGraphTags) setLink(token html.Token) {
+	href := attrValue(token, "href")
+	if href == "" {
+		return
+	}
+
+	for _, rel := range strings.Fields(strings.ToLower(attrValue(token, "rel"))) {
+		if isFeedLink(rel, attrValue(token, "type")) {
+			t.Feeds = append(t.Feeds, href)
+			continue
+		}
+
+		switch rel {
+		case "canonical":
+			t.Canonical = href
+			t.setSource("canonical_url", sourceLink, href)
+		case "amphtml":
+			t.AmpUrl = href
+		case "alternate":
+			t.addAlternate(attrValue(token, "hreflang"), href)
+		case "icon", "apple-touch-icon", "apple-touch-icon-precomposed":
+			t.icons = append(t.icons, iconLink{Href: href, Rel: rel, Sizes: attrValue(token, "sizes")})
+		}
+	}
+}
+
+func (t *OpenGraphTags) addJsonLd(text string) {
+	text = strings.TrimSpace(text)
+	if !json.Valid([]byte(text)) {
+		return
+	}
+
+	t.JsonLd = append(t.JsonLd, json.RawMessage(text))
+}
+
+func attrValue(token html.Token, key string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+
+	return ""
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func nullInt(value int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(value), Valid: value != 0}
+}
+
+func (t *OpenGraphTags) setMetaTag(key string, content string) {
+	if t.MetaTags == nil {
+		t.MetaTags = make(map[string][]string)
+	}
+	t.MetaTags[key] = append(t.MetaTags[key], content)
+
+	switch strings.ToLower(key) {
+	case "og:title":
+		t.addCandidate("title", sourceOg, content)
+	case "og:description":
+		t.addCandidate("description", sourceOg, content)
+	case "og:image", "og:image:url", "og:image:secure_url":
+		t.addCandidate("featured_image", sourceOg, content)
+	case "twitter:title":
+		t.addCandidate("title", sourceTwitter, content)
+	case "twitter:description":
+		t.addCandidate("description", sourceTwitter, content)
+	case "twitter:image", "twitter:image:src":
+		t.addCandidate("featured_image", sourceTwitter, content)
+	case "description":
+		t.addCandidate("description", sourceMeta, content)
+	case "og:image:width":
+		t.ImageWidth, _ = strconv.Atoi(strings.TrimSpace(content))
+	case "og:image:height":
+		t.ImageHeight, _ = strconv.Atoi(strings.TrimSpace(content))
+	case "og:video", "og:video:url", "og:video:secure_url", "og:video:type", "og:video:width", "og:video:height":
+		t.Video.set(strings.TrimPrefix(strings.ToLower(key), "og:video"), content)
+	case "og:audio", "og:audio:url", "og:audio:secure_url", "og:audio:type":
+		t.Audio.set(strings.TrimPrefix(strings.ToLower(key), "og:audio"), content)
+	case "og:url":
+		t.Url = content
+		t.setSource("url", sourceOg, content)
+	case "og:locale":
+		t.Locale = content
+	case "article:published_time":
+		t.Article.PublishedTime = normalizeArticleTime(content)
+	case "article:modified_time":
+		t.Article.ModifiedTime = normalizeArticleTime(content)
+	case "article:author":
+		if content != "" {
+			t.Article.Authors = append(t.Article.Authors, content)
+		}
+	case "article:section":
+		t.Article.Section = content
+	case "article:tag":
+		if content != "" {
+			t.Article.Tags = append(t.Article.Tags, content)
+		}
+	case "dc.title", "dcterms.title":
+		t.DublinCore.Title = content
+	case "dc.description", "dcterms.description", "dcterms.abstract":
+		t.DublinCore.Description = content
+		t.addCandidate("description", sourceDublinCore, content)
+	case "dc.creator", "dcterms.creator":
+		if content != "" {
+			t.DublinCore.Creators = append(t.DublinCore.Creators, content)
+		}
+	case "keywords":
+		t.Keywords = append(t.Keywords, splitKeywords(content)...)
+	case "rating", "rta", "pics-label":
+		t.setRating(content)
+	case "og:type":
+		t.Type = content
+	case "og:site_name":
+		t.SiteName = strings.TrimSpace(content)
+	case "theme-color":
+		// only the first, the others being for dark mode and the like
+		if t.ThemeColor == "" {
+			t.ThemeColor = normalizeThemeColor(content)
+		}
+	case "msapplication-tilecolor":
+		t.TileColor = normalizeThemeColor(content)
+	case "msapplication-tileimage":
+		t.tileImageHref = strings.TrimSpace(content)
+	default:
+		t.setTypedTag(strings.ToLower(key), content)
+	}
+}
+
+// set applies a structured og:video or og:audio property, given without its
+// prefix, keeping the values of the first media declared.
+func (m *MediaMetadata) set(property string, content string) {
+	switch property {
+	case "", ":url":
+		if m.Url == "" {
+			m.Url = content
+		}
+	case ":secure_url":
+		if m.SecureUrl == "" {
+			m.SecureUrl = content
+		}
+	case ":type":
+		if m.Type == "" {
+			m.Type = content
+		}
+	case ":width":
+		if m.Width == "" {
+			m.Width = content
+		}
+	case ":height":
+		if m.Height == "" {
+			m.Height = content
+		}
+	}
+}
+
+func (m MediaMetadata) empty() bool {
+	return m.Url == "" && m.SecureUrl == ""
+}
+
+func splitKeywords(content string) []string {
+	keywords := make([]string, 0)
+	for _, keyword := range strings.FieldsFunc(content, func(r rune) bool { return r == ',' || r == ';' }) {
+		keyword = strings.TrimSpace(keyword)
+		if keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+
+	return keywords
+}
+
+// applyFallbacks fills in fields the page has no opengraph tags for from
+// older metadata standards.
+func (t *OpenGraphTags) applyFallbacks() {
+	if len(t.Article.Authors) == 0 && len(t.DublinCore.Creators) > 0 {
+		t.Article.Authors = append([]string(nil), t.DublinCore.Creators...)
+	}
+}
+
+func (t OpenGraphTags) empty() bool {
+	return t.Description == "" && t.FeaturedImage == "" && t.Article.empty() && t.DublinCore.empty() &&
+		len(t.Keywords) == 0 && t.Video.empty() && t.Audio.empty()
+}
+
+// hasUsableMetadata reports whether the page gave us anything worth showing.
+func (t OpenGraphTags) hasUsableMetadata() bool {
+	return t.Description != "" || t.FeaturedImage != ""
+}
+
+func (d DublinCoreMetadata) empty() bool {
+	return d.Title == "" && d.Description == "" && len(d.Creators) == 0
+}
+
+func (a ArticleMetadata) empty() bool {
+	return a.PublishedTime == "" && a.ModifiedTime == "" && len(a.Authors) == 0 &&
+		a.Section == "" && len(a.Tags) == 0
+}
+
+// normalizeArticleTime converts the times sites publish into utc RFC3339,
+// keeping the original value when it cannot be parsed.
+func normalizeArticleTime(value string) string {
+	for _, format := range articleTimeFormats {
+		t, err := time.Parse(format, value)
+		if err == nil {
+			return t.UTC().Format(time.RFC3339)
+		}
+	}
+
+	return value
+}
+
+// metadataJson encodes the metadata column, which is left NULL when there is
+// nothing to store.
+func (t OpenGraphTags) metadataJson() sql.NullString {
+	encoded, err := json.Marshal(t.postMetadata())
+	if err != nil {
+		fmt.Println("could not encode post metadata", err.Error())
+		return sql.NullString{}
+	}
+
+	if string(encoded) == "{}" {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: string(encoded), Valid: true}
+}
+
+func (t OpenGraphTags) postMetadata() PostMetadata {
+	metadata := PostMetadata{
+		Locale:     t.Locale,
+		FromAmp:    t.FromAmp,
+		ArchivedAt: t.ArchivedAt,
+		Icon:       t.Icon,
+		ThemeColor: t.ThemeColor,
+		TileColor:  t.TileColor,
+		TileImage:  t.TileImage,
+		Canonical:  t.canonicalUrl(),
+	}
+
+	if !t.Article.empty() {
+		article := t.Article
+		metadata.Article = &article
+	}
+
+	if !t.DublinCore.empty() {
+		dublinCore := t.DublinCore
+		metadata.DublinCore = &dublinCore
+	}
+
+	if len(t.Keywords) > 0 {
+		metadata.Keywords = t.Keywords
+	}
+
+	if t.FeaturedImage != "" && (t.ImageWidth > 0 || t.ImageFormat != "") {
+		metadata.Image = &ImageMetadata{Width: t.ImageWidth, Height: t.ImageHeight, Format: t.ImageFormat}
+	}
+
+	if !t.Video.empty() {
+		video := t.Video
+		metadata.Video = &video
+	}
+
+	if !t.Audio.empty() {
+		audio := t.Audio
+		metadata.Audio = &audio
+	}
+
+	t.addTypedMetadata(&metadata)
+
+	return metadata
+}
+
+func (t OpenGraphTags) metaTagsJson() sql.NullString {
+	if len(t.MetaTags) == 0 && len(t.JsonLd) == 0 {
+		return sql.NullString{}
+	}
+
+	encoded, err := json.Marshal(MetaTagsBlob{Meta: t.MetaTags, JsonLd: t.JsonLd})
+	if err != nil {
+		fmt.Println("could not encode meta tags", err.Error())
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: string(encoded), Valid: true}
+}
+
+// contentHash fingerprints the values a scrape writes to the post, so a
+// re-scrape that extracted the same values can skip the write.
+func (scraped PostScraped) contentHash(opts SaveOptions) string {
+	hash := sha256.New()
+
+	// a generated description is worded differently every time it's
+	// generated, so it mustn't make an unchanged page look changed
+	description := scraped.description()
+	if scraped.OpenGraphTags.Sources["description"].Source == llmEnricherName {
+		description = llmEnricherName
+	}
+
+	values := []string{
+		description,
+		scraped.OpenGraphTags.FeaturedImage,
+		scraped.OpenGraphTags.metadataJson().String,
+		scraped.OpenGraphTags.Language,
+		scraped.OpenGraphTags.Direction,
+	}
+
+	if opts.StoreMetaTags {
+		values = append(values, scraped.OpenGraphTags.metaTagsJson().String)
+	}
+
+	values = append(values, fmt.Sprint(scraped.OpenGraphTags.Nsfw), fmt.Sprint(scraped.OpenGraphTags.Simhash))
+	values = append(values, fmt.Sprint(scraped.OpenGraphTags.WordCount))
+	values = append(values, scraped.OpenGraphTags.Tags...)
+	for _, alternate := range scraped.OpenGraphTags.Alternates {
+		values = append(values, alternate.Hreflang+" "+alternate.Url)
+	}
+
+	for _, value := range values {
+		hash.Write([]byte(value))
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// description is the scraped description, or the feed's when the page had
+// none.
+func (scraped PostScraped) description() string {
+	if scraped.OpenGraphTags.Description != "" {
+		return scraped.OpenGraphTags.Description
+	}
+
+	return scraped.Post.OrigDescription
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMetricsPrefix = "ogparser"
+
+// MetricsConfig pushes metrics to StatsD over udp, as they happen, and/or
+// to Graphite's plaintext port over tcp, summed up after every cycle.
+type MetricsConfig struct {
+	// Statsd and Graphite are host:port addresses
+	Statsd   string `json:"statsd"`
+	Graphite string `json:"graphite"`
+	Prefix   string `json:"prefix"`
+}
+
+type timingStats struct {
+	count int64
+	sum   time.Duration
+	max   time.Duration
+}
+
+type metricsPusher struct {
+	mu     sync.Mutex
+	config MetricsConfig
+	statsd net.Conn
+	// what has been recorded since the last push to graphite
+	counters map[string]int64
+	timings  map[string]*timingStats
+	gauges   map[string]float64
+}
+
+// metrics is configured by applyConfig. With nothing configured recording
+// is a no-op.
+var metrics = newMetricsPusher()
+
+func newMetricsPusher() *metricsPusher {
+	return &metricsPusher{
+		counters: make(map[string]int64),
+		timings:  make(map[string]*timingStats),
+		gauges:   make(map[string]float64),
+	}
+}
+
+// configure applies a (re)loaded config, reconnecting to statsd if its
+// address changed.
+func (m *metricsPusher) configure(config MetricsConfig) {
+	if config.Prefix == "" {
+		config.Prefix = defaultMetricsPrefix
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.statsd != nil && config.Statsd != m.config.Statsd {
+		_ = m.statsd.Close()
+		m.statsd = nil
+	}
+
+	if config.Statsd != "" && m.statsd == nil {
+		conn, err := net.Dial("udp", config.Statsd)
+		if err != nil {
+			fmt.Println("could not connect to statsd", err.Error())
+		} else {
+			m.statsd = conn
+		}
+	}
+
+	m.config = config
+}
+
+func (m *metricsPusher) count(name string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sendStatsd(name, fmt.Sprintf("%d|c", n))
+	if m.config.Graphite != "" {
+		m.counters[name] += n
+	}
+}
+
+func (m *metricsPusher) timing(name string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sendStatsd(name, fmt.Sprintf("%d|ms", d.Milliseconds()))
+	if m.config.Graphite != "" {
+		stats, ok := m.timings[name]
+		if !ok {
+			stats = &timingStats{}
+			m.timings[name] = stats
+		}
+
+		stats.count++
+		stats.sum += d
+		if d > stats.max {
+			stats.max = d
+		}
+	}
+}
+
+func (m *metricsPusher) gauge(name string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sendStatsd(name, fmt.Sprintf("%g|g", value))
+	if m.config.Graphite != "" {
+		m.gauges[name] = value
+	}
+}
+
+// sendStatsd writes a single sample, dropping it if statsd isn't listening.
+func (m *metricsPusher) sendStatsd(name string, value string) {
+	if m.statsd == nil {
+		return
+	}
+
+	_, _ = m.statsd.Write([]byte(m.config.Prefix + "." + name + ":" + value))
+}
+
+// push sends what was recorded since the last push to graphite. Counters and
+// timings start again from zero, gauges keep their last value.
+func (m *metricsPusher) push() {
+	m.mu.Lock()
+	config := m.config
+	lines := m.graphiteLines(clock.Now().Unix())
+	m.counters = make(map[string]int64)
+	m.timings = make(map[string]*timingStats)
+	m.mu.Unlock()
+
+	if config.Graphite == "" || len(lines) == 0 {
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", config.Graphite, 5*time.Second)
+	if err != nil {
+		fmt.Println("could not connect to graphite", err.Error())
+		return
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Write([]byte(strings.Join(lines, "")))
+	if err != nil {
+		fmt.Println("could not push metrics to graphite", err.Error())
+	}
+}
+
+func (m *metricsPusher) graphiteLines(timestamp int64) []string {
+	lines := make([]string, 0, len(m.counters)+3*len(m.timings)+len(m.gauges))
+	line := func(name string, value string) {
+		lines = append(lines, fmt.Sprintf("%s.%s %s %d\n", m.config.Prefix, name, value, timestamp))
+	}
+
+	for name, value := range m.counters {
+		line(name, fmt.Sprint(value))
+	}
+
+	for name, stats := range m.timings {
+		line(name+".count", fmt.Sprint(stats.count))
+		line(name+".mean_ms", fmt.Sprint((stats.sum / time.Duration(stats.count)).Milliseconds()))
+		line(name+".max_ms", fmt.Sprint(stats.max.Milliseconds()))
+	}
+
+	for name, value := range m.gauges {
+		line(name, fmt.Sprintf("%g", value))
+	}
+
+	sort.Strings(lines)
+
+	return lines
+}
+
+// metricName turns a tenant, domain or sink name into a single metric path
+// segment.
+func metricName(name string) string {
+	var b bytes.Buffer
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	return b.String()
+}
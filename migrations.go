@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles are applied in version order. Each dialect has its own
+// directory, so a schema change needs a file in both.
+//
+//go:embed migrations/mysql/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+func loadMigrations(dialectName string) ([]migration, error) {
+	dir := path.Join("migrations", dialectName)
+
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no version prefix", entry.Name())
+		}
+
+		contents, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration{version: version, name: name, sql: string(contents)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+// migrate applies every migration that has not been recorded in
+// schema_migrations yet. mysql can't roll back ddl, so a failed migration
+// has to be fixed by hand before re-running.
+func migrate(ctx context.Context, db *sql.DB, dialect sqlDialect) error {
+	_, err := db.ExecContext(ctx,
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version INT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied VARCHAR(19) NOT NULL)",
+	)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	migrations, err := loadMigrations(dialect.name)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		fmt.Println("Applying migration", m.name)
+
+		for _, stmt := range splitSqlStatements(m.sql) {
+			_, err = db.ExecContext(ctx, stmt)
+			if err != nil {
+				return fmt.Errorf("applying migration %s: %w", m.name, err)
+			}
+		}
+
+		_, err = db.ExecContext(
+			ctx,
+			"INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)",
+			m.version,
+			m.name,
+			clock.Now().UTC().Format("2006-01-02 15:04:05"),
+		)
+		if err != nil {
+			return fmt.Errorf("recording migration %s: %w", m.name, err)
+		}
+	}
+
+	return nil
+}
+
+func appliedMigrations(ctx context.Context, db *sql.DB) (map[int]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		err = rows.Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// splitSqlStatements splits a migration into statements, as the mysql driver
+// runs one statement per Exec. Trigger bodies wrapped in BEGIN ... END are
+// kept together.
+func splitSqlStatements(contents string) []string {
+	statements := make([]string, 0)
+	pending := ""
+	for _, stmt := range strings.Split(contents, ";") {
+		lines := strings.Split(stmt, "\n")
+		kept := make([]string, 0, len(lines))
+		for _, line := range lines {
+			if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+				kept = append(kept, line)
+			}
+		}
+
+		pending += strings.Join(kept, "\n")
+		if inTriggerBody(pending) {
+			pending += ";"
+			continue
+		}
+
+		stmt = strings.TrimSpace(pending)
+		pending = ""
+		if stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+
+	if stmt := strings.TrimSpace(pending); stmt != "" {
+		statements = append(statements, stmt)
+	}
+
+	return statements
+}
+
+// inTriggerBody reports whether stmt is a CREATE TRIGGER whose BEGIN has not
+// been closed by an END yet.
+func inTriggerBody(stmt string) bool {
+	fields := strings.Fields(strings.ToUpper(stmt))
+	if len(fields) < 2 || fields[0] != "CREATE" || fields[1] != "TRIGGER" {
+		return false
+	}
+
+	opened := false
+	for _, field := range fields {
+		if field == "BEGIN" {
+			opened = true
+		}
+	}
+
+	return opened && fields[len(fields)-1] != "END"
+}
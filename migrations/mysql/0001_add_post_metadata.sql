@@ -0,0 +1,2 @@
+-- structured metadata extracted from the page, such as article:* properties
+ALTER TABLE posts ADD COLUMN metadata JSON NULL;
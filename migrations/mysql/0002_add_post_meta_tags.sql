@@ -0,0 +1,2 @@
+-- every meta tag and json-ld block found on the page, written when storeMetaTags is enabled
+ALTER TABLE posts ADD COLUMN meta_tags JSON NULL;
@@ -0,0 +1,3 @@
+-- primary language subtag of the page, e.g. en or ja
+ALTER TABLE posts ADD COLUMN language VARCHAR(8) NULL;
+CREATE INDEX idx_posts_language ON posts (language);
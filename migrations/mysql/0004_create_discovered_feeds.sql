@@ -0,0 +1,9 @@
+-- feeds advertised by aggregated pages through rss/atom autodiscovery
+CREATE TABLE discovered_feeds (
+  pk_discovered_feed_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  url VARCHAR(767) NOT NULL,
+  fk_post_id INT UNSIGNED NOT NULL,
+  discovered DATETIME NOT NULL,
+  PRIMARY KEY (pk_discovered_feed_id),
+  UNIQUE KEY uq_discovered_feeds_url (url)
+) DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,11 @@
+-- one row per post per cycle that tried to scrape it
+CREATE TABLE scrape_attempts (
+  pk_scrape_attempt_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  fk_post_id INT UNSIGNED NOT NULL,
+  attempted DATETIME NOT NULL,
+  status_code SMALLINT NOT NULL DEFAULT 0,
+  error TEXT NULL,
+  success TINYINT(1) NOT NULL,
+  PRIMARY KEY (pk_scrape_attempt_id),
+  KEY idx_scrape_attempts_post (fk_post_id, attempted)
+) DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,14 @@
+-- new posts are queued here by a trigger so they can be scraped within
+-- seconds instead of waiting for the next cycle
+-- (with binary logging on, creating the trigger needs SUPER or
+-- log_bin_trust_function_creators)
+CREATE TABLE post_outbox (
+  pk_post_outbox_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  fk_post_id INT UNSIGNED NOT NULL,
+  created DATETIME NOT NULL,
+  PRIMARY KEY (pk_post_outbox_id),
+  KEY idx_post_outbox_created (created)
+) DEFAULT CHARSET=utf8mb4;
+
+CREATE TRIGGER posts_after_insert_outbox AFTER INSERT ON posts FOR EACH ROW
+  INSERT INTO post_outbox (fk_post_id, created) VALUES (NEW.pk_post_id, UTC_TIMESTAMP());
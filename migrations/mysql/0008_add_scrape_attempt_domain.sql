@@ -0,0 +1,3 @@
+-- per-domain success rates and latency for the stats command
+ALTER TABLE scrape_attempts ADD COLUMN domain VARCHAR(255) NULL, ADD COLUMN duration_ms INT UNSIGNED NULL;
+CREATE INDEX idx_scrape_attempts_domain ON scrape_attempts (domain, attempted);
@@ -0,0 +1,7 @@
+-- the last post id each named backfill has processed, so it can resume
+CREATE TABLE backfill_checkpoints (
+  name VARCHAR(64) NOT NULL,
+  last_post_id INT UNSIGNED NOT NULL,
+  updated DATETIME NOT NULL,
+  PRIMARY KEY (name)
+) DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,2 @@
+-- why a post's page can never be scraped (e.g. 410 Gone), so it isn't retried
+ALTER TABLE posts ADD COLUMN permanent_failure VARCHAR(255) NULL;
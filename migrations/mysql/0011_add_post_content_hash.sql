@@ -0,0 +1,2 @@
+-- sha256 of the values last saved by the parser, to skip unchanged re-scrapes
+ALTER TABLE posts ADD COLUMN content_hash CHAR(64) NULL;
@@ -0,0 +1,7 @@
+-- keywords extracted from the article text of posts by the keywords enricher
+CREATE TABLE post_tags (
+  fk_post_id INT UNSIGNED NOT NULL,
+  tag VARCHAR(255) NOT NULL,
+  PRIMARY KEY (fk_post_id, tag),
+  KEY idx_post_tags_tag (tag)
+) DEFAULT CHARSET=utf8mb4;
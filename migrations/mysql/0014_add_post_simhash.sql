@@ -0,0 +1,12 @@
+-- fingerprints of article text, to flag syndicated and cross-posted copies
+ALTER TABLE posts
+  ADD COLUMN simhash BIGINT NULL,
+  ADD COLUMN duplicate_of INT UNSIGNED NULL;
+
+CREATE TABLE post_simhash_bands (
+  fk_post_id INT UNSIGNED NOT NULL,
+  band TINYINT UNSIGNED NOT NULL,
+  value SMALLINT UNSIGNED NOT NULL,
+  PRIMARY KEY (fk_post_id, band),
+  KEY idx_post_simhash_bands_value (band, value)
+);
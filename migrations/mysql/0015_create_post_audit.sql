@@ -0,0 +1,12 @@
+-- what happened to a post each time it was scraped, when auditLog is enabled
+CREATE TABLE post_audit (
+  pk_post_audit_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  fk_post_id INT UNSIGNED NOT NULL,
+  created DATETIME NOT NULL,
+  status_code SMALLINT NOT NULL DEFAULT 0,
+  bytes INT UNSIGNED NOT NULL DEFAULT 0,
+  outcome VARCHAR(64) NOT NULL,
+  details TEXT,
+  PRIMARY KEY (pk_post_audit_id),
+  KEY idx_post_audit_post (fk_post_id, created)
+) DEFAULT CHARSET=utf8mb4;
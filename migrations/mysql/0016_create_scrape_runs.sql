@@ -0,0 +1,12 @@
+-- one row per cycle, for graphing throughput over time
+CREATE TABLE scrape_runs (
+  pk_scrape_run_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  started DATETIME NOT NULL,
+  finished DATETIME NOT NULL,
+  posts INT UNSIGNED NOT NULL DEFAULT 0,
+  saved INT UNSIGNED NOT NULL DEFAULT 0,
+  failed INT UNSIGNED NOT NULL DEFAULT 0,
+  error TEXT,
+  PRIMARY KEY (pk_scrape_run_id),
+  KEY idx_scrape_runs_started (started)
+) DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,14 @@
+-- the latest response to fetching each post's page, for debugging fetches
+-- and analytics about the sites we aggregate
+CREATE TABLE post_responses (
+  fk_post_id INT UNSIGNED NOT NULL,
+  status_code SMALLINT UNSIGNED NOT NULL,
+  final_url TEXT,
+  content_type VARCHAR(255),
+  content_length BIGINT,
+  server VARCHAR(255),
+  duration_ms INT UNSIGNED NOT NULL DEFAULT 0,
+  fetched DATETIME NOT NULL,
+  PRIMARY KEY (fk_post_id),
+  KEY idx_post_responses_fetched (fetched)
+) DEFAULT CHARSET=utf8mb4;
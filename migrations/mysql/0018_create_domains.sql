@@ -0,0 +1,9 @@
+-- the branding of each site, resolved from the pages scraped on it
+CREATE TABLE domains (
+  domain VARCHAR(255) NOT NULL,
+  site_name VARCHAR(255),
+  icon TEXT,
+  theme_color VARCHAR(32),
+  updated DATETIME NOT NULL,
+  PRIMARY KEY (domain)
+) DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,4 @@
+-- the msapplication tile sites declare, kept with their icon
+ALTER TABLE domains
+  ADD COLUMN tile_color VARCHAR(32) NULL,
+  ADD COLUMN tile_image TEXT NULL;
@@ -0,0 +1,4 @@
+-- for "5 min read" badges, counted from the article text
+ALTER TABLE posts
+  ADD COLUMN word_count INT UNSIGNED NULL,
+  ADD COLUMN reading_minutes SMALLINT UNSIGNED NULL;
@@ -0,0 +1,7 @@
+-- translations of posts, from their hreflang alternate links
+CREATE TABLE post_alternates (
+  fk_post_id INT UNSIGNED NOT NULL,
+  hreflang VARCHAR(35) NOT NULL,
+  url TEXT NOT NULL,
+  PRIMARY KEY (fk_post_id, hreflang)
+) DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,32 @@
+-- initial schema for running against a local sqlite database
+CREATE TABLE IF NOT EXISTS posts (
+  pk_post_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  fk_feed_id INTEGER,
+  link TEXT NOT NULL,
+  title TEXT,
+  description TEXT NOT NULL DEFAULT '',
+  content TEXT,
+  created TEXT NOT NULL DEFAULT (datetime('now')),
+  modified TEXT,
+  metadata TEXT,
+  meta_tags TEXT,
+  language TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_posts_created ON posts (created);
+CREATE INDEX IF NOT EXISTS idx_posts_language ON posts (language);
+
+CREATE TABLE IF NOT EXISTS files (
+  pk_file_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  fk_post_id INTEGER NOT NULL,
+  external_url TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_files_post ON files (fk_post_id);
+
+CREATE TABLE IF NOT EXISTS discovered_feeds (
+  pk_discovered_feed_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  url TEXT NOT NULL UNIQUE,
+  fk_post_id INTEGER NOT NULL,
+  discovered TEXT NOT NULL
+);
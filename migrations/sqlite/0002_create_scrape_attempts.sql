@@ -0,0 +1,11 @@
+-- one row per post per cycle that tried to scrape it
+CREATE TABLE scrape_attempts (
+  pk_scrape_attempt_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  fk_post_id INTEGER NOT NULL,
+  attempted TEXT NOT NULL,
+  status_code INTEGER NOT NULL DEFAULT 0,
+  error TEXT,
+  success INTEGER NOT NULL
+);
+
+CREATE INDEX idx_scrape_attempts_post ON scrape_attempts (fk_post_id, attempted);
@@ -0,0 +1,3 @@
+-- posts with a higher priority are scraped first
+ALTER TABLE posts ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX idx_posts_priority ON posts (priority, created);
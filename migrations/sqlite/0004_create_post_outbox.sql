@@ -0,0 +1,14 @@
+-- new posts are queued here by a trigger so they can be scraped within
+-- seconds instead of waiting for the next cycle
+CREATE TABLE post_outbox (
+  pk_post_outbox_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  fk_post_id INTEGER NOT NULL,
+  created TEXT NOT NULL
+);
+
+CREATE INDEX idx_post_outbox_created ON post_outbox (created);
+
+CREATE TRIGGER posts_after_insert_outbox AFTER INSERT ON posts FOR EACH ROW
+BEGIN
+  INSERT INTO post_outbox (fk_post_id, created) VALUES (NEW.pk_post_id, datetime('now'));
+END;
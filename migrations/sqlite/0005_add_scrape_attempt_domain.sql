@@ -0,0 +1,4 @@
+-- per-domain success rates and latency for the stats command
+ALTER TABLE scrape_attempts ADD COLUMN domain TEXT;
+ALTER TABLE scrape_attempts ADD COLUMN duration_ms INTEGER;
+CREATE INDEX idx_scrape_attempts_domain ON scrape_attempts (domain, attempted);
@@ -0,0 +1,6 @@
+-- the last post id each named backfill has processed, so it can resume
+CREATE TABLE backfill_checkpoints (
+  name TEXT NOT NULL PRIMARY KEY,
+  last_post_id INTEGER NOT NULL,
+  updated TEXT NOT NULL
+);
@@ -0,0 +1,8 @@
+-- keywords extracted from the article text of posts by the keywords enricher
+CREATE TABLE post_tags (
+  fk_post_id INTEGER NOT NULL,
+  tag TEXT NOT NULL,
+  PRIMARY KEY (fk_post_id, tag)
+);
+
+CREATE INDEX idx_post_tags_tag ON post_tags (tag);
@@ -0,0 +1,2 @@
+-- adult content, so the frontend can blur the post's thumbnail
+ALTER TABLE posts ADD COLUMN is_nsfw INTEGER NOT NULL DEFAULT 0;
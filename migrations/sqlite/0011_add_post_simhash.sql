@@ -0,0 +1,12 @@
+-- fingerprints of article text, to flag syndicated and cross-posted copies
+ALTER TABLE posts ADD COLUMN simhash INTEGER;
+ALTER TABLE posts ADD COLUMN duplicate_of INTEGER;
+
+CREATE TABLE post_simhash_bands (
+  fk_post_id INTEGER NOT NULL,
+  band INTEGER NOT NULL,
+  value INTEGER NOT NULL,
+  PRIMARY KEY (fk_post_id, band)
+);
+
+CREATE INDEX idx_post_simhash_bands_value ON post_simhash_bands (band, value);
@@ -0,0 +1,12 @@
+-- what happened to a post each time it was scraped, when auditLog is enabled
+CREATE TABLE post_audit (
+  pk_post_audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  fk_post_id INTEGER NOT NULL,
+  created TEXT NOT NULL,
+  status_code INTEGER NOT NULL DEFAULT 0,
+  bytes INTEGER NOT NULL DEFAULT 0,
+  outcome TEXT NOT NULL,
+  details TEXT
+);
+
+CREATE INDEX idx_post_audit_post ON post_audit (fk_post_id, created);
@@ -0,0 +1,12 @@
+-- one row per cycle, for graphing throughput over time
+CREATE TABLE scrape_runs (
+  pk_scrape_run_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  started TEXT NOT NULL,
+  finished TEXT NOT NULL,
+  posts INTEGER NOT NULL DEFAULT 0,
+  saved INTEGER NOT NULL DEFAULT 0,
+  failed INTEGER NOT NULL DEFAULT 0,
+  error TEXT
+);
+
+CREATE INDEX idx_scrape_runs_started ON scrape_runs (started);
@@ -0,0 +1,14 @@
+-- the latest response to fetching each post's page, for debugging fetches
+-- and analytics about the sites we aggregate
+CREATE TABLE post_responses (
+  fk_post_id INTEGER PRIMARY KEY,
+  status_code INTEGER NOT NULL,
+  final_url TEXT,
+  content_type TEXT,
+  content_length INTEGER,
+  server TEXT,
+  duration_ms INTEGER NOT NULL DEFAULT 0,
+  fetched TEXT NOT NULL
+);
+
+CREATE INDEX idx_post_responses_fetched ON post_responses (fetched);
@@ -0,0 +1,8 @@
+-- the branding of each site, resolved from the pages scraped on it
+CREATE TABLE domains (
+  domain TEXT PRIMARY KEY,
+  site_name TEXT,
+  icon TEXT,
+  theme_color TEXT,
+  updated TEXT NOT NULL
+);
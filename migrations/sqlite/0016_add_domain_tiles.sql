@@ -0,0 +1,3 @@
+-- the msapplication tile sites declare, kept with their icon
+ALTER TABLE domains ADD COLUMN tile_color TEXT;
+ALTER TABLE domains ADD COLUMN tile_image TEXT;
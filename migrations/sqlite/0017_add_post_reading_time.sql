@@ -0,0 +1,3 @@
+-- for "5 min read" badges, counted from the article text
+ALTER TABLE posts ADD COLUMN word_count INTEGER;
+ALTER TABLE posts ADD COLUMN reading_minutes INTEGER;
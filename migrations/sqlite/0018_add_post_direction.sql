@@ -0,0 +1,2 @@
+-- rtl or ltr, so the frontend can set the direction of descriptions
+ALTER TABLE posts ADD COLUMN direction TEXT;
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"strings"
+	"time"
+)
+
+const defaultMqttTopic = "abt/posts/{domain}/{post_id}"
+
+type MqttSinkConfig struct {
+	// Enabled turns the sink off without removing its settings. It is on
+	// whenever it is configured unless set to false.
+	Enabled  *bool  `json:"enabled"`
+	Broker   string `json:"broker"`
+	ClientID string `json:"clientId"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Topic may contain {post_id} and {domain}
+	Topic    string `json:"topic"`
+	Qos      byte   `json:"qos"`
+	Retained bool   `json:"retained"`
+}
+
+type mqttSink struct {
+	config MqttSinkConfig
+	client mqtt.Client
+}
+
+func newMqttSink(config MqttSinkConfig) (*mqttSink, error) {
+	if config.Topic == "" {
+		config.Topic = defaultMqttTopic
+	}
+
+	if config.ClientID == "" {
+		config.ClientID = "abt-og-parser"
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetAutoReconnect(true).
+		SetConnectTimeout(10 * time.Second)
+
+	client := mqtt.NewClient(opts)
+
+	token := client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		return nil, errors.New("timed out connecting to mqtt broker")
+	}
+
+	if token.Error() != nil {
+		return nil, token.Error()
+	}
+
+	return &mqttSink{config: config, client: client}, nil
+}
+
+func (s *mqttSink) Name() string {
+	return "mqtt"
+}
+
+func (s *mqttSink) Write(scraped PostScraped) error {
+	payload, err := json.Marshal(newScrapedEvent(scraped))
+	if err != nil {
+		return err
+	}
+
+	topic := strings.NewReplacer(
+		"{post_id}", fmt.Sprint(scraped.Post.PostID),
+		"{domain}", routingKeyDomain(scraped.Post.Url),
+	).Replace(s.config.Topic)
+
+	token := s.client.Publish(topic, s.config.Qos, s.config.Retained, payload)
+	if !token.WaitTimeout(10 * time.Second) {
+		return errors.New("timed out publishing to mqtt broker")
+	}
+
+	return token.Error()
+}
+
+func (s *mqttSink) Close() error {
+	s.client.Disconnect(250)
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultNatsBatchSize = 100
+
+// NatsQueueConfig subscribes to a subject the aggregator publishes new post
+// ids to, one id per message, so they are scraped straight away. The polling
+// cycle keeps running as a catch-up.
+type NatsQueueConfig struct {
+	Url     string `json:"url"`
+	Subject string `json:"subject"`
+	// Group is the queue group shared by every parser instance, so each id is
+	// handled once.
+	Group     string `json:"group"`
+	BatchSize int    `json:"batchSize"`
+}
+
+type natsQueue struct {
+	config NatsQueueConfig
+	conn   *nats.Conn
+	sub    *nats.Subscription
+	msgs   chan *nats.Msg
+}
+
+func newNatsQueue(config NatsQueueConfig) (*natsQueue, error) {
+	if config.Subject == "" {
+		return nil, errors.New("nats.subject is required")
+	}
+
+	if config.Group == "" {
+		config.Group = "abt-og-parser"
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultNatsBatchSize
+	}
+
+	conn, err := nats.Connect(
+		config.Url,
+		nats.Name("abt-og-parser"),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2*time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &natsQueue{
+		config: config,
+		conn:   conn,
+		msgs:   make(chan *nats.Msg, config.BatchSize*4),
+	}
+
+	q.sub, err = conn.ChanQueueSubscribe(config.Subject, config.Group, q.msgs)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// openNatsQueue returns nil when no nats url is configured.
+func openNatsQueue(config NatsQueueConfig) *natsQueue {
+	if config.Url == "" {
+		return nil
+	}
+
+	q, err := newNatsQueue(config)
+	if err != nil {
+		fmt.Println("could not subscribe to nats, relying on polling", err.Error())
+		reportPhaseError("nats", err)
+		return nil
+	}
+
+	fmt.Println("Subscribed to nats subject", config.Subject)
+
+	return q
+}
+
+// messages is nil, and never receives, for a nil queue.
+func (q *natsQueue) messages() <-chan *nats.Msg {
+	if q == nil {
+		return nil
+	}
+
+	return q.msgs
+}
+
+// postIDs parses first and whatever else is already waiting, up to the batch
+// size.
+func (q *natsQueue) postIDs(first *nats.Msg) []int64 {
+	ids := make([]int64, 0, q.config.BatchSize)
+
+	msg := first
+	for {
+		id, err := strconv.ParseInt(strings.TrimSpace(string(msg.Data)), 10, 64)
+		if err != nil {
+			fmt.Println("ignoring nats message that is not a post id", string(msg.Data))
+		} else {
+			ids = append(ids, id)
+		}
+
+		if len(ids) >= q.config.BatchSize {
+			return ids
+		}
+
+		select {
+		case msg = <-q.msgs:
+		default:
+			return ids
+		}
+	}
+}
+
+func (q *natsQueue) Close() error {
+	if q == nil {
+		return nil
+	}
+
+	return q.conn.Drain()
+}
+
+// scrapeQueuedPosts scrapes the posts whose ids were received from nats.
+func scrapeQueuedPosts(store Store, config AppConfig, sinks []Sink, ids []int64) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println("Recovered in nats", r)
+			reportPanic("nats", r)
+		}
+	}()
+
+	ctx := context.Background()
+
+	posts, err := store.PostsByID(ctx, ids)
+	if err != nil {
+		fmt.Println("could not load posts received from nats", err.Error())
+		reportPhaseError("nats", err)
+		return
+	}
+
+	fmt.Println("scraping", len(posts), "posts received from nats")
+	scrapePosts(ctx, store, config, sinks, posts, nil)
+}
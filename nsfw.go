@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// rtaLabel is the Restricted To Adults label adult sites put in a rating
+	// meta tag.
+	rtaLabel = "rta-5042-1996-1400-1577-rta"
+
+	defaultNsfwClassifierTimeout   = 10 * time.Second
+	defaultNsfwClassifierThreshold = 0.8
+	nsfwEnricherName               = "nsfw"
+)
+
+// adultRatings are rating meta tag values that mark a page as adult content.
+var adultRatings = []string{"adult", "mature", "restricted", "explicit", "porn", rtaLabel}
+
+// NsfwConfig configures the nsfw enricher, which flags posts that the page's
+// rating tags don't.
+type NsfwConfig struct {
+	// Keywords flag a post when one appears as a word in its title,
+	// description or keywords.
+	Keywords []string `json:"keywords"`
+	// Classifier is the url of an image classification service. It's posted
+	// {"url": "<featured image>"} and answers {"nsfw": <score from 0 to 1>}.
+	Classifier string  `json:"classifier"`
+	Threshold  float64 `json:"threshold"`
+	Timeout    string  `json:"timeout"`
+}
+
+// ImageClassifier scores how likely an image is to be adult content.
+type ImageClassifier interface {
+	NsfwScore(ctx context.Context, imageUrl string) (float64, error)
+}
+
+// setRating flags the page when a rating, rta or pics-label meta tag marks
+// it as adult content.
+func (t *OpenGraphTags) setRating(content string) {
+	content = strings.ToLower(strings.TrimSpace(content))
+
+	for _, rating := range adultRatings {
+		if content == rating || (rating == rtaLabel && strings.Contains(content, rtaLabel)) {
+			t.Nsfw = true
+			return
+		}
+	}
+}
+
+func init() {
+	registerEnricher(nsfwEnricherName, func(config AppConfig) (Enricher, error) {
+		return newNsfwEnricher(config.Nsfw), nil
+	})
+}
+
+type nsfwEnricher struct {
+	keywords   []string
+	classifier ImageClassifier
+	threshold  float64
+}
+
+func newNsfwEnricher(config NsfwConfig) *nsfwEnricher {
+	e := &nsfwEnricher{threshold: config.Threshold}
+
+	for _, keyword := range config.Keywords {
+		if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+			e.keywords = append(e.keywords, keyword)
+		}
+	}
+
+	if e.threshold <= 0 {
+		e.threshold = defaultNsfwClassifierThreshold
+	}
+
+	if config.Classifier != "" {
+		e.classifier = &httpImageClassifier{
+			url:        config.Classifier,
+			httpClient: &http.Client{Timeout: parseDurationOr(config.Timeout, defaultNsfwClassifierTimeout)},
+		}
+	}
+
+	return e
+}
+
+func (e *nsfwEnricher) Name() string {
+	return nsfwEnricherName
+}
+
+func (e *nsfwEnricher) Enrich(ctx context.Context, scraped *PostScraped) error {
+	tags := &scraped.OpenGraphTags
+	if tags.Nsfw {
+		return nil
+	}
+
+	if e.matchesKeyword(*tags) {
+		tags.Nsfw = true
+		return nil
+	}
+
+	if e.classifier == nil || tags.FeaturedImage == "" {
+		return nil
+	}
+
+	score, err := e.classifier.NsfwScore(ctx, tags.FeaturedImage)
+	if err != nil {
+		return fmt.Errorf("classifying image: %w", err)
+	}
+
+	tags.Nsfw = score >= e.threshold
+
+	return nil
+}
+
+func (e *nsfwEnricher) matchesKeyword(tags OpenGraphTags) bool {
+	if len(e.keywords) == 0 {
+		return false
+	}
+
+	text := strings.Join(append([]string{tags.Title, tags.Description}, tags.Keywords...), " ")
+
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), isWordSeparator) {
+		words[word] = true
+	}
+
+	for _, keyword := range e.keywords {
+		if words[keyword] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+}
+
+// httpImageClassifier asks a classification service about an image.
+type httpImageClassifier struct {
+	url        string
+	httpClient *http.Client
+}
+
+func (c *httpImageClassifier) NsfwScore(ctx context.Context, imageUrl string) (float64, error) {
+	body, err := json.Marshal(map[string]string{"url": imageUrl})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+
+	defer func(resp *http.Response) {
+		_ = resp.Body.Close()
+	}(resp)
+
+	if resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("classifier returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Nsfw float64 `json:"nsfw"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return 0, fmt.Errorf("decoding classifier response: %w", err)
+	}
+
+	return result.Nsfw, nil
+}
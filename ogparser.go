@@ -1,48 +1,179 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/go-sql-driver/mysql"
 	"golang.org/x/net/html"
 	"io"
-	"io/ioutil"
 	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 )
 
 type AppConfig struct {
 	Db DbConfig `json:"db"`
+	DbOutage DbOutageConfig `json:"dbOutage"`
 	Solr string `json:"solr"`
+	SolrEnabled *bool `json:"solrEnabled"`
+	SolrTimeout string `json:"solrTimeout"`
+	SolrSchema SolrSchemaConfig `json:"solrSchema"`
+	SolrCloud *SolrCloudConfig `json:"solrCloud"`
+	SinkSpill SinkSpillConfig `json:"sinkSpill"`
+	Sentry SentryConfig `json:"sentry"`
+	DebugAddr string `json:"debugAddr"`
+	AdminAddr string `json:"adminAddr"`
+	Interval string `json:"interval"`
+	StoreMetaTags bool `json:"storeMetaTags"`
+	SoftNotFoundPatterns []string `json:"softNotFoundPatterns"`
+	// softNotFound are the patterns compiled when the config was loaded
+	softNotFound []*regexp.Regexp
+	Cookies map[string]map[string]string `json:"cookies"`
+	AmpFallback bool `json:"ampFallback"`
+	WaybackFallback bool `json:"waybackFallback"`
+	FeedDiscovery FeedDiscoveryConfig `json:"feedDiscovery"`
+	MaxDescriptionLength int `json:"maxDescriptionLength"`
+	DescriptionLimits DescriptionLimitsConfig `json:"descriptionLimits"`
+	TrackingParams []string `json:"trackingParams"`
+	Fetch FetchConfig `json:"fetch"`
+	GrpcAddr string `json:"grpcAddr"`
+	Sinks SinksConfig `json:"sinks"`
+	AutoMigrate bool `json:"autoMigrate"`
+	Vault VaultConfig `json:"vault"`
+	Outbox OutboxConfig `json:"outbox"`
+	Nats NatsQueueConfig `json:"nats"`
+	Tenants []TenantConfig `json:"tenants"`
+	Alerts AlertsConfig `json:"alerts"`
+	FetchWorkers int `json:"fetchWorkers"`
+	ParseWorkers int `json:"parseWorkers"`
+	PersistWorkers int `json:"persistWorkers"`
+	ProbeImages bool `json:"probeImages"`
+	ImagePolicy ImagePolicyConfig `json:"imagePolicy"`
+	Enrichers []string `json:"enrichers"`
+	Keywords KeywordsConfig `json:"keywords"`
+	Summary SummaryConfig `json:"summary"`
+	Llm LlmConfig `json:"llm"`
+	Nsfw NsfwConfig `json:"nsfw"`
+	AuditLog bool `json:"auditLog"`
+	FieldPrecedence map[string][]string `json:"fieldPrecedence"`
+	Sanitize SanitizeConfig `json:"sanitize"`
+	StoredHtml StoredHtmlConfig `json:"storedHtml"`
+	PostFilter PostFilter `json:"postFilter"`
+	FeedPreferences []FeedPreference `json:"feedPreferences"`
+	Domains []DomainConfig `json:"domains"`
+	Robots RobotsConfig `json:"robots"`
+	Metrics MetricsConfig `json:"metrics"`
 }
 
 type DbConfig struct {
+	Driver string `json:"driver"`
+	Path string `json:"path"`
 	User string `json:"user"`
 	Password string `json:"pass"`
+	PasswordFile string `json:"passwordFile"`
 	Server string `json:"server"`
 	DbName string `json:"dbName"`
+	// Charset is that of the mysql columns. With "utf8" (utf8mb3) rather
+	// than utf8mb4, characters such as emoji are replaced before writing.
+	Charset string `json:"charset"`
+	// FourByteChars is "replace" (the default) to write U+FFFD in their
+	// place, or "strip" to drop them.
+	FourByteChars string `json:"fourByteChars"`
 }
 
 type Post struct {
 	PostID int64
 	Url string
 	OrigDescription string
+	// Priority orders the scraping queue, highest first.
+	Priority int
+	// FeedID is the aggregator feed the post came from, or 0 if unknown.
+	FeedID int64
 }
 
 type PostScraped struct {
 	Post Post
+	Duplicates []Post
 	Html string
+	StatusCode int
+	// Header is the page's response header, when it was fetched
+	Header http.Header
+	FinalUrl string
+	ContentLength int64
+	FetchErr error
+	FetchDuration time.Duration
 	OpenGraphTags OpenGraphTags
+	// notes explain what happened to the page in its audit trail
+	notes []string
 } 
 
 type OpenGraphTags struct {
 	Description string
 	FeaturedImage string
+	ImageWidth int
+	ImageHeight int
+	// ImageFormat is only known when the image was probed
+	ImageFormat string
+	Article ArticleMetadata
+	DublinCore DublinCoreMetadata
+	Keywords []string
+	// Tags are keywords extracted from the article text by an enricher
+	Tags []string
+	// Nsfw marks adult content, from rating tags or the nsfw enricher
+	Nsfw bool
+	// Simhash fingerprints the article text for duplicate detection
+	Simhash uint64
+	Video MediaMetadata
+	Audio MediaMetadata
+	// Type is og:type, which decides which of the typed metadata is kept
+	Type string
+	VideoDetails VideoDetailsMetadata
+	Music MusicMetadata
+	Profile ProfileMetadata
+	Title string
+	Canonical string
+	Url string
+	AmpUrl string
+	FromAmp bool
+	Icon string
+	icons []iconLink
+	SiteName string
+	ThemeColor string
+	// TileColor and TileImage are the windows start screen tile
+	TileColor string
+	TileImage string
+	tileImageHref string
+	// images and the <picture> being read are candidates for a featured image
+	images []bodyImage
+	picture *bodyImage
+	// candidates are the values each source offered for a field, by field
+	// then source
+	candidates map[string]map[string]string
+	// paragraphs are the text of the page's <p> elements
+	paragraphs []string
+	// heading is the text of the page's first <h1>
+	heading string
+	WordCount int
+	ReadingMinutes int
+	Feeds []string
+	// Alternates are the translations of the page
+	Alternates []HreflangAlternate
+	ArchivedAt string
+	Locale string
+	HtmlLang string
+	Language string
+	HtmlDir string
+	// Direction is "rtl" or "ltr", when it's known
+	Direction string
+	MetaTags map[string][]string
+	JsonLd []json.RawMessage
+	// Sources are where each field's value came from
+	Sources map[string]FieldSource
 }
 
 type AbtSolrDocs []AbtSolrDocument
@@ -56,348 +187,485 @@ type SolrSetDocument struct {
 	Set string `json:"set"`
 }
 
-var scrapingPostsWg sync.WaitGroup
+// startGrpcServer is set by grpc.go when built with -tags grpc.
+var startGrpcServer func(addr string)
 
 func kill(context string, err error) {
 	fmt.Println("error encountered with reason:", context)
 	panic(err)
 }
 
-func updateSolr(solrBaseUrl string, scraped PostScraped) {
+// updateSolr reports whether the post's description was updated.
+func updateSolr(config AppConfig, scraped PostScraped) bool {
 	docs := AbtSolrDocs{
 		AbtSolrDocument{
 			Id: scraped.Post.PostID,
 			PostDescription: SolrSetDocument{
-				Set: scraped.OpenGraphTags.Description,
+				Set: truncateDescription(scraped.OpenGraphTags.Description, config.DescriptionLimits.Solr),
 			},
 		},
 	}
 
-	postBody, err := json.Marshal(docs)
+	err := postToSolr(config, "commit=true", docs)
 	if err != nil {
+		metrics.count("solr.errors", 1)
 		fmt.Println(err.Error())
-		return
+		reportError("solr", scraped.Post, err)
+		return false
 	}
 
-	solrUrl := solrBaseUrl + "/update?commit=true"
-	req, err := http.NewRequest("POST", solrUrl, bytes.NewBuffer(postBody))
-	if err != nil {
-		fmt.Println(err.Error())
-		return
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second * 10)
-
-	defer func(cancel context.CancelFunc) {
-		cancel()
-	}(cancel)
-
-	req = req.WithContext(ctx)
-
-	httpClient := &http.Client{}
-
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		fmt.Println(err.Error())
-		return
-	}
-
-	defer func(resp *http.Response) {
-		_ = resp.Body.Close()
-	}(resp)
-}
-
-func updateDbWithOgTags(db *sql.DB, scraped PostScraped) {
-	stmt, err := db.Prepare("UPDATE posts SET description = ?, modified = ?, content = ? WHERE pk_post_id = ?")
-	if err != nil {
-		fmt.Println(
-			"Could not prepare SQL statement to update post with og values", scraped.Post.Url, err.Error(),
-		)
-		return
-	}
-
-	description := scraped.OpenGraphTags.Description
-	if description == "" {
-		description = scraped.Post.OrigDescription
-	}
-
-	_, err = stmt.Exec(
-		description,
-		time.Now().UTC().Format("2006-01-02 15:04:05"),
-		scraped.Html,
-		scraped.Post.PostID,
-	)
-	if err != nil {
-		fmt.Println(
-			"Could not execute SQL statement to update post with og values", scraped.Post.Url, err.Error(),
-		)
-		return
-	}
-
-	if scraped.OpenGraphTags.FeaturedImage != "" {
-		var ttlFiles float64
-		err = db.QueryRow("SELECT COUNT(*) AS ttl FROM files WHERE fk_post_id = ?", scraped.Post.PostID).Scan(&ttlFiles)
-		if err != nil && err.Error() != "sql: no rows in result set" {
-			fmt.Println("could not count files", err.Error())
-			return
-		}
-		if ttlFiles == 0 {
-			stmt, err = db.Prepare("INSERT INTO `files` (`fk_post_id`, `external_url`) VALUES (?, ?)")
-			if err != nil {
-				fmt.Println(
-					"Could not prepare SQL statement to insert post image", scraped.Post.Url, err.Error(),
-				)
-				return
-			}
-			_, err = stmt.Exec(
-				scraped.Post.PostID,
-				scraped.OpenGraphTags.FeaturedImage,
-			)
-			if err != nil {
-				fmt.Println(
-					"Could not execute SQL statement to insert post image", scraped.Post.Url, err.Error(),
-				)
-				return
-			}
-		}
-	}
+	return true
 }
 
 func getOgTagsFromHtml(scrapedPost *PostScraped) {
+	// everything extracted, and the stored html, is valid utf-8 from here
+	scrapedPost.Html = repairUtf8(scrapedPost.Html)
 	r := strings.NewReader(scrapedPost.Html)
 	tokenizer := html.NewTokenizer(r)
+	// element whose text content is wanted: "title", "script" for json-ld, "h1"
+	// or "p"
+	textOf := ""
 
 	for {
 		tokenType := tokenizer.Next()
 
 		if tokenType == html.ErrorToken {
 			err := tokenizer.Err()
-			if err == io.EOF {
-				break
+			if err != io.EOF {
+				fmt.Println("could not parse html from", scrapedPost.Post.Url, err.Error())
+				reportError("parse", scrapedPost.Post, err)
 			}
+			break
 		}
 
 		token := tokenizer.Token()
 
-		if token.Data == "meta" {
-			isDescr := false
-			isThumb := false
-			for i := range token.Attr {
-				if token.Attr[i].Key == "property" && token.Attr[i].Val == "og:description" {
-					isDescr = true
-					break
-				} else if token.Attr[i].Key == "property" && token.Attr[i].Val == "og:image" {
-					isThumb = true
-					break
-				}
+		if token.Type == html.TextToken {
+			if textOf != "" {
+				scrapedPost.OpenGraphTags.setText(textOf, token.Data)
 			}
+			continue
+		}
 
-			for j := range token.Attr {
-				if token.Attr[j].Key == "content" {
-					if isDescr {
-						scrapedPost.OpenGraphTags.Description = token.Attr[j].Val
-					} else if isThumb {
-						scrapedPost.OpenGraphTags.FeaturedImage = token.Attr[j].Val
-					}
-				}
+		switch token.Data {
+		case "html":
+			if token.Type == html.StartTagToken {
+				scrapedPost.OpenGraphTags.HtmlLang = attrValue(token, "lang")
+				scrapedPost.OpenGraphTags.HtmlDir = attrValue(token, "dir")
+			}
+		case "body":
+			// themes that don't set dir on <html> often set it here
+			if token.Type == html.StartTagToken && normalizeDirection(scrapedPost.OpenGraphTags.HtmlDir) == "" {
+				scrapedPost.OpenGraphTags.HtmlDir = attrValue(token, "dir")
+			}
+		case "meta":
+			key, content := metaKeyAndContent(token)
+			if key != "" {
+				scrapedPost.OpenGraphTags.setMetaTag(key, content)
+			}
+		case "link":
+			scrapedPost.OpenGraphTags.setLink(token)
+		case "img", "picture", "source":
+			scrapedPost.OpenGraphTags.addBodyImage(token)
+		case "title":
+			textOf = ""
+			if token.Type == html.StartTagToken {
+				textOf = "title"
+			}
+		case "h1":
+			textOf = ""
+			if token.Type == html.StartTagToken && scrapedPost.OpenGraphTags.heading == "" {
+				textOf = "h1"
+			}
+		case "p":
+			textOf = ""
+			if token.Type == html.StartTagToken && scrapedPost.OpenGraphTags.startParagraph() {
+				textOf = "p"
+			}
+		case "script":
+			textOf = ""
+			if token.Type == html.StartTagToken && isJsonLdScript(token) {
+				textOf = "script"
 			}
 		}
 	}
-}
 
-func getPostHtml(post Post, scrapedChan chan<- PostScraped) {
-	fmt.Println("fetching", post.Url)
+	tags := &scrapedPost.OpenGraphTags
+	tags.addJsonLdCandidates()
+	tags.addCandidate("featured_image", sourceHeuristic, resolveBodyImage(scrapedPost.Post.Url, tags.images))
+	tags.applyPrecedence()
+	tags.applyFallbacks()
+
+	tags.Icon = resolveSiteIcon(scrapedPost.Post.Url, tags.icons)
+	if len(tags.icons) > 0 {
+		tags.setSource("icon", sourceLink, tags.Icon)
+	} else if tags.Icon != "" {
+		tags.setSource("icon", sourceHeuristic, tags.Icon)
+	}
+
+	tags.TileImage = resolveIconUrl(scrapedPost.Post.Url, tags.tileImageHref)
 
-	scrapedPost := PostScraped{
-		Post:          post,
-		Html:          "",
-		OpenGraphTags: OpenGraphTags{},
+	tags.Feeds = resolveFeeds(scrapedPost.Post.Url, tags.Feeds)
+	tags.Alternates = resolveAlternates(scrapedPost.Post.Url, tags.Alternates)
+	tags.setReadingTime()
+
+	var languageSource string
+	tags.Language, languageSource = detectLanguage(*tags)
+	if tags.Language != "" {
+		tags.setSource("language", languageSource, tags.Language)
+	}
+
+	var directionSource string
+	tags.Direction, directionSource = detectDirection(*tags)
+	if tags.Direction != "" {
+		tags.setSource("direction", directionSource, tags.Direction)
 	}
+}
+
+func start(store Store, config AppConfig, sinks []Sink) (err error) {
+	cycleStarted := clock.Now()
+	summary := scrapeSummary{}
 
+	// runs after a panic has been recovered, so it is recorded as an error
 	defer func() {
-		scrapedChan <- scrapedPost
-		scrapingPostsWg.Done()
+		run := ScrapeRun{
+			Started:  cycleStarted,
+			Finished: clock.Now(),
+			Posts:    summary.posts,
+			Saved:    summary.saved,
+			Failed:   summary.failed,
+		}
+		if err != nil {
+			run.Error = err.Error()
+		}
+
+		recordRun(store, run)
+	}()
+
+	// recover from panics
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println("Recovered in f", r)
+			reportPanic("cycle", r)
+			err = fmt.Errorf("panic: %v", r)
+		}
 	}()
 
-	req, err := http.NewRequest("GET", post.Url, nil)
+	ctx := context.Background()
+
+	err = store.Ping(ctx)
 	if err != nil {
-		fmt.Println(err.Error())
-		return
+		fmt.Println("could not ping db", err.Error())
+		reportPhaseError("db", err)
+		return fmt.Errorf("pinging db: %w", err)
 	}
 
-	// tumblr gdpr nonsense
-	if !strings.Contains(post.Url, "tumblr.com") {
-		req.Header.Add("User-Agent", "@bateszi OG parser")
-	} else {
-		req.Header.Add("User-Agent", "Baiduspider")
+	// writes queued while solr or a sink was down go out first
+	config.sinkSpill().replay(ctx, config, sinks)
+
+	// get the posts to be scraped
+	posts, err := store.PostsToScrape(ctx, config.PostFilter)
+	if err != nil {
+		fmt.Println("fetching posts to scrape", err.Error())
+		reportPhaseError("db", err)
+		return fmt.Errorf("fetching posts to scrape: %w", err)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second * 10)
 
-	defer func(cancel context.CancelFunc) {
-		cancel()
-	}(cancel)
+	summary = scrapePosts(ctx, store, config, sinks, posts, newProgressLogger("cycle", len(posts)))
+	if currentTenant != "" {
+		fmt.Printf("tenant %s: saved metadata for %d of %d posts\n", currentTenant, summary.saved, summary.posts)
+	}
 
-	req = req.WithContext(ctx)
+	alerts.checkFailureRate(currentTenant, summary.posts, summary.failed)
 
-	httpClient := &http.Client{}
+	tenantMetric := "tenants." + metricName(currentTenant) + ".cycle"
+	metrics.count(tenantMetric+".posts", int64(summary.posts))
+	metrics.count(tenantMetric+".saved", int64(summary.saved))
+	metrics.count(tenantMetric+".failed", int64(summary.failed))
+	metrics.timing(tenantMetric+".duration", clock.Now().Sub(cycleStarted))
 
-	resp, err := httpClient.Do(req)
+	err = store.ClearOutbox(ctx, cycleStarted)
 	if err != nil {
-		fmt.Println(err.Error())
-		return
+		fmt.Println("could not clear post outbox", err.Error())
 	}
 
-	defer func(resp *http.Response) {
-		_ = resp.Body.Close()
-	}(resp)
+	return nil
+}
 
-	if resp.StatusCode == http.StatusOK && resp.StatusCode < 300 {
-		httpBody, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Println(err.Error())
-			return
-		}
+// parseScrapedPost extracts the metadata from a fetched page, trying the
+// configured fallbacks when the page itself is not enough.
+func parseScrapedPost(fetcher Fetcher, config AppConfig, scrapedPost *PostScraped) {
+	getOgTagsFromHtml(scrapedPost)
+
+	preference := config.preferenceFor(scrapedPost.Post)
 
-		scrapedPost.Html = string(httpBody)
+	if preference.ampFallback(config.AmpFallback) && !scrapedPost.OpenGraphTags.hasUsableMetadata() && scrapedPost.OpenGraphTags.AmpUrl != "" {
+		fetchAmpFallback(fetcher, scrapedPost)
 	}
-}
 
-func getPostsToScrape(db *sql.DB) ([]Post, error) {
-	posts := make([]Post, 0)
+	if preference.waybackFallback(config.WaybackFallback) && isDeadLink(*scrapedPost) {
+		fetchWaybackFallback(fetcher, scrapedPost)
+	}
 
-	getPostsRows, err := db.Query(
-		"SELECT pk_post_id, link, description FROM rss_aggregator.posts WHERE created > (NOW() - interval 60 minute)",
-	)
-	if err != nil {
-		return posts, err
+	scrapedPost.OpenGraphTags.normalize(config.MaxDescriptionLength)
+	scrapedPost.OpenGraphTags.cleanUrls(config.TrackingParams)
+
+	if config.ProbeImages {
+		probeFeaturedImage(fetcher, scrapedPost)
 	}
 
-	defer func(getFeedsRows *sql.Rows) {
-		err := getFeedsRows.Close()
-		if err != nil {
-			panic(err)
+	applyImagePolicy(config.ImagePolicy, scrapedPost)
+}
+
+// persistScrapedPost saves the metadata of a scraped post, reporting whether
+// there was any to save.
+func persistScrapedPost(ctx context.Context, store Store, config AppConfig, sinks []Sink, scrapedPost PostScraped) bool {
+	if config.FeedDiscovery.Enabled {
+		reportDiscoveredFeeds(ctx, store, config.FeedDiscovery, scrapedPost)
+	}
+
+	updateSiteBranding(ctx, store, scrapedPost)
+
+	indexable := applyRobots(config.Robots, &scrapedPost)
+
+	if !scrapedPost.OpenGraphTags.empty() {
+		fmt.Println("updating OG tags parsed from", scrapedPost.Post.Url)
+
+		if config.Sanitize.Enabled {
+			scrapedPost.Html = sanitizeHtml(scrapedPost.Html, config.Sanitize)
 		}
-	}(getPostsRows)
-
-	for getPostsRows.Next() {
-		post := Post{}
-		err = getPostsRows.Scan(
-			&post.PostID,
-			&post.Url,
-			&post.OrigDescription,
-		)
+
+		scrapedPost.Html = trimStoredHtml(scrapedPost.Html, config.StoredHtml)
+
+		saved := scrapedPost.withDescriptionLimit(config.DescriptionLimits.Db, config.Db)
+		opts := SaveOptions{StoreMetaTags: config.StoreMetaTags}
+		changed, err := store.SaveMetadata(ctx, saved, opts)
 		if err != nil {
-			return posts, err
+			fmt.Println("Could not save og values", scrapedPost.Post.Url, err.Error())
+			reportError("db", scrapedPost.Post, err)
+			scrapedPost.note("%s", err.Error())
+			recordAudit(ctx, store, config, scrapedPost, auditSaveFailed, nil)
+			return false
 		}
 
-		posts = append(posts, post)
-	}
-	
-	return posts, nil
-}
+		if !changed {
+			fmt.Println("og values unchanged for", scrapedPost.Post.Url)
+			recordAudit(ctx, store, config, scrapedPost, auditUnchanged, nil)
+			return true
+		}
 
-func start() {
-	// recover from panics
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println("Recovered in f", r)
+		sinks = sinksFor(sinks, indexable)
+		written := make([]string, 0, len(sinks)+1)
+		targets := make([]string, 0, len(sinks)+1)
+
+		if config.solrEnabled() && indexable && scrapedPost.OpenGraphTags.Description != "" {
+			targets = append(targets, solrSpillTarget)
+			if updateSolr(config, scrapedPost) {
+				written = append(written, solrSpillTarget)
+			}
 		}
-	}()
 
-	// read the json config
-	encodedJson, err := ioutil.ReadFile("config/config.json")
-	if err != nil {
-		kill("reading config file", err)
-	}
+		for _, sink := range sinks {
+			targets = append(targets, sink.Name())
+		}
 
-	config := AppConfig{}
+		written = append(written, writeToSinks(sinks, scrapedPost)...)
+		spill := config.sinkSpill()
+		spill.track(scrapedPost, targets, written)
 
-	err = json.Unmarshal(encodedJson, &config)
-	if err != nil {
-		kill("parsing json from config file", err)
-	}
+		// the hash is only stored once solr and the sinks have the values,
+		// or the spill will retry them, as an unchanged hash skips the post
+		if len(written) == len(targets) || spill != nil {
+			err = store.SaveContentHash(ctx, saved.Post.PostID, saved.contentHash(opts))
+			if err != nil {
+				fmt.Println("Could not store content hash", scrapedPost.Post.Url, err.Error())
+				reportError("db", scrapedPost.Post, err)
+			}
+		}
+
+		recordAudit(ctx, store, config, scrapedPost, auditSaved, written)
 
-	// create a db connection
-	dbParams := make(map[string]string)
-	dbParams["charset"] = "utf8mb4"
-
-	dbConfig := mysql.Config{
-		User: config.Db.User,
-		Passwd: config.Db.Password,
-		Net: "tcp",
-		Addr: config.Db.Server,
-		DBName: config.Db.DbName,
-		Params: dbParams,
+		return true
 	}
 
-	db, err := sql.Open("mysql", dbConfig.FormatDSN())
-	if err != nil {
-		kill("opening db connection", err)
+	outcome := auditNoMetadata
+	if scrapedPost.Html == "" {
+		outcome = auditFetchFailed
 	}
+	recordAudit(ctx, store, config, scrapedPost, outcome, nil)
 
-	defer func(db *sql.DB) {
-		fmt.Println("Closing database connection at", time.Now().Format(time.RFC1123Z))
-		err := db.Close()
-		if err != nil {
-			kill("closing db connection", err)
-		}
-	}(db)
+	return false
+}
 
-	err = db.Ping()
-	if err != nil {
-		kill("could not ping db", err)
+func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
 	}
 
-	fmt.Println("Opened database connection at", time.Now().Format(time.RFC1123Z))
-
-	// get the posts to be scraped
-	posts, err := getPostsToScrape(db)
+	config, err := loadConfig(configPath)
 	if err != nil {
-		kill("fetching posts to scrape", err)
+		kill("loading config file", err)
 	}
 
-	scrapedChan := make(chan PostScraped, len(posts))
+	problems := validateConfig(config)
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Println("invalid config:", problem.Error())
+		}
 
-	for i := range posts {
-		scrapingPostsWg.Add(1)
-		go getPostHtml(posts[i], scrapedChan)
+		kill("validating config file", fmt.Errorf("%d problems found in %s", len(problems), configPath))
 	}
 
-	scrapingPostsWg.Wait()
-	fmt.Println("finished scraping posts")
-	close(scrapedChan)
+	applyConfig(config)
 
-	for j := 0; j < len(posts); j++ {
-		scrapedPost := <-scrapedChan
+	if config.DebugAddr != "" {
+		startDebugServer(config.DebugAddr)
+	}
 
-		fmt.Println("parsing html returned from", scrapedPost.Post.Url)
+	if config.GrpcAddr != "" {
+		if startGrpcServer == nil {
+			fmt.Println("grpcAddr is set but this build does not include the grpc server")
+		} else {
+			startGrpcServer(config.GrpcAddr)
+		}
+	}
 
-		getOgTagsFromHtml(&scrapedPost)
+	if config.SolrSchema.Check {
+		for _, tc := range config.tenantConfigs() {
+			tenantConfig := config.forTenant(tc)
+			if !tenantConfig.solrEnabled() {
+				continue
+			}
 
-		if scrapedPost.OpenGraphTags.FeaturedImage != "" || scrapedPost.OpenGraphTags.Description != "" {
-			fmt.Println("updating OG tags parsed from", scrapedPost.Post.Url)
-			updateDbWithOgTags(db, scrapedPost)
+			coreUrl, err := tenantConfig.solrCoreUrl()
+			if err == nil {
+				err = checkSolrSchema(coreUrl, config.solrTimeout(), config.SolrSchema)
+			}
 
-			if scrapedPost.OpenGraphTags.Description != "" {
-				updateSolr(config.Solr, scrapedPost)
+			if err != nil {
+				kill("checking solr schema for tenant "+tc.Name, err)
 			}
 		}
 	}
+
+	// db connections are kept open across cycles and config reloads
+	tenants := openTenants(config)
+	if len(tenants) == 0 {
+		kill("opening db connection", errors.New("no tenant db could be opened"))
+	}
+
+	defer func() {
+		fmt.Println("Closing database connections at", clock.Now().Format(time.RFC1123Z))
+		closeTenants(tenants)
+	}()
+
+	fmt.Println("Opened database connections at", clock.Now().Format(time.RFC1123Z))
+
+	if config.AdminAddr != "" {
+		startAdminServer(config.AdminAddr, tenants)
+	}
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	runTenants(tenants, config, reload, nil)
 }
 
-func main() {
-	start()
+// runTenants starts a cycle for every tenant each interval, drains the
+// outbox, scrapes post ids from nats and applies config reloads, until stop
+// is closed.
+func runTenants(tenants []*tenant, config AppConfig, reload <-chan os.Signal, stop <-chan struct{}) {
+	// post ids received from nats belong to the primary tenant's db
+	primary := tenants[0]
+	if primary.name != primaryTenantName {
+		primary = nil
+	}
+
+	natsConfig := config.Nats
+	queue := openNatsQueue(natsConfig)
+
+	defer func() {
+		_ = queue.Close()
+	}()
+
+	sdNotify("READY=1")
 
-	interval := 7 * time.Minute
+	if startTenants(tenants) {
+		sdNotify("WATCHDOG=1")
+	}
+
+	interval := config.interval()
 	fmt.Println("Starting ticker to parse posts every", interval)
 
-	ticker := time.NewTicker(interval)
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
 
-	for _ = range ticker.C {
-		start()
+	// outboxTicks stays nil, and never fires, unless the outbox is enabled
+	var outboxTicker Ticker
+	var outboxTicks <-chan time.Time
+	if config.Outbox.Enabled {
+		outboxTicker = clock.NewTicker(config.Outbox.pollInterval())
+		outboxTicks = outboxTicker.C()
 	}
 
-	// Run application indefinitely
-	select{}
-}
\ No newline at end of file
+	defer func() {
+		if outboxTicker != nil {
+			outboxTicker.Stop()
+		}
+	}()
+
+	// Run until stopped, which main never does. Cycles run on this goroutine,
+	// so a SIGHUP received mid-cycle is only applied once that cycle has
+	// finished.
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			if startTenants(tenants) {
+				sdNotify("WATCHDOG=1")
+			}
+		case <-outboxTicks:
+			for _, t := range tenants {
+				currentTenant = t.name
+				drainOutbox(t.store, t.config, t.sinks)
+			}
+			currentTenant = ""
+		case msg := <-queue.messages():
+			ids := queue.postIDs(msg)
+			if primary == nil {
+				fmt.Println("dropping", len(ids), "post ids from nats, the primary db is not open")
+				continue
+			}
+			currentTenant = primary.name
+			scrapeQueuedPosts(primary.store, primary.config, primary.sinks, ids)
+			currentTenant = ""
+		case <-reload:
+			sdNotify("RELOADING=1")
+			config = reloadConfig(config)
+			reloadTenants(tenants, config)
+			if config.Nats != natsConfig {
+				natsConfig = config.Nats
+				_ = queue.Close()
+				queue = openNatsQueue(natsConfig)
+			}
+			sdNotify("READY=1")
+
+			if config.interval() != interval {
+				interval = config.interval()
+				ticker.Reset(interval)
+				fmt.Println("Ticker now parsing posts every", interval)
+			}
+
+			if outboxTicker != nil {
+				outboxTicker.Stop()
+				outboxTicker, outboxTicks = nil, nil
+			}
+			if config.Outbox.Enabled {
+				outboxTicker = clock.NewTicker(config.Outbox.pollInterval())
+				outboxTicks = outboxTicker.C()
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunTenantsStartsCycleOnEachTick(t *testing.T) {
+	manual := useManualClock(t)
+
+	site := newFixtureSite(t)
+	store := newMemoryStore([]Post{{PostID: 1, Url: site.URL + "/article.html"}})
+	tenants := []*tenant{{name: primaryTenantName, config: testConfig(), store: store}}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runTenants(tenants, testConfig(), nil, stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	// the first cycle runs before the ticker is started
+	waitFor(t, "the ticker to start", func() bool {
+		manual.mu.Lock()
+		defer manual.mu.Unlock()
+
+		return len(manual.tickers) == 1
+	})
+	if hits := site.hitsFor("/article.html"); hits != 1 {
+		t.Fatalf("article fetched %d times before the first tick, want 1", hits)
+	}
+
+	manual.Advance(defaultInterval - time.Second)
+	time.Sleep(10 * time.Millisecond)
+	if hits := site.hitsFor("/article.html"); hits != 1 {
+		t.Fatalf("article fetched %d times before the interval passed, want 1", hits)
+	}
+
+	for want := 2; want <= 3; want++ {
+		manual.Advance(time.Second)
+		waitFor(t, "the next cycle", func() bool {
+			return site.hitsFor("/article.html") == want
+		})
+
+		// move the next tick a whole interval away again
+		manual.Advance(defaultInterval - time.Second)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// VideoDetailsMetadata is what the video.* og:types add. The player urls are
+// the embeddable players pages declare with twitter:player, as og:video is
+// usually the file itself.
+type VideoDetailsMetadata struct {
+	Players []string `json:"players,omitempty"`
+	// Duration is in seconds
+	Duration    int      `json:"duration,omitempty"`
+	ReleaseDate string   `json:"release_date,omitempty"`
+	Series      string   `json:"series,omitempty"`
+	Directors   []string `json:"directors,omitempty"`
+	Actors      []string `json:"actors,omitempty"`
+}
+
+// MusicMetadata is what the music.* og:types add. A song names its album,
+// disc and track, an album or playlist its songs.
+type MusicMetadata struct {
+	// Duration is in seconds
+	Duration    int      `json:"duration,omitempty"`
+	Album       string   `json:"album,omitempty"`
+	Disc        int      `json:"disc,omitempty"`
+	Track       int      `json:"track,omitempty"`
+	Musicians   []string `json:"musicians,omitempty"`
+	Songs       []string `json:"songs,omitempty"`
+	ReleaseDate string   `json:"release_date,omitempty"`
+}
+
+type ProfileMetadata struct {
+	Name      string `json:"name,omitempty"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	Username  string `json:"username,omitempty"`
+}
+
+// genericOgTypes get no type-specific metadata, their pages being handled
+// as articles.
+var genericOgTypes = map[string]bool{
+	"":        true,
+	"article": true,
+	"website": true,
+	"blog":    true,
+}
+
+// setTypedTag collects the properties of the og:types that have metadata of
+// their own, whatever the page's type turns out to be, as og:type can come
+// after them.
+func (t *OpenGraphTags) setTypedTag(key string, content string) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+
+	switch key {
+	case "twitter:player":
+		t.VideoDetails.Players = append(t.VideoDetails.Players, content)
+	case "video:duration":
+		t.VideoDetails.Duration = parseSeconds(content)
+	case "video:release_date":
+		t.VideoDetails.ReleaseDate = normalizeArticleTime(content)
+	case "video:series":
+		t.VideoDetails.Series = content
+	case "video:director":
+		t.VideoDetails.Directors = append(t.VideoDetails.Directors, content)
+	case "video:actor":
+		t.VideoDetails.Actors = append(t.VideoDetails.Actors, content)
+	case "music:duration":
+		t.Music.Duration = parseSeconds(content)
+	case "music:album":
+		t.Music.Album = content
+	case "music:album:disc":
+		t.Music.Disc, _ = strconv.Atoi(content)
+	case "music:album:track":
+		t.Music.Track, _ = strconv.Atoi(content)
+	case "music:musician", "music:creator":
+		t.Music.Musicians = append(t.Music.Musicians, content)
+	case "music:song":
+		t.Music.Songs = append(t.Music.Songs, content)
+	case "music:release_date":
+		t.Music.ReleaseDate = normalizeArticleTime(content)
+	case "profile:first_name":
+		t.Profile.FirstName = content
+	case "profile:last_name":
+		t.Profile.LastName = content
+	case "profile:username":
+		t.Profile.Username = content
+	}
+}
+
+// parseSeconds reads a duration given in seconds, ignoring fractions.
+func parseSeconds(content string) int {
+	seconds, err := strconv.ParseFloat(content, 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return int(seconds)
+}
+
+// ogTypeFamily is the part of og:type before the dot, e.g. "video" for
+// "video.movie".
+func (t OpenGraphTags) ogTypeFamily() string {
+	family := strings.ToLower(strings.TrimSpace(t.Type))
+	if i := strings.Index(family, "."); i >= 0 {
+		family = family[:i]
+	}
+
+	return family
+}
+
+// addTypedMetadata adds the metadata of the page's og:type, leaving the
+// generic types handled as articles as they were.
+func (t OpenGraphTags) addTypedMetadata(metadata *PostMetadata) {
+	if genericOgTypes[strings.ToLower(strings.TrimSpace(t.Type))] {
+		return
+	}
+
+	metadata.OgType = strings.ToLower(strings.TrimSpace(t.Type))
+
+	switch t.ogTypeFamily() {
+	case "video":
+		if !t.VideoDetails.empty() {
+			details := t.VideoDetails
+			metadata.VideoDetails = &details
+		}
+	case "music":
+		if !t.Music.empty() {
+			music := t.Music
+			metadata.Music = &music
+		}
+	case "profile":
+		if profile := t.Profile.withName(); !profile.empty() {
+			metadata.Profile = &profile
+		}
+	}
+}
+
+func (v VideoDetailsMetadata) empty() bool {
+	return len(v.Players) == 0 && v.Duration == 0 && v.ReleaseDate == "" && v.Series == "" &&
+		len(v.Directors) == 0 && len(v.Actors) == 0
+}
+
+func (m MusicMetadata) empty() bool {
+	return m.Duration == 0 && m.Album == "" && m.Disc == 0 && m.Track == 0 && len(m.Musicians) == 0 &&
+		len(m.Songs) == 0 && m.ReleaseDate == ""
+}
+
+// withName fills in the full name from the first and last ones.
+func (p ProfileMetadata) withName() ProfileMetadata {
+	p.Name = strings.TrimSpace(p.FirstName + " " + p.LastName)
+
+	return p
+}
+
+func (p ProfileMetadata) empty() bool {
+	return p.Name == "" && p.FirstName == "" && p.LastName == "" && p.Username == ""
+}
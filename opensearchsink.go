@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type OpenSearchSinkConfig struct {
+	// Enabled turns the sink off without removing its settings. It is on
+	// whenever it is configured unless set to false.
+	Enabled  *bool             `json:"enabled"`
+	Endpoint string            `json:"endpoint"`
+	Index    string            `json:"index"`
+	Fields   map[string]string `json:"fields"`
+	// Region enables SigV4 signing with credentials from the standard aws
+	// chain (env, shared config, container and instance roles).
+	Region string `json:"region"`
+	// Service is "es" for managed domains and "aoss" for serverless.
+	Service string `json:"service"`
+}
+
+// openSearchSink upserts partial documents, so fields written by other
+// writers are kept.
+type openSearchSink struct {
+	config     OpenSearchSinkConfig
+	httpClient *http.Client
+	awsConfig  *aws.Config
+	signer     *v4.Signer
+}
+
+type openSearchUpdate struct {
+	Doc         map[string]interface{} `json:"doc"`
+	DocAsUpsert bool                   `json:"doc_as_upsert"`
+}
+
+func newOpenSearchSink(config OpenSearchSinkConfig) (*openSearchSink, error) {
+	if config.Index == "" {
+		config.Index = "posts"
+	}
+
+	if config.Service == "" {
+		config.Service = "es"
+	}
+
+	sink := &openSearchSink{config: config, httpClient: &http.Client{}}
+
+	if config.Region != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		awsConfig, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(config.Region))
+		if err != nil {
+			return nil, fmt.Errorf("loading aws config: %w", err)
+		}
+
+		sink.awsConfig = &awsConfig
+		sink.signer = v4.NewSigner()
+	}
+
+	return sink, nil
+}
+
+func (s *openSearchSink) Name() string {
+	return "opensearch"
+}
+
+func (s *openSearchSink) searchIndex() {}
+
+func (s *openSearchSink) Write(scraped PostScraped) error {
+	doc := searchDocument(scraped, "id", s.config.Fields)
+	delete(doc, "id")
+
+	body, err := json.Marshal(openSearchUpdate{Doc: doc, DocAsUpsert: true})
+	if err != nil {
+		return err
+	}
+
+	updateUrl := strings.TrimRight(s.config.Endpoint, "/") + "/" + url.PathEscape(s.config.Index) +
+		"/_update/" + fmt.Sprint(scraped.Post.PostID)
+
+	req, err := http.NewRequest("POST", updateUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	req = req.WithContext(ctx)
+
+	if s.signer != nil {
+		err = s.sign(ctx, req, body)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func(resp *http.Response) {
+		_ = resp.Body.Close()
+	}(resp)
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("opensearch update returned status %d: %s", resp.StatusCode, respBody)
+	}
+
+	return nil
+}
+
+func (s *openSearchSink) sign(ctx context.Context, req *http.Request, body []byte) error {
+	credentials, err := s.awsConfig.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("retrieving aws credentials: %w", err)
+	}
+
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	return s.signer.SignHTTP(
+		ctx, credentials, req, hex.EncodeToString(payloadHash[:]), s.config.Service, s.config.Region, time.Now(),
+	)
+}
+
+func (s *openSearchSink) Close() error {
+	return nil
+}
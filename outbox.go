@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const defaultOutboxPollInterval = 5 * time.Second
+
+const defaultOutboxBatchSize = 100
+
+// OutboxConfig enables scraping posts as soon as the posts_after_insert_outbox
+// trigger queues them. The regular cycle keeps running to catch anything the
+// outbox missed.
+type OutboxConfig struct {
+	Enabled      bool   `json:"enabled"`
+	PollInterval string `json:"pollInterval"`
+	BatchSize    int    `json:"batchSize"`
+}
+
+func (c OutboxConfig) pollInterval() time.Duration {
+	interval := parseDurationOr(c.PollInterval, defaultOutboxPollInterval)
+	if interval <= 0 {
+		return defaultOutboxPollInterval
+	}
+
+	return interval
+}
+
+func (c OutboxConfig) batchSize() int {
+	if c.BatchSize <= 0 {
+		return defaultOutboxBatchSize
+	}
+
+	return c.BatchSize
+}
+
+// drainOutbox scrapes every post queued in the outbox.
+func drainOutbox(store Store, config AppConfig, sinks []Sink) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println("Recovered in outbox", r)
+			reportPanic("outbox", r)
+		}
+	}()
+
+	ctx := context.Background()
+
+	for {
+		posts, err := store.ClaimOutbox(ctx, config.Outbox.batchSize())
+		if err != nil {
+			fmt.Println("could not claim posts from outbox", err.Error())
+			reportPhaseError("outbox", err)
+			return
+		}
+
+		if len(posts) == 0 {
+			return
+		}
+
+		fmt.Println("scraping", len(posts), "new posts from outbox")
+		scrapePosts(ctx, store, config, sinks, posts, nil)
+	}
+}
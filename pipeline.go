@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// scrapeSummary counts what happened to the posts of a batch.
+type scrapeSummary struct {
+	posts  int
+	failed int
+	saved  int
+}
+
+// parsedPage is a fetched page on its way from the parse stage to the persist
+// stage.
+type parsedPage struct {
+	scraped PostScraped
+	failed  int
+	// persist is false for pages, such as soft 404s, that are not saved
+	persist bool
+}
+
+// scrapePosts fetches, parses and saves a batch of posts in a pipeline of
+// stages connected by small channels:
+//
+//	posts -> fetch workers -> parse workers -> persist workers
+//
+// A stage that falls behind blocks the ones before it, so only the pages
+// being worked on are held in memory however many posts the batch has.
+// Fetched posts are counted towards progress, which may be nil.
+func scrapePosts(
+	ctx context.Context, store Store, config AppConfig, sinks []Sink, posts []Post, progress *progressLogger,
+) scrapeSummary {
+	scrapable := scrapablePosts(config.FeedPreferences, posts)
+	progress.add(len(posts) - len(scrapable))
+	posts = scrapable
+
+	summary := scrapeSummary{posts: len(posts)}
+	fetcher := newFetcherFromConfig(config)
+
+	// posts sharing a url are fetched and parsed once, with hosts taking
+	// turns
+	postGroups := make(chan []Post)
+	go func() {
+		defer close(postGroups)
+		for _, group := range interleaveHosts(groupPostsByUrl(posts, config.TrackingParams)) {
+			postGroups <- group
+		}
+	}()
+
+	// a page that panics in any stage counts as failed for all its posts
+	var summaryMu sync.Mutex
+	fail := func(posts int) {
+		summaryMu.Lock()
+		summary.failed += posts
+		summaryMu.Unlock()
+	}
+
+	fetched := make(chan PostScraped, config.fetchWorkers())
+	runStage(config.fetchWorkers(), func() {
+		for group := range postGroups {
+			var scrapedPost PostScraped
+			ok := runItem("fetch", group[0], func() {
+				scrapedPost = getPostHtml(fetcher, group)
+			})
+			progress.add(len(group))
+
+			if !ok {
+				fail(len(group))
+				continue
+			}
+			fetched <- scrapedPost
+		}
+	}, func() {
+		fmt.Println("finished scraping posts")
+		close(fetched)
+	})
+
+	parsed := make(chan parsedPage, config.parseWorkers())
+	runStage(config.parseWorkers(), func() {
+		for scrapedPost := range fetched {
+			var page parsedPage
+			ok := runItem("parse", scrapedPost.Post, func() {
+				page = parseFetchedPage(ctx, fetcher, store, config, scrapedPost)
+			})
+
+			if !ok {
+				fail(len(scrapedPost.posts()))
+				continue
+			}
+			parsed <- page
+		}
+	}, func() {
+		// fallbacks and image probes are fetched while parsing
+		err := fetcher.Close()
+		if err != nil {
+			fmt.Println("could not close fetcher", err.Error())
+		}
+		close(parsed)
+	})
+
+	persisted := make(chan struct{})
+	runStage(config.persistWorkers(), func() {
+		for page := range parsed {
+			saved := 0
+			if page.persist {
+				ok := runItem("persist", page.scraped.Post, func() {
+					saved = persistPage(ctx, store, config, sinks, page.scraped)
+				})
+
+				if !ok {
+					fail(len(page.scraped.posts()))
+					continue
+				}
+			}
+
+			summaryMu.Lock()
+			summary.failed += page.failed
+			summary.saved += saved
+			summaryMu.Unlock()
+		}
+	}, func() {
+		close(persisted)
+	})
+
+	<-persisted
+
+	return summary
+}
+
+// runStage starts n workers running work, and calls done once they have all
+// returned.
+func runStage(n int, work func(), done func()) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		done()
+	}()
+}
+
+// runItem runs the work for one post's page in a stage, reporting whether it
+// returned rather than panicked. A panic, e.g. on a hostile page, is reported
+// with the post so the worker can carry on with the next item.
+func runItem(stage string, post Post, work func()) (finished bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println("Recovered in", stage, "stage for", post.Url, r)
+			reportPostPanic(stage, post, r)
+		}
+	}()
+
+	work()
+
+	return true
+}
+
+// getPostHtml fetches the page shared by a group of posts. The first post
+// fetches it on behalf of the rest.
+func getPostHtml(fetcher Fetcher, posts []Post) PostScraped {
+	post := posts[0]
+
+	scrapedPost := PostScraped{
+		Post:          post,
+		Duplicates:    posts[1:],
+		Html:          "",
+		OpenGraphTags: OpenGraphTags{},
+	}
+
+	fetchStarted := clock.Now()
+	page := fetcher.FetchPage(post, post.Url)
+	scrapedPost.Html, scrapedPost.StatusCode, scrapedPost.FetchErr = page.Html, page.StatusCode, page.Err
+	scrapedPost.Header, scrapedPost.FinalUrl, scrapedPost.ContentLength = page.Header, page.FinalUrl, page.ContentLength
+	scrapedPost.FetchDuration = clock.Now().Sub(fetchStarted)
+
+	return scrapedPost
+}
+
+// parseFetchedPage records the attempt for every post the page belongs to and
+// parses it.
+func parseFetchedPage(
+	ctx context.Context, fetcher Fetcher, store Store, config AppConfig, scrapedPost PostScraped,
+) parsedPage {
+	page := parsedPage{scraped: scrapedPost}
+	if scrapedPost.Html == "" {
+		page.failed = len(scrapedPost.posts())
+	}
+
+	for _, post := range scrapedPost.posts() {
+		attempt := newScrapeAttempt(scrapedPost)
+		attempt.PostID = post.PostID
+
+		err := store.RecordAttempt(ctx, attempt)
+		if err != nil {
+			fmt.Println("could not record scrape attempt", post.Url, err.Error())
+			reportError("db", post, err)
+		}
+
+		// there is nothing to keep when the request didn't get a response
+		if scrapedPost.StatusCode == 0 {
+			continue
+		}
+
+		response := newResponseMetadata(scrapedPost)
+		response.PostID = post.PostID
+
+		err = store.SaveResponse(ctx, response)
+		if err != nil {
+			fmt.Println("could not save response metadata", post.Url, err.Error())
+			reportError("db", post, err)
+		}
+	}
+
+	fmt.Println("parsing html returned from", scrapedPost.Post.Url)
+
+	parseScrapedPost(fetcher, config, &scrapedPost)
+
+	if reason := permanentFailureReason(scrapedPost); reason != "" {
+		fmt.Println("not retrying", scrapedPost.Post.Url, reason)
+		scrapedPost.note("%s", reason)
+
+		for _, post := range scrapedPost.posts() {
+			err := store.MarkPermanentFailure(ctx, post.PostID, reason)
+			if err != nil {
+				fmt.Println("could not mark permanent failure", post.Url, err.Error())
+				reportError("db", post, err)
+			}
+		}
+
+		auditPage(ctx, store, config, scrapedPost, auditPermanentFailure)
+
+		return page
+	}
+
+	if reason := softNotFoundReason(scrapedPost, config.softNotFound); reason != "" {
+		fmt.Println("skipping soft 404 from", scrapedPost.Post.Url, reason)
+		scrapedPost.note("%s", reason)
+		auditPage(ctx, store, config, scrapedPost, auditSoftNotFound)
+		return page
+	}
+
+	enrichment.run(ctx, &scrapedPost)
+
+	page.scraped = scrapedPost
+	page.persist = true
+
+	return page
+}
+
+// auditPage records the same outcome for each post sharing the page.
+func auditPage(ctx context.Context, store Store, config AppConfig, scrapedPost PostScraped, outcome string) {
+	for _, post := range scrapedPost.posts() {
+		scraped := scrapedPost
+		scraped.Post = post
+		recordAudit(ctx, store, config, scraped, outcome, nil)
+	}
+}
+
+// persistPage saves a parsed page for every post it belongs to, returning how
+// many had metadata saved.
+func persistPage(ctx context.Context, store Store, config AppConfig, sinks []Sink, scrapedPost PostScraped) int {
+	saved := 0
+
+	for _, post := range scrapedPost.posts() {
+		scraped := scrapedPost
+		scraped.Post = post
+		if persistScrapedPost(ctx, store, config, sinks, scraped) {
+			saved++
+		}
+	}
+
+	return saved
+}
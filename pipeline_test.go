@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestCycleSavesMetadata(t *testing.T) {
+	site := newFixtureSite(t)
+	store := newMemoryStore([]Post{
+		{PostID: 1, Url: site.URL + "/article.html"},
+		{PostID: 2, Url: site.URL + "/plain.html", OrigDescription: "from the feed"},
+		{PostID: 3, Url: site.URL + "/missing.html"},
+	})
+	sink := &memorySink{}
+
+	runCycle(t, store, testConfig(), sink)
+
+	saved, ok := store.Saved(1)
+	if !ok {
+		t.Fatal("article was not saved")
+	}
+
+	tags := saved.OpenGraphTags
+	if tags.Description != "What we learned building an opengraph parser." {
+		t.Errorf("description = %q", tags.Description)
+	}
+	if want := "https://cdn.example.com/images/parser.png"; tags.FeaturedImage != want {
+		t.Errorf("featured image = %q, want %q", tags.FeaturedImage, want)
+	}
+	if want := "https://blog.example.com/posts/parser"; tags.canonicalUrl() != want {
+		t.Errorf("canonical url = %q, want %q", tags.canonicalUrl(), want)
+	}
+	if tags.WordCount == 0 {
+		t.Error("word count was not counted")
+	}
+
+	if _, ok := store.Saved(2); ok {
+		t.Error("page without metadata was saved")
+	}
+	if _, ok := store.Saved(3); ok {
+		t.Error("missing page was saved")
+	}
+
+	events := sink.Events()
+	if len(events) != 1 || events[0].PostID != 1 {
+		t.Fatalf("sink got %+v, want one event for post 1", events)
+	}
+
+	statuses := make(map[int64]int)
+	for _, attempt := range store.Attempts() {
+		statuses[attempt.PostID] = attempt.StatusCode
+	}
+	want := map[int64]int{1: http.StatusOK, 2: http.StatusOK, 3: http.StatusNotFound}
+	for postID, status := range want {
+		if statuses[postID] != status {
+			t.Errorf("attempt for post %d has status %d, want %d", postID, statuses[postID], status)
+		}
+	}
+
+	response := store.responses[1]
+	if response.StatusCode != http.StatusOK || response.ContentType == "" || response.FinalUrl != site.URL+"/article.html" {
+		t.Errorf("response metadata = %+v", response)
+	}
+
+	branding := store.brandings[routingKeyDomain(site.URL)]
+	if branding.SiteName != "Example Blog" || branding.ThemeColor != "#336699" {
+		t.Errorf("site branding = %+v", branding)
+	}
+}
+
+func TestCycleSkipsUnchangedPosts(t *testing.T) {
+	site := newFixtureSite(t)
+	store := newMemoryStore([]Post{{PostID: 1, Url: site.URL + "/article.html"}})
+	sink := &memorySink{}
+
+	runCycle(t, store, testConfig(), sink)
+	runCycle(t, store, testConfig(), sink)
+
+	if hits := site.hitsFor("/article.html"); hits != 2 {
+		t.Errorf("article fetched %d times, want once per cycle", hits)
+	}
+
+	if events := sink.Events(); len(events) != 1 {
+		t.Errorf("sink got %d events, want the unchanged post sent once", len(events))
+	}
+}
+
+func TestCycleRetriesFailedSolrWrites(t *testing.T) {
+	site := newFixtureSite(t)
+	store := newMemoryStore([]Post{{PostID: 1, Url: site.URL + "/article.html"}})
+
+	var mu sync.Mutex
+	updates := 0
+	solr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		updates++
+		if updates == 1 {
+			http.Error(w, "solr is restarting", http.StatusServiceUnavailable)
+		}
+	}))
+	defer solr.Close()
+
+	config := testConfig()
+	config.Solr = solr.URL
+
+	runCycle(t, store, config)
+	runCycle(t, store, config)
+	runCycle(t, store, config)
+
+	if updates != 2 {
+		t.Errorf("solr got %d updates, want the failed one retried once", updates)
+	}
+}
+
+func TestCycleFetchesSharedUrlsOnce(t *testing.T) {
+	site := newFixtureSite(t)
+	store := newMemoryStore([]Post{
+		{PostID: 1, Url: site.URL + "/article.html"},
+		{PostID: 2, Url: site.URL + "/article.html?utm_source=feed"},
+	})
+
+	runCycle(t, store, testConfig())
+
+	if hits := site.hitsFor("/article.html"); hits != 1 {
+		t.Errorf("article fetched %d times, want once", hits)
+	}
+
+	for _, postID := range []int64{1, 2} {
+		if _, ok := store.Saved(postID); !ok {
+			t.Errorf("post %d was not saved", postID)
+		}
+	}
+}
+
+func TestCycleFollowsRedirects(t *testing.T) {
+	site := newFixtureSite(t)
+	store := newMemoryStore([]Post{{PostID: 1, Url: site.URL + "/moved.html"}})
+
+	runCycle(t, store, testConfig())
+
+	if _, ok := store.Saved(1); !ok {
+		t.Fatal("redirected post was not saved")
+	}
+
+	if got, want := store.responses[1].FinalUrl, site.URL+"/article.html"; got != want {
+		t.Errorf("final url = %q, want %q", got, want)
+	}
+}
+
+// panickingSink panics writing one post, like a sink tripping over a hostile
+// page would.
+type panickingSink struct {
+	memorySink
+	postID int64
+}
+
+func (s *panickingSink) Write(scraped PostScraped) error {
+	if scraped.Post.PostID == s.postID {
+		panic("hostile page")
+	}
+
+	return s.memorySink.Write(scraped)
+}
+
+type recordingReporter struct {
+	mu      sync.Mutex
+	reports []ErrorContext
+}
+
+func (r *recordingReporter) Report(err error, errCtx ErrorContext) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reports = append(r.reports, errCtx)
+}
+
+func TestScrapePostsCountsPanickingPageAsFailed(t *testing.T) {
+	reporter := &recordingReporter{}
+	errorReporter = reporter
+	t.Cleanup(func() {
+		errorReporter = nopErrorReporter{}
+	})
+
+	site := newFixtureSite(t)
+	posts := []Post{
+		{PostID: 1, Url: site.URL + "/article.html?v=1"},
+		{PostID: 2, Url: site.URL + "/article.html?v=2"},
+		{PostID: 3, Url: site.URL + "/article.html?v=3"},
+	}
+	store := newMemoryStore(posts)
+	sink := &panickingSink{postID: 2}
+
+	config := testConfig()
+	config.PersistWorkers = 1
+	summary := scrapePosts(context.Background(), store, config, []Sink{sink}, posts, nil)
+
+	if summary.failed != 1 || summary.saved != 2 {
+		t.Errorf("failed %d and saved %d, want 1 and 2", summary.failed, summary.saved)
+	}
+
+	// the one persist worker carried on after the panic
+	if events := sink.Events(); len(events) != 2 {
+		t.Errorf("sink got %d events, want 2", len(events))
+	}
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+	if len(reporter.reports) != 1 {
+		t.Fatalf("reported %+v, want one panic", reporter.reports)
+	}
+	if got := reporter.reports[0]; got.Phase != "persist" || got.PostID != 2 || got.Url != posts[1].Url {
+		t.Errorf("reported %+v, want the persist stage and post 2", got)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// PostFilter narrows which recent posts a cycle scrapes. Only the conditions
+// that are set apply.
+type PostFilter struct {
+	// FeedIDs only scrapes posts from these feeds
+	FeedIDs        []int64 `json:"feedIds"`
+	ExcludeFeedIDs []int64 `json:"excludeFeedIds"`
+	// MissingDescription only scrapes posts the aggregator has no
+	// description for, unless they have been given a priority above 0 or
+	// belong to one of RescrapeFeedIDs.
+	MissingDescription bool    `json:"missingDescription"`
+	RescrapeFeedIDs    []int64 `json:"rescrapeFeedIds"`
+	// ExcludeDomains skips posts on these domains and their subdomains
+	ExcludeDomains []string `json:"excludeDomains"`
+}
+
+// sqlConditions are appended to a query's WHERE clause.
+func (f PostFilter) sqlConditions() (string, []interface{}) {
+	conditions := ""
+	args := make([]interface{}, 0, len(f.FeedIDs)+len(f.ExcludeFeedIDs)+len(f.RescrapeFeedIDs))
+
+	inList := func(ids []int64) string {
+		placeholders := make([]string, len(ids))
+		for i, id := range ids {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+
+		return "(" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	if len(f.FeedIDs) > 0 {
+		conditions += " AND fk_feed_id IN " + inList(f.FeedIDs)
+	}
+
+	if len(f.ExcludeFeedIDs) > 0 {
+		conditions += " AND (fk_feed_id IS NULL OR fk_feed_id NOT IN " + inList(f.ExcludeFeedIDs) + ")"
+	}
+
+	if f.MissingDescription {
+		forced := " OR priority > 0"
+		if len(f.RescrapeFeedIDs) > 0 {
+			forced += " OR fk_feed_id IN " + inList(f.RescrapeFeedIDs)
+		}
+
+		conditions += " AND (description IS NULL OR description = ''" + forced + ")"
+	}
+
+	return conditions, args
+}
+
+// byDomain leaves out posts on excluded domains, which is simpler to match
+// on the parsed host than in sql.
+func (f PostFilter) byDomain(posts []Post) []Post {
+	if len(f.ExcludeDomains) == 0 {
+		return posts
+	}
+
+	kept := make([]Post, 0, len(posts))
+	for _, post := range posts {
+		u, err := url.Parse(post.Url)
+		if err == nil && hostMatches(u.Hostname(), f.ExcludeDomains) {
+			continue
+		}
+
+		kept = append(kept, post)
+	}
+
+	return kept
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// defaultFieldPrecedence is the order sources are tried in for each field
+// unless the fieldPrecedence config says otherwise.
+var defaultFieldPrecedence = map[string][]string{
+	"title":          {sourceHtml, sourceOg, sourceTwitter, sourceJsonLd},
+	"description":    {sourceOg, sourceDublinCore, sourceTwitter, sourceJsonLd, sourceMeta},
+	"featured_image": {sourceOg, sourceTwitter, sourceJsonLd, sourceHeuristic},
+}
+
+var knownSources = map[string]bool{
+	sourceOg: true, sourceTwitter: true, sourceJsonLd: true, sourceMeta: true,
+	sourceDublinCore: true, sourceHtml: true, sourceHeuristic: true,
+}
+
+// fieldPrecedence is configured by applyConfig.
+var fieldPrecedence = struct {
+	mu     sync.RWMutex
+	fields map[string][]string
+}{fields: defaultFieldPrecedence}
+
+// setFieldPrecedence replaces the order of sources for the fields the config
+// names. Sources left out of a field's list are never used for it.
+func setFieldPrecedence(config map[string][]string) {
+	fields := make(map[string][]string, len(defaultFieldPrecedence))
+	for field, sources := range defaultFieldPrecedence {
+		fields[field] = sources
+	}
+
+	for field, sources := range config {
+		if _, ok := defaultFieldPrecedence[field]; !ok {
+			fmt.Println("ignoring precedence for unknown field", field)
+			continue
+		}
+
+		for _, source := range sources {
+			if !knownSources[source] {
+				fmt.Println("unknown source", source, "in precedence for", field)
+			}
+		}
+
+		fields[field] = sources
+	}
+
+	fieldPrecedence.mu.Lock()
+	fieldPrecedence.fields = fields
+	fieldPrecedence.mu.Unlock()
+}
+
+func precedenceFor(field string) []string {
+	fieldPrecedence.mu.RLock()
+	defer fieldPrecedence.mu.RUnlock()
+
+	return fieldPrecedence.fields[field]
+}
+
+// addCandidate offers a value for a field. Only the first value from each
+// source is kept.
+func (t *OpenGraphTags) addCandidate(field string, source string, raw string) {
+	if strings.TrimSpace(raw) == "" {
+		return
+	}
+
+	if t.candidates == nil {
+		t.candidates = make(map[string]map[string]string)
+	}
+
+	if t.candidates[field] == nil {
+		t.candidates[field] = make(map[string]string)
+	}
+
+	if _, ok := t.candidates[field][source]; !ok {
+		t.candidates[field][source] = raw
+	}
+}
+
+// applyPrecedence sets each field from the first source in its precedence
+// that offered a value.
+func (t *OpenGraphTags) applyPrecedence() {
+	for field := range defaultFieldPrecedence {
+		for _, source := range precedenceFor(field) {
+			raw, ok := t.candidates[field][source]
+			if !ok {
+				continue
+			}
+
+			switch field {
+			case "title":
+				t.Title = strings.TrimSpace(raw)
+			case "description":
+				t.Description = raw
+			case "featured_image":
+				t.FeaturedImage = strings.TrimSpace(raw)
+			}
+
+			t.setSource(field, source, raw)
+			break
+		}
+	}
+}
+
+// addJsonLdCandidates offers the headline, description and image of the
+// first json-ld item that has any of them.
+func (t *OpenGraphTags) addJsonLdCandidates() {
+	for _, raw := range t.JsonLd {
+		var value interface{}
+		if json.Unmarshal(raw, &value) != nil {
+			continue
+		}
+
+		if item := findJsonLdItem(value); item != nil {
+			t.addCandidate("title", sourceJsonLd, jsonLdString(item["headline"]))
+			t.addCandidate("description", sourceJsonLd, jsonLdString(item["description"]))
+			t.addCandidate("featured_image", sourceJsonLd, jsonLdUrl(item["image"]))
+			return
+		}
+	}
+}
+
+// findJsonLdItem looks through arrays and @graph for an item with a
+// headline, or failing that a description.
+func findJsonLdItem(value interface{}) map[string]interface{} {
+	var withDescription map[string]interface{}
+
+	var walk func(value interface{}) map[string]interface{}
+	walk = func(value interface{}) map[string]interface{} {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				if found := walk(item); found != nil {
+					return found
+				}
+			}
+		case map[string]interface{}:
+			if jsonLdString(v["headline"]) != "" {
+				return v
+			}
+			if withDescription == nil && jsonLdString(v["description"]) != "" {
+				withDescription = v
+			}
+			if graph, ok := v["@graph"]; ok {
+				return walk(graph)
+			}
+		}
+		return nil
+	}
+
+	if found := walk(value); found != nil {
+		return found
+	}
+
+	return withDescription
+}
+
+func jsonLdString(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+// jsonLdUrl reads an image given as a url, an ImageObject or a list of
+// either.
+func jsonLdUrl(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if imageUrl := jsonLdString(v["url"]); imageUrl != "" {
+			return imageUrl
+		}
+		return jsonLdString(v["contentUrl"])
+	case []interface{}:
+		for _, item := range v {
+			if imageUrl := jsonLdUrl(item); imageUrl != "" {
+				return imageUrl
+			}
+		}
+	}
+
+	return ""
+}
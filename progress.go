@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const progressLogInterval = 30 * time.Second
+
+// progressLogger prints how far through a batch of posts a run is, at most
+// every progressLogInterval, so long cycles and backfills show a rate and ETA.
+// A nil progressLogger logs nothing.
+type progressLogger struct {
+	mu        sync.Mutex
+	label     string
+	total     int
+	processed int
+	started   time.Time
+	lastLog   time.Time
+}
+
+func newProgressLogger(label string, total int) *progressLogger {
+	now := clock.Now()
+
+	return &progressLogger{label: label, total: total, started: now, lastLog: now}
+}
+
+func (p *progressLogger) add(n int) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.processed += n
+
+	now := clock.Now()
+	if now.Sub(p.lastLog) < progressLogInterval {
+		return
+	}
+
+	p.lastLog = now
+	fmt.Println(p.line(now))
+}
+
+func (p *progressLogger) line(now time.Time) string {
+	elapsed := now.Sub(p.started)
+	rate := float64(p.processed) / elapsed.Seconds()
+
+	line := fmt.Sprintf("%s: %d/%d posts", p.label, p.processed, p.total)
+	if p.total > 0 {
+		line += fmt.Sprintf(" (%.1f%%)", float64(p.processed)/float64(p.total)*100)
+	}
+
+	line += fmt.Sprintf(", %.1f posts/s", rate)
+
+	if rate > 0 && p.total > p.processed {
+		eta := time.Duration(float64(p.total-p.processed) / rate * float64(time.Second))
+		line += ", ETA " + eta.Round(time.Second).String()
+	}
+
+	return line
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// hostTransport sends requests to some hosts through a transport of their
+// own, e.g. one that won't speak http/2 to them.
+type hostTransport struct {
+	base      http.RoundTripper
+	match     func(host string) bool
+	transport http.RoundTripper
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.match(req.URL.Hostname()) {
+		return t.transport.RoundTrip(req)
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// disableHttp2 keeps a transport to http/1.1, even when a server offers h2.
+func disableHttp2(transport *http.Transport) {
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+
+	if transport.TLSClientConfig != nil {
+		transport.TLSClientConfig = transport.TLSClientConfig.Clone()
+		transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+}
+
+// protocolTransport keeps transport from using http/2 with the hosts that
+// are configured not to.
+func (f *httpFetcher) protocolTransport(transport *http.Transport) http.RoundTripper {
+	if f.http1Only {
+		disableHttp2(transport)
+		return transport
+	}
+
+	if len(f.http1Hosts) > 0 || f.domains.anySet(func(d DomainConfig) bool { return d.Http1Only }) {
+		http1Transport := transport.Clone()
+		disableHttp2(http1Transport)
+		return &hostTransport{base: transport, match: f.isHttp1OnlyHost, transport: http1Transport}
+	}
+
+	return transport
+}
+
+func (f *httpFetcher) isHttp1OnlyHost(host string) bool {
+	return hostMatches(host, f.http1Hosts) || f.domains.http1Only(host)
+}
+
+// WithHttp1Only stops the fetcher from using http/2 with any host.
+func WithHttp1Only() Option {
+	return func(f *httpFetcher) {
+		f.http1Only = true
+	}
+}
+
+// WithHttp1Hosts fetches from these hosts, and their subdomains, over
+// http/1.1, for servers whose h2 is broken, e.g. with GOAWAY storms.
+func WithHttp1Hosts(hosts []string) Option {
+	return func(f *httpFetcher) {
+		f.http1Hosts = hosts
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+// sources a metadata field can come from, besides the names of enrichers
+const (
+	sourceOg         = "og"
+	sourceTwitter    = "twitter"
+	sourceJsonLd     = "jsonld"
+	sourceMeta       = "meta"
+	sourceDublinCore = "dublin_core"
+	sourceHtml       = "html"
+	sourceLink       = "link"
+	sourceHeuristic  = "heuristic"
+)
+
+// FieldSource is where a field's value came from, and the value as it was
+// found before it was normalized.
+type FieldSource struct {
+	Source string `json:"source"`
+	Raw    string `json:"raw,omitempty"`
+}
+
+// Result is the metadata the parser extracted from a page, with the source of
+// every field, so consumers can decide which sources they trust.
+type Result struct {
+	Url    string                 `json:"url"`
+	Fields map[string]ResultField `json:"fields"`
+}
+
+type ResultField struct {
+	Value string `json:"value"`
+	FieldSource
+}
+
+// Parse extracts the metadata of a page that has already been fetched.
+func Parse(pageUrl string, pageHtml string) Result {
+	scraped := PostScraped{Post: Post{Url: pageUrl}, Html: pageHtml}
+
+	getOgTagsFromHtml(&scraped)
+	scraped.OpenGraphTags.normalize(0)
+	scraped.OpenGraphTags.cleanUrls(nil)
+
+	return scraped.OpenGraphTags.result(pageUrl)
+}
+
+func (t *OpenGraphTags) setSource(field string, source string, raw string) {
+	if t.Sources == nil {
+		t.Sources = make(map[string]FieldSource)
+	}
+
+	t.Sources[field] = FieldSource{Source: source, Raw: raw}
+}
+
+// result pairs the main fields with their sources.
+func (t OpenGraphTags) result(pageUrl string) Result {
+	canonicalSource := t.Sources["canonical_url"]
+	if t.Canonical == "" {
+		canonicalSource = t.Sources["url"]
+	}
+
+	values := []struct {
+		field  string
+		value  string
+		source FieldSource
+	}{
+		{"title", t.Title, t.Sources["title"]},
+		{"description", t.Description, t.Sources["description"]},
+		{"featured_image", t.FeaturedImage, t.Sources["featured_image"]},
+		{"canonical_url", t.canonicalUrl(), canonicalSource},
+		{"language", t.Language, t.Sources["language"]},
+		{"direction", t.Direction, t.Sources["direction"]},
+		{"icon", t.Icon, t.Sources["icon"]},
+	}
+
+	result := Result{Url: pageUrl, Fields: make(map[string]ResultField)}
+	for _, v := range values {
+		if v.value != "" {
+			result.Fields[v.field] = ResultField{Value: v.value, FieldSource: v.source}
+		}
+	}
+
+	return result
+}
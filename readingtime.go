@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// readingWordsPerMinute is an adult's average silent reading speed.
+const readingWordsPerMinute = 230
+
+// countWords counts the words of text. Chinese and Japanese aren't written
+// with spaces between words, so each of their characters counts as one.
+func countWords(text string) int {
+	words := 0
+	for _, field := range strings.Fields(text) {
+		inWord := false
+		for _, r := range field {
+			switch {
+			case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+				words++
+				inWord = false
+			case unicode.IsLetter(r) || unicode.IsDigit(r):
+				if !inWord {
+					words++
+					inWord = true
+				}
+			}
+		}
+	}
+
+	return words
+}
+
+// readingMinutes rounds up, so any text at all takes at least a minute.
+func readingMinutes(words int) int {
+	if words <= 0 {
+		return 0
+	}
+
+	return (words + readingWordsPerMinute - 1) / readingWordsPerMinute
+}
+
+// setReadingTime counts the article text, which is capped at maxParagraphs
+// so the longest pages are undercounted.
+func (t *OpenGraphTags) setReadingTime() {
+	t.WordCount = countWords(t.articleText())
+	t.ReadingMinutes = readingMinutes(t.WordCount)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// runReparse extracts the metadata of posts again from their stored html,
+// e.g. after a parser fix, and saves it to the db, Solr and sinks without
+// fetching any pages: ogparser reparse [-ids 1,2,3] [-since 72h] [-from-id n]
+func runReparse(args []string) {
+	flags := flag.NewFlagSet("reparse", flag.ExitOnError)
+	ids := flags.String("ids", "", "comma separated ids of the posts to reparse")
+	since := flags.String("since", "", "only reparse posts saved since a date (2006-01-02) or for a duration (72h)")
+	fromID := flags.Int64("from-id", 0, "only reparse posts with a greater id")
+	batchSize := flags.Int("batch", 200, "how many posts to load at once")
+	tenantName := flags.String("tenant", primaryTenantName, "which tenant's posts to reparse")
+	_ = flags.Parse(args)
+
+	query := StoredPostsQuery{AfterID: *fromID, WithContent: true, Limit: *batchSize}
+
+	for _, id := range strings.Split(*ids, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+
+		postID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			kill("parsing post id", err)
+		}
+		query.IDs = append(query.IDs, postID)
+	}
+
+	if *since != "" {
+		var err error
+		query.ModifiedSince, err = parseSince(*since)
+		if err != nil {
+			kill("parsing -since", err)
+		}
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		kill("loading config file", err)
+	}
+
+	err = config.StoredHtml.reparsable()
+	if err != nil {
+		kill("reparsing stored html", err)
+	}
+
+	applyConfig(config)
+
+	tenantConfig, ok := findTenantConfig(config, *tenantName)
+	if !ok {
+		kill("finding tenant", fmt.Errorf("no tenant named %s", *tenantName))
+	}
+
+	config = config.forTenant(tenantConfig)
+	currentTenant = tenantConfig.Name
+
+	store, err := newSqlStore(config.Db)
+	if err != nil {
+		kill("opening db connection", err)
+	}
+
+	defer func() {
+		_ = store.Close()
+	}()
+
+	sinks := newSinks(config.Sinks)
+
+	defer func() {
+		closeSinks(sinks)
+	}()
+
+	ctx := context.Background()
+	enrichment.startCycle()
+
+	total := 0
+	if len(query.IDs) == 0 && query.ModifiedSince.IsZero() {
+		total, err = store.CountPostsAfterID(ctx, query.AfterID)
+		if err != nil {
+			kill("counting posts", err)
+		}
+	}
+
+	progress := newProgressLogger("reparse", total)
+	reparsed, saved := 0, 0
+
+	for {
+		posts, err := store.StoredPosts(ctx, query)
+		if err != nil {
+			kill(fmt.Sprintf("loading posts after id %d", query.AfterID), err)
+		}
+
+		if len(posts) == 0 {
+			break
+		}
+
+		stored := make(chan StoredPost)
+		go func() {
+			defer close(stored)
+			for _, post := range posts {
+				stored <- post
+			}
+		}()
+
+		var mu sync.Mutex
+		done := make(chan struct{})
+		runStage(config.parseWorkers(), func() {
+			for post := range stored {
+				ok := false
+				runItem("reparse", post.Post, func() {
+					ok = reparsePost(ctx, store, config, sinks, post)
+				})
+				progress.add(1)
+
+				mu.Lock()
+				reparsed++
+				if ok {
+					saved++
+				}
+				mu.Unlock()
+			}
+		}, func() {
+			close(done)
+		})
+
+		<-done
+
+		query.AfterID = posts[len(posts)-1].Post.PostID
+	}
+
+	fmt.Println("Reparse finished, saved metadata for", saved, "of", reparsed, "posts, last post id", query.AfterID)
+}
+
+// reparsePost saves the metadata extracted from a post's stored html, running
+// the configured enrichers as a scrape would, so their fields aren't lost.
+// That includes the llm enricher, which is called for every post without a
+// long enough description, within its per cycle token budget for the whole
+// run. Posts without stored html are skipped.
+func reparsePost(ctx context.Context, store Store, config AppConfig, sinks []Sink, stored StoredPost) bool {
+	if stored.Content == "" {
+		return false
+	}
+
+	scraped := reparseStoredPost(config, stored)
+	enrichment.run(ctx, &scraped)
+
+	return persistScrapedPost(ctx, store, config, sinks, scraped)
+}
+
+// reparseStoredPost extracts the metadata of a post from its stored html,
+// without fetching anything, so fallbacks and image probing are left out.
+// Enrichers are up to the caller: reparse runs them, export -reparse doesn't.
+func reparseStoredPost(config AppConfig, stored StoredPost) PostScraped {
+	scraped := PostScraped{Post: stored.Post, Html: stored.Content}
+	if scraped.Html == "" {
+		return scraped
+	}
+
+	getOgTagsFromHtml(&scraped)
+	scraped.OpenGraphTags.normalize(config.MaxDescriptionLength)
+	scraped.OpenGraphTags.cleanUrls(config.TrackingParams)
+	applyImagePolicy(config.ImagePolicy, &scraped)
+
+	return scraped
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	defaultDnsTimeout = 5 * time.Second
+	// maxDohResponseSize is far more than any answer with a few addresses
+	maxDohResponseSize = 64 << 10
+)
+
+// DnsConfig resolves the hosts of the pages fetched with other servers than
+// the ones in resolv.conf.
+type DnsConfig struct {
+	// Servers are asked in turn, as host:port or just host for port 53
+	Servers []string `json:"servers"`
+	// DohUrl is a DNS over HTTPS endpoint, e.g.
+	// https://cloudflare-dns.com/dns-query, used instead of Servers. Its own
+	// host is resolved the usual way, unless it's an ip.
+	DohUrl  string `json:"dohUrl"`
+	Timeout string `json:"timeout"`
+}
+
+// hostResolver is the part of net.Resolver used for dialing.
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// newHostResolver returns the resolver for the config, the system's when
+// nothing is configured.
+func newHostResolver(config DnsConfig) hostResolver {
+	timeout := parseDurationOr(config.Timeout, defaultDnsTimeout)
+
+	if config.DohUrl != "" {
+		return &dohResolver{url: config.DohUrl, client: &http.Client{Timeout: timeout}}
+	}
+
+	if len(config.Servers) > 0 {
+		return newServersResolver(config.Servers, timeout)
+	}
+
+	return net.DefaultResolver
+}
+
+// newServersResolver sends the go resolver's queries to the given servers,
+// moving on to the next one for every query so a dead server only costs
+// the queries sent its way.
+func newServersResolver(servers []string, timeout time.Duration) *net.Resolver {
+	addrs := make([]string, len(servers))
+	for i, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		addrs[i] = server
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var next uint32
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+			server := addrs[int(atomic.AddUint32(&next, 1)-1)%len(addrs)]
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// dohResolver resolves hosts with DNS over HTTPS (RFC 8484).
+type dohResolver struct {
+	url    string
+	client *http.Client
+}
+
+func (r *dohResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, _, err := r.lookupHostTtl(ctx, host)
+
+	return addrs, err
+}
+
+// lookupHostTtl also returns the lowest TTL of the records answered.
+func (r *dohResolver) lookupHostTtl(ctx context.Context, host string) ([]string, time.Duration, error) {
+	addrs := make([]string, 0)
+	var ttl time.Duration
+	var firstErr error
+
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		found, foundTtl, err := r.query(ctx, host, qtype)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if len(found) > 0 && (len(addrs) == 0 || foundTtl < ttl) {
+			ttl = foundTtl
+		}
+
+		addrs = append(addrs, found...)
+	}
+
+	if len(addrs) > 0 {
+		return addrs, ttl, nil
+	}
+
+	if firstErr != nil {
+		return nil, 0, firstErr
+	}
+
+	return nil, 0, &net.DNSError{Err: "no such host", Name: host, Server: r.url, IsNotFound: true}
+}
+
+func (r *dohResolver) query(ctx context.Context, host string, qtype dnsmessage.Type) ([]string, time.Duration, error) {
+	if !strings.HasSuffix(host, ".") {
+		host += "."
+	}
+
+	name, err := dnsmessage.NewName(host)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the id is 0 so responses can be cached by http caches
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest("POST", r.url, bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("dns over https returned status %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDohResponseSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var reply dnsmessage.Message
+	err = reply.Unpack(body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("decoding dns over https response: %w", err)
+	}
+
+	switch reply.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+	default:
+		return nil, 0, &net.DNSError{Err: "server answered " + reply.RCode.String(), Name: host, Server: r.url}
+	}
+
+	// a cname chain comes with the addresses it ends in, and the chain is
+	// only good for as long as its shortest lived record
+	addrs := make([]string, 0, len(reply.Answers))
+	ttl := time.Duration(0)
+	for i, answer := range reply.Answers {
+		if recordTtl := time.Duration(answer.Header.TTL) * time.Second; i == 0 || recordTtl < ttl {
+			ttl = recordTtl
+		}
+
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, net.IP(body.AAAA[:]).String())
+		}
+	}
+
+	return addrs, ttl, nil
+}
+
+// WithResolver resolves hosts through resolver when there is no dns cache.
+func WithResolver(resolver hostResolver) Option {
+	return func(f *httpFetcher) {
+		f.resolver = resolver
+	}
+}
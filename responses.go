@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ResponseMetadata is what the server answered the latest time a post's page
+// was fetched, kept for debugging fetches and for analytics about the sites
+// that are aggregated.
+type ResponseMetadata struct {
+	PostID      int64
+	StatusCode  int
+	FinalUrl    string
+	ContentType string
+	// ContentLength is -1 when it isn't known
+	ContentLength int64
+	Server        string
+	Duration      time.Duration
+	Fetched       time.Time
+}
+
+func newResponseMetadata(scraped PostScraped) ResponseMetadata {
+	response := ResponseMetadata{
+		PostID:        scraped.Post.PostID,
+		StatusCode:    scraped.StatusCode,
+		FinalUrl:      scraped.FinalUrl,
+		ContentLength: scraped.ContentLength,
+		Duration:      scraped.FetchDuration,
+		Fetched:       clock.Now().UTC(),
+	}
+
+	if scraped.Header != nil {
+		response.ContentType = scraped.Header.Get("Content-Type")
+		response.Server = scraped.Header.Get("Server")
+	}
+
+	return response
+}
+
+func (s *sqlStore) SaveResponse(ctx context.Context, response ResponseMetadata) error {
+	contentLength := sql.NullInt64{Int64: response.ContentLength, Valid: response.ContentLength >= 0}
+
+	_, err := s.db.ExecContext(
+		ctx,
+		s.dialect.upsertResponseQuery,
+		response.PostID,
+		response.StatusCode,
+		nullString(truncateRunes(response.FinalUrl, 2000)),
+		nullString(truncateRunes(response.ContentType, 255)),
+		contentLength,
+		nullString(truncateRunes(response.Server, 255)),
+		response.Duration.Milliseconds(),
+		response.Fetched.Format("2006-01-02 15:04:05"),
+	)
+
+	return err
+}
+
+func (s *memoryStore) SaveResponse(ctx context.Context, response ResponseMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses[response.PostID] = response
+
+	return nil
+}
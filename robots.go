@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+)
+
+// RobotsConfig respects noindex and nosnippet directives given in an
+// X-Robots-Tag header or a robots meta tag.
+type RobotsConfig struct {
+	Enabled bool `json:"enabled"`
+	// SkipDescription also leaves the description out of the db, not just
+	// out of solr.
+	SkipDescription bool `json:"skipDescription"`
+	// BotName also applies directives given for this user agent token,
+	// e.g. "X-Robots-Tag: ogparser: noindex" or <meta name="ogparser">.
+	BotName string `json:"botName"`
+}
+
+type robotsDirectives struct {
+	noIndex   bool
+	noSnippet bool
+}
+
+// pageRobots collects the directives that apply to us from the response
+// header and meta tags.
+func pageRobots(scraped PostScraped, botName string) robotsDirectives {
+	directives := robotsDirectives{}
+	botName = strings.ToLower(botName)
+
+	for _, value := range scraped.Header.Values("X-Robots-Tag") {
+		rules := value
+
+		// "googlebot: noindex" only applies to googlebot
+		if i := strings.Index(value, ":"); i >= 0 && !strings.ContainsAny(value[:i], ",") {
+			agent := strings.ToLower(strings.TrimSpace(value[:i]))
+			if !isRobotsRule(agent) {
+				if agent != botName {
+					continue
+				}
+				rules = value[i+1:]
+			}
+		}
+
+		directives.add(rules)
+	}
+
+	for key, values := range scraped.OpenGraphTags.MetaTags {
+		key = strings.ToLower(key)
+		if key != "robots" && (botName == "" || key != botName) {
+			continue
+		}
+
+		for _, value := range values {
+			directives.add(value)
+		}
+	}
+
+	return directives
+}
+
+// isRobotsRule tells a rule with a value, like max-snippet:0, from a user
+// agent token.
+func isRobotsRule(name string) bool {
+	switch name {
+	case "max-snippet", "max-image-preview", "max-video-preview", "unavailable_after":
+		return true
+	}
+
+	return false
+}
+
+func (d *robotsDirectives) add(rules string) {
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.ToLower(strings.Join(strings.Fields(rule), ""))
+
+		switch rule {
+		case "noindex", "none":
+			d.noIndex = true
+		case "nosnippet", "max-snippet:0":
+			d.noSnippet = true
+		}
+	}
+}
+
+// applyRobots keeps a page's description out of solr and the search sinks,
+// and optionally the db, when the page asks not to be indexed or shown in
+// snippets. It reports whether the description may be indexed.
+func applyRobots(config RobotsConfig, scraped *PostScraped) bool {
+	if !config.Enabled {
+		return true
+	}
+
+	directives := pageRobots(*scraped, config.BotName)
+	if !directives.noIndex && !directives.noSnippet {
+		return true
+	}
+
+	scraped.note("page has a noindex or nosnippet robots directive")
+
+	if config.SkipDescription {
+		scraped.OpenGraphTags.Description = ""
+	}
+
+	return false
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultRunsLimit = 100
+
+// ScrapeRun is the outcome of one cycle of a tenant.
+type ScrapeRun struct {
+	ID       int64     `json:"id"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Posts    int       `json:"posts"`
+	Saved    int       `json:"saved"`
+	Failed   int       `json:"failed"`
+	// Error is why the cycle failed, if it did
+	Error string `json:"error,omitempty"`
+}
+
+// recordRun saves a cycle's outcome, which is only logged if it can't be, as
+// the db being down is a common reason for a cycle to fail.
+func recordRun(store Store, run ScrapeRun) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := store.RecordRun(ctx, run)
+	if err != nil {
+		fmt.Println("could not record scrape run", err.Error())
+	}
+}
+
+func (s *sqlStore) RecordRun(ctx context.Context, run ScrapeRun) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO scrape_runs (started, finished, posts, saved, failed, error) VALUES (?, ?, ?, ?, ?, ?)",
+		run.Started.UTC().Format("2006-01-02 15:04:05"),
+		run.Finished.UTC().Format("2006-01-02 15:04:05"),
+		run.Posts,
+		run.Saved,
+		run.Failed,
+		nullString(truncateRunes(run.Error, 1000)),
+	)
+
+	return err
+}
+
+func (s *sqlStore) Runs(ctx context.Context, limit int) ([]ScrapeRun, error) {
+	runs := make([]ScrapeRun, 0)
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT pk_scrape_run_id, started, finished, posts, saved, failed, error FROM scrape_runs "+
+			"ORDER BY started DESC, pk_scrape_run_id DESC LIMIT ?",
+		limit,
+	)
+	if err != nil {
+		return runs, err
+	}
+
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		var started, finished string
+		var runErr sql.NullString
+		run := ScrapeRun{}
+
+		err = rows.Scan(&run.ID, &started, &finished, &run.Posts, &run.Saved, &run.Failed, &runErr)
+		if err != nil {
+			return runs, err
+		}
+
+		run.Started, _ = time.Parse("2006-01-02 15:04:05", started)
+		run.Finished, _ = time.Parse("2006-01-02 15:04:05", finished)
+		run.Error = runErr.String
+
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+func (s *memoryStore) RecordRun(ctx context.Context, run ScrapeRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run.ID = int64(len(s.runs) + 1)
+	s.runs = append(s.runs, run)
+
+	return nil
+}
+
+func (s *memoryStore) Runs(ctx context.Context, limit int) ([]ScrapeRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := make([]ScrapeRun, 0)
+	for i := len(s.runs) - 1; i >= 0 && len(runs) < limit; i-- {
+		runs = append(runs, s.runs[i])
+	}
+
+	return runs, nil
+}
+
+// startAdminServer serves the run history of every tenant:
+// GET /runs?tenant=<name>&limit=<n>, newest first.
+func startAdminServer(addr string, tenants []*tenant) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/runs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		tenantName := r.URL.Query().Get("tenant")
+		if tenantName == "" {
+			tenantName = primaryTenantName
+		}
+
+		limit := defaultRunsLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		for _, t := range tenants {
+			if t.name != tenantName {
+				continue
+			}
+
+			runs, err := t.store.Runs(r.Context(), limit)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(runs)
+			return
+		}
+
+		http.Error(w, "no tenant named "+tenantName, http.StatusNotFound)
+	})
+
+	go func() {
+		fmt.Println("Starting admin server on", addr)
+		err := http.ListenAndServe(addr, mux)
+		if err != nil {
+			fmt.Println("admin server stopped", err.Error())
+		}
+	}()
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"net/url"
+	"strings"
+)
+
+// defaultRemovedElements are dropped along with their content.
+var defaultRemovedElements = []string{
+	"script", "iframe", "frame", "frameset", "object", "embed", "applet", "noscript", "svg", "math", "template",
+}
+
+// allowedElements are kept, with their allowed attributes. Other elements are
+// unwrapped: their tags are dropped and their content kept.
+var allowedElements = map[string]bool{
+	"html": true, "head": true, "body": true, "title": true, "meta": true, "link": true,
+	"main": true, "article": true, "section": true, "header": true, "footer": true, "nav": true, "aside": true,
+	"div": true, "span": true, "p": true, "br": true, "hr": true, "address": true, "details": true, "summary": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"a": true, "img": true, "picture": true, "source": true, "figure": true, "figcaption": true,
+	"video": true, "audio": true, "track": true,
+	"ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"blockquote": true, "q": true, "cite": true, "pre": true, "code": true, "kbd": true, "samp": true, "var": true,
+	"em": true, "strong": true, "b": true, "i": true, "u": true, "s": true, "small": true, "sub": true, "sup": true,
+	"mark": true, "abbr": true, "time": true, "del": true, "ins": true, "wbr": true,
+	"table": true, "caption": true, "colgroup": true, "col": true, "thead": true, "tbody": true, "tfoot": true,
+	"tr": true, "th": true, "td": true,
+}
+
+// rawTextElements hold text the tokenizer doesn't parse as html. Unwrapping
+// them would turn that text into markup, so they're dropped with their
+// content unless kept.
+var rawTextElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "noembed": true, "noframes": true, "noscript": true,
+	"plaintext": true, "textarea": true, "xmp": true,
+}
+
+// globalAttributes are allowed on every kept element.
+var globalAttributes = map[string]bool{
+	"id": true, "class": true, "title": true, "lang": true, "dir": true, "role": true,
+}
+
+// allowedAttributes are allowed on the elements they're listed for. meta
+// leaves out http-equiv, so refreshes and cookies can't be set.
+var allowedAttributes = map[string]map[string]bool{
+	"meta":       {"name": true, "property": true, "content": true, "charset": true, "itemprop": true},
+	"link":       {"rel": true, "href": true, "type": true, "hreflang": true, "sizes": true, "media": true},
+	"a":          {"href": true, "rel": true, "target": true, "hreflang": true, "name": true},
+	"img":        {"src": true, "srcset": true, "sizes": true, "alt": true, "width": true, "height": true, "loading": true},
+	"source":     {"src": true, "srcset": true, "sizes": true, "type": true, "media": true},
+	"video":      {"src": true, "poster": true, "controls": true, "width": true, "height": true, "muted": true, "loop": true, "preload": true},
+	"audio":      {"src": true, "controls": true, "muted": true, "loop": true, "preload": true},
+	"track":      {"src": true, "kind": true, "srclang": true, "label": true, "default": true},
+	"iframe":     {"src": true, "width": true, "height": true, "allow": true, "allowfullscreen": true, "frameborder": true},
+	"blockquote": {"cite": true},
+	"q":          {"cite": true},
+	"del":        {"cite": true, "datetime": true},
+	"ins":        {"cite": true, "datetime": true},
+	"time":       {"datetime": true},
+	"ol":         {"start": true, "reversed": true, "type": true},
+	"li":         {"value": true},
+	"td":         {"colspan": true, "rowspan": true, "headers": true},
+	"th":         {"colspan": true, "rowspan": true, "headers": true, "scope": true, "abbr": true},
+	"col":        {"span": true},
+	"colgroup":   {"span": true},
+}
+
+// allowedLinkRels are the links the extractor reads. Links with any other
+// rel, such as stylesheets, preloads or imports, are dropped.
+var allowedLinkRels = map[string]bool{
+	"canonical": true, "amphtml": true, "alternate": true, "icon": true, "shortcut": true,
+	"apple-touch-icon": true, "apple-touch-icon-precomposed": true, "author": true, "license": true,
+}
+
+// urlSchemes are the schemes a url attribute may use. Relative urls have none.
+var urlSchemes = map[string]bool{
+	"http": true, "https": true, "mailto": true, "tel": true,
+}
+
+// defaultTrackerHosts serve tracking pixels and beacons.
+var defaultTrackerHosts = []string{
+	"google-analytics.com",
+	"googletagmanager.com",
+	"doubleclick.net",
+	"facebook.com",
+	"pixel.wp.com",
+	"stats.wp.com",
+	"quantserve.com",
+	"scorecardresearch.com",
+	"feeds.feedburner.com",
+}
+
+// urlAttributes hold a url, whose scheme is checked.
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "poster": true, "cite": true,
+}
+
+// SanitizeConfig cleans the html stored in posts.content, which downstream
+// apps may render.
+type SanitizeConfig struct {
+	Enabled bool `json:"enabled"`
+	// RemoveElements replaces the default list of elements that are dropped
+	// with their content.
+	RemoveElements []string `json:"removeElements"`
+	// AllowIframeHosts keeps iframes embedding these hosts, e.g. videos.
+	AllowIframeHosts []string `json:"allowIframeHosts"`
+	// TrackerHosts replaces the default list of hosts whose images and
+	// iframes are dropped.
+	TrackerHosts []string `json:"trackerHosts"`
+	// KeepStyles keeps <style> elements and style attributes.
+	KeepStyles bool `json:"keepStyles"`
+}
+
+// sanitizeHtml keeps only the allowed elements and attributes of a page.
+// Scripts, embeds and tracking pixels are dropped with their content, other
+// elements are unwrapped, and urls must be relative or use a safe scheme.
+func sanitizeHtml(pageHtml string, config SanitizeConfig) string {
+	removed := make(map[string]bool)
+
+	removeElements := config.RemoveElements
+	if removeElements == nil {
+		removeElements = defaultRemovedElements
+	}
+
+	for _, element := range removeElements {
+		removed[strings.ToLower(element)] = true
+	}
+
+	if !config.KeepStyles {
+		removed["style"] = true
+	}
+
+	trackerHosts := config.TrackerHosts
+	if trackerHosts == nil {
+		trackerHosts = defaultTrackerHosts
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(pageHtml))
+
+	tokenizer := html.NewTokenizer(strings.NewReader(pageHtml))
+	// skipping is the element whose content is being dropped, nested depth
+	// levels deep
+	skipping := ""
+	depth := 0
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			// on a parse error only what was sanitized so far is kept
+			break
+		}
+
+		if tokenType == html.CommentToken {
+			continue
+		}
+
+		if tokenType == html.TextToken || tokenType == html.DoctypeToken {
+			if skipping == "" {
+				out.Write(tokenizer.Raw())
+			}
+			continue
+		}
+
+		token := tokenizer.Token()
+		name := strings.ToLower(token.Data)
+
+		if skipping != "" {
+			if name == skipping && tokenType == html.StartTagToken {
+				depth++
+			} else if name == skipping && tokenType == html.EndTagToken {
+				depth--
+				if depth == 0 {
+					skipping = ""
+				}
+			}
+			continue
+		}
+
+		kept := isKeptElement(name, config)
+		drop := removed[name] || (rawTextElements[name] && !kept)
+		if name == "iframe" {
+			// a dropped iframe's end tag is skipped with its content, so the
+			// end tags left belong to iframes that were kept
+			kept = tokenType == html.EndTagToken || hostMatches(attrHost(token, "src"), config.AllowIframeHosts)
+			drop = !kept
+		}
+
+		if tokenType == html.EndTagToken {
+			if kept && !drop {
+				out.WriteString(token.String())
+			}
+			continue
+		}
+
+		if (name == "img" || name == "iframe") && isTracker(token, trackerHosts) {
+			drop = true
+		}
+
+		if drop {
+			// the tokenizer reads what follows a raw text element as text up
+			// to its end tag even when it's written self-closing, as in
+			// <script/>, so that's skipped too
+			if (tokenType == html.StartTagToken || rawTextElements[name]) && !isVoidElement(name) {
+				skipping = name
+				depth = 1
+			}
+			continue
+		}
+
+		if !kept || !isAllowedTag(name, token, config.KeepStyles) {
+			continue
+		}
+
+		token.Attr = sanitizeAttrs(name, token.Attr, config.KeepStyles)
+		out.WriteString(token.String())
+	}
+
+	return out.String()
+}
+
+func isKeptElement(name string, config SanitizeConfig) bool {
+	return allowedElements[name] || (name == "style" && config.KeepStyles)
+}
+
+// isAllowedTag drops the meta and link tags that change how a page loads
+// rather than describe it.
+func isAllowedTag(name string, token html.Token, keepStyles bool) bool {
+	switch name {
+	case "meta":
+		for _, attr := range token.Attr {
+			if strings.ToLower(attr.Key) == "http-equiv" {
+				return false
+			}
+		}
+	case "link":
+		rels := strings.Fields(strings.ToLower(attrValue(token, "rel")))
+		if len(rels) == 0 {
+			return false
+		}
+
+		for _, rel := range rels {
+			if !allowedLinkRels[rel] && !(rel == "stylesheet" && keepStyles) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func sanitizeAttrs(name string, attrs []html.Attribute, keepStyles bool) []html.Attribute {
+	kept := attrs[:0]
+
+	for _, attr := range attrs {
+		key := strings.ToLower(attr.Key)
+
+		allowed := globalAttributes[key] || allowedAttributes[name][key] ||
+			strings.HasPrefix(key, "aria-") || (key == "style" && keepStyles)
+		if !allowed {
+			continue
+		}
+
+		if urlAttributes[key] && !isSafeUrl(attr.Val) {
+			continue
+		}
+
+		if key == "srcset" && !isSafeSrcset(attr.Val) {
+			continue
+		}
+
+		kept = append(kept, attr)
+	}
+
+	return kept
+}
+
+// isSafeUrl allows relative urls and urls with a scheme from urlSchemes,
+// seeing through entities and the whitespace or control characters used to
+// get javascript: urls past naive filters.
+func isSafeUrl(value string) bool {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(html.UnescapeString(value)))
+
+	colon := strings.Index(value, ":")
+	if colon < 0 || strings.ContainsAny(value[:colon], "/?#") {
+		return true
+	}
+
+	return urlSchemes[value[:colon]]
+}
+
+func isSafeSrcset(srcset string) bool {
+	for _, candidate := range parseSrcset(srcset) {
+		if !isSafeUrl(candidate.Url) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isTracker spots 1x1 images and embeds served by tracker hosts.
+func isTracker(token html.Token, trackerHosts []string) bool {
+	if attrValue(token, "width") == "1" && attrValue(token, "height") == "1" {
+		return true
+	}
+
+	return hostMatches(attrHost(token, "src"), trackerHosts)
+}
+
+func attrHost(token html.Token, key string) string {
+	u, err := url.Parse(strings.TrimSpace(attrValue(token, key)))
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+func isVoidElement(name string) bool {
+	switch name {
+	case "area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "param", "source", "track", "wbr":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeHtml(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		config  SanitizeConfig
+		kept    []string
+		dropped []string
+	}{
+		{
+			name:    "script",
+			html:    `<p>text<script>alert(1)</script></p>`,
+			kept:    []string{"<p>text</p>"},
+			dropped: []string{"alert"},
+		},
+		{
+			name:    "meta refresh",
+			html:    `<head><meta http-equiv="refresh" content="0;url=javascript:alert(1)"><meta property="og:title" content="Title"></head>`,
+			kept:    []string{`<meta property="og:title" content="Title">`},
+			dropped: []string{"refresh"},
+		},
+		{
+			name:    "base",
+			html:    `<head><base href="https://evil.example/"></head>`,
+			dropped: []string{"base"},
+		},
+		{
+			name:    "links",
+			html:    `<link rel="canonical" href="/post"><link rel="stylesheet" href="/x.css"><link rel="import" href="/x.html">`,
+			kept:    []string{`<link rel="canonical" href="/post">`},
+			dropped: []string{"x.css", "x.html"},
+		},
+		{
+			name:    "svg animate",
+			html:    `<svg><a><animate attributeName="href" to="javascript:alert(1)"/><set attributeName="onmouseover" to="alert(1)"/><text>x</text></a></svg>`,
+			dropped: []string{"animate", "set", "alert"},
+		},
+		{
+			name:    "unknown element",
+			html:    `<custom-widget data-x="1" onclick="alert(1)">text</custom-widget>`,
+			kept:    []string{"text"},
+			dropped: []string{"custom-widget", "onclick", "data-x"},
+		},
+		{
+			name:    "raw text",
+			html:    `<noembed><img src=x onerror=alert(1)></noembed><xmp><img src=x onerror=alert(1)></xmp>`,
+			dropped: []string{"onerror", "img"},
+		},
+		{
+			name:    "self-closing raw text",
+			html:    `<script/><img src=x onerror=alert(1)></script><style/><img src=x onerror=alert(2)></style><xmp/><img onerror=alert(3)></xmp><noembed/><img onerror=alert(4)></noembed><iframe src="https://evil.example/"/><img onerror=alert(5)></iframe><p>after</p>`,
+			kept:    []string{"<p>after</p>"},
+			dropped: []string{"onerror", "img", "alert"},
+		},
+		{
+			name:    "urls",
+			html:    `<a href="java&#x09;script:alert(1)">a</a><a href="data:text/html,x">b</a><img srcset="javascript:alert(1) 1x"><a href="/ok">c</a>`,
+			kept:    []string{`<a>a</a>`, `<a>b</a>`, `<a href="/ok">c</a>`},
+			dropped: []string{"javascript", "data:", "srcset"},
+		},
+		{
+			name:    "allowed iframe",
+			html:    `<iframe src="https://www.youtube.com/embed/x"></iframe><iframe src="https://evil.example/"></iframe>`,
+			config:  SanitizeConfig{AllowIframeHosts: []string{"youtube.com"}},
+			kept:    []string{`<iframe src="https://www.youtube.com/embed/x"></iframe>`},
+			dropped: []string{"evil"},
+		},
+		{
+			name:   "styles",
+			html:   `<style>p{}</style><p style="color:red">x</p>`,
+			config: SanitizeConfig{KeepStyles: true},
+			kept:   []string{`<style>p{}</style>`, `<p style="color:red">`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sanitized := sanitizeHtml(test.html, test.config)
+
+			for _, kept := range test.kept {
+				if !strings.Contains(sanitized, kept) {
+					t.Errorf("%q is missing %q", sanitized, kept)
+				}
+			}
+
+			for _, dropped := range test.dropped {
+				if strings.Contains(sanitized, dropped) {
+					t.Errorf("%q still contains %q", sanitized, dropped)
+				}
+			}
+		})
+	}
+}
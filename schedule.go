@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// interleaveHosts reorders the posts of a batch so consecutive fetches go to
+// different hosts, taking one page from each host in turn. Otherwise a feed
+// that published many posts at once would hold up the fetch workers behind
+// its host's rate limit and concurrency cap. Priority still comes first, so
+// only pages of the same priority are interleaved.
+func interleaveHosts(groups [][]Post) [][]Post {
+	interleaved := make([][]Post, 0, len(groups))
+
+	for start := 0; start < len(groups); {
+		end := start + 1
+		for end < len(groups) && groups[end][0].Priority == groups[start][0].Priority {
+			end++
+		}
+
+		interleaved = append(interleaved, roundRobinHosts(groups[start:end])...)
+		start = end
+	}
+
+	return interleaved
+}
+
+// roundRobinHosts takes a page from each host in the order the hosts were
+// first seen, keeping each host's own pages in order.
+func roundRobinHosts(groups [][]Post) [][]Post {
+	hosts := make([]string, 0)
+	byHost := make(map[string][][]Post)
+
+	for _, group := range groups {
+		host := scheduleHost(group[0].Url)
+		if _, ok := byHost[host]; !ok {
+			hosts = append(hosts, host)
+		}
+
+		byHost[host] = append(byHost[host], group)
+	}
+
+	ordered := make([][]Post, 0, len(groups))
+	for len(ordered) < len(groups) {
+		for _, host := range hosts {
+			if pending := byHost[host]; len(pending) > 0 {
+				ordered = append(ordered, pending[0])
+				byHost[host] = pending[1:]
+			}
+		}
+	}
+
+	return ordered
+}
+
+// scheduleHost is the host a url's page is fetched from, treating www. as
+// the same host.
+func scheduleHost(pageUrl string) string {
+	u, err := url.Parse(pageUrl)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
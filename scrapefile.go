@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runScrapeFile scrapes urls read from a file or stdin instead of the
+// database, writing the results to a jsonl file and/or the configured sinks:
+// ogparser scrape-file [-format csv|jsonl] [-out results.jsonl] [-sinks] <file or ->
+func runScrapeFile(args []string) {
+	flags := flag.NewFlagSet("scrape-file", flag.ExitOnError)
+	format := flags.String("format", "", "csv (url or id,url per line) or jsonl ({\"id\": 1, \"url\": ...}), "+
+		"guessed from the file extension when empty")
+	out := flags.String("out", "", "jsonl file to write results to")
+	useSinks := flags.Bool("sinks", false, "also write results to the sinks in the config file")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 || (*out == "" && !*useSinks) {
+		fmt.Println("usage: ogparser scrape-file [-format csv|jsonl] [-out results.jsonl] [-sinks] <file or ->")
+		os.Exit(2)
+	}
+
+	// the config is optional here, for fetch settings, enrichers and sinks
+	config, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Println("using default config:", err.Error())
+		config = AppConfig{}
+	}
+
+	// results only go where asked, never to solr
+	config.Solr = ""
+	config.SolrCloud = nil
+	applyConfig(config)
+
+	input := io.Reader(os.Stdin)
+	if name := flags.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			kill("opening input file", err)
+		}
+
+		defer func() {
+			_ = file.Close()
+		}()
+
+		input = file
+
+		if *format == "" && strings.EqualFold(filepath.Ext(name), ".jsonl") {
+			*format = "jsonl"
+		}
+	}
+
+	posts, err := readPosts(input, *format)
+	if err != nil {
+		kill("reading posts", err)
+	}
+
+	sinks := make([]Sink, 0)
+	if *useSinks {
+		sinks = newSinks(config.Sinks)
+	}
+
+	if *out != "" {
+		sink, err := newJsonlSink(JsonlSinkConfig{Path: *out})
+		if err != nil {
+			kill("opening output file", err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	defer func() {
+		closeSinks(sinks)
+	}()
+
+	store := newMemoryStore(posts)
+	summary := scrapePosts(context.Background(), store, config, sinks, posts, newProgressLogger("scrape-file", len(posts)))
+
+	fmt.Println("Saved metadata for", summary.saved, "of", summary.posts, "posts,", summary.failed, "failed")
+}
+
+// readPosts reads one post per line, either as csv of a url or an id and a
+// url, or as jsonl objects with id and url. Posts without an id are numbered
+// from 1.
+func readPosts(r io.Reader, format string) ([]Post, error) {
+	switch format {
+	case "jsonl":
+		return readJsonlPosts(r)
+	case "", "csv":
+		return readCsvPosts(r)
+	}
+
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+func readCsvPosts(r io.Reader) ([]Post, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	posts := make([]Post, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return posts, err
+		}
+
+		post := Post{}
+
+		switch len(record) {
+		case 1:
+			// a header row
+			if strings.EqualFold(strings.TrimSpace(record[0]), "url") {
+				continue
+			}
+			post.Url = record[0]
+		case 2:
+			post.PostID, err = strconv.ParseInt(strings.TrimSpace(record[0]), 10, 64)
+			if err != nil {
+				line, _ := reader.FieldPos(0)
+				// a header row
+				if line == 1 {
+					continue
+				}
+				return posts, fmt.Errorf("line %d: %w", line, err)
+			}
+			post.Url = record[1]
+		default:
+			line, _ := reader.FieldPos(0)
+			return posts, fmt.Errorf("line %d: expected a url or an id and a url", line)
+		}
+
+		if post.Url = strings.TrimSpace(post.Url); post.Url != "" {
+			posts = append(posts, post)
+		}
+	}
+
+	return numberPosts(posts), nil
+}
+
+func readJsonlPosts(r io.Reader) ([]Post, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	posts := make([]Post, 0)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var entry struct {
+			ID          int64  `json:"id"`
+			Url         string `json:"url"`
+			Description string `json:"description"`
+		}
+
+		err := json.Unmarshal([]byte(text), &entry)
+		if err != nil {
+			return posts, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if entry.Url != "" {
+			posts = append(posts, Post{PostID: entry.ID, Url: entry.Url, OrigDescription: entry.Description})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return posts, err
+	}
+
+	return numberPosts(posts), nil
+}
+
+// numberPosts gives posts without an id one that isn't otherwise used.
+func numberPosts(posts []Post) []Post {
+	used := make(map[int64]bool, len(posts))
+	for _, post := range posts {
+		used[post.PostID] = true
+	}
+
+	next := int64(1)
+	for i := range posts {
+		if posts[i].PostID != 0 {
+			continue
+		}
+
+		for used[next] {
+			next++
+		}
+
+		posts[i].PostID = next
+		used[next] = true
+	}
+
+	return posts
+}
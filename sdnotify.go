@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net"
+	"os"
+)
+
+// sdNotify sends a state update to systemd when running as a Type=notify
+// service. It is a no-op when NOTIFY_SOCKET is not set.
+func sdNotify(state string) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return
+	}
+
+	// abstract namespace sockets are given with a leading @
+	if socketPath[0] == '@' {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return
+	}
+
+	defer func(conn *net.UnixConn) {
+		_ = conn.Close()
+	}(conn)
+
+	_, _ = conn.Write([]byte(state))
+}
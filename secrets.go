@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type VaultConfig struct {
+	Addr      string `json:"addr"`
+	Token     string `json:"token"`
+	TokenFile string `json:"tokenFile"`
+}
+
+// resolveSecrets replaces secret references in the config with their values.
+// A value can be given literally, or as env:NAME, file:/path or
+// vault:path/to/secret#key. A passwordFile takes precedence over pass.
+func resolveSecrets(config *AppConfig) error {
+	var err error
+
+	config.Db.Password, err = resolveDbPassword(config.Db, config.Vault)
+	if err != nil {
+		return fmt.Errorf("db password: %w", err)
+	}
+
+	for i := range config.Tenants {
+		config.Tenants[i].Db.Password, err = resolveDbPassword(config.Tenants[i].Db, config.Vault)
+		if err != nil {
+			return fmt.Errorf("db password for tenant %s: %w", config.Tenants[i].Name, err)
+		}
+	}
+
+	config.Sentry.Dsn, err = resolveSecret(config.Sentry.Dsn, config.Vault)
+	if err != nil {
+		return fmt.Errorf("sentry dsn: %w", err)
+	}
+
+	err = resolveSinkSecrets(&config.Sinks, config.Vault)
+	if err != nil {
+		return err
+	}
+
+	for i := range config.Tenants {
+		err = resolveSinkSecrets(&config.Tenants[i].Sinks, config.Vault)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", config.Tenants[i].Name, err)
+		}
+	}
+
+	config.Nats.Url, err = resolveSecret(config.Nats.Url, config.Vault)
+	if err != nil {
+		return fmt.Errorf("nats url: %w", err)
+	}
+
+	config.Llm.ApiKey, err = resolveSecret(config.Llm.ApiKey, config.Vault)
+	if err != nil {
+		return fmt.Errorf("llm api key: %w", err)
+	}
+
+	return nil
+}
+
+// resolveSinkSecrets resolves the credentials of the sinks, which tenants
+// configure for themselves.
+func resolveSinkSecrets(sinks *SinksConfig, vault VaultConfig) error {
+	var err error
+
+	sinks.Amqp.Url, err = resolveSecret(sinks.Amqp.Url, vault)
+	if err != nil {
+		return fmt.Errorf("amqp url: %w", err)
+	}
+
+	sinks.Mqtt.Password, err = resolveSecret(sinks.Mqtt.Password, vault)
+	if err != nil {
+		return fmt.Errorf("mqtt password: %w", err)
+	}
+
+	sinks.Meilisearch.ApiKey, err = resolveSecret(sinks.Meilisearch.ApiKey, vault)
+	if err != nil {
+		return fmt.Errorf("meilisearch api key: %w", err)
+	}
+
+	sinks.Typesense.ApiKey, err = resolveSecret(sinks.Typesense.ApiKey, vault)
+	if err != nil {
+		return fmt.Errorf("typesense api key: %w", err)
+	}
+
+	return nil
+}
+
+// resolveDbPassword prefers passwordFile over pass.
+func resolveDbPassword(db DbConfig, vault VaultConfig) (string, error) {
+	if db.PasswordFile != "" {
+		return readSecretFile(db.PasswordFile)
+	}
+
+	return resolveSecret(db.Password, vault)
+}
+
+func resolveSecret(value string, vault VaultConfig) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, "file:"):
+		return readSecretFile(strings.TrimPrefix(value, "file:"))
+	case strings.HasPrefix(value, "vault:"):
+		return readVaultSecret(strings.TrimPrefix(value, "vault:"), vault)
+	default:
+		return value, nil
+	}
+}
+
+func readSecretFile(path string) (string, error) {
+	secret, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(secret), "\r\n"), nil
+}
+
+type vaultResponse struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// readVaultSecret reads a key from a kv secret over vault's http api. Both kv
+// v1 and v2 engines are supported; for v2 the path must include "data/".
+func readVaultSecret(ref string, config VaultConfig) (string, error) {
+	path, key := ref, "value"
+	if i := strings.LastIndex(ref, "#"); i != -1 {
+		path, key = ref[:i], ref[i+1:]
+	}
+
+	addr := config.Addr
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+
+	token := config.Token
+	if config.TokenFile != "" {
+		var err error
+		token, err = readSecretFile(config.TokenFile)
+		if err != nil {
+			return "", err
+		}
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	if addr == "" || token == "" {
+		return "", errors.New("vault address and token must be configured")
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("X-Vault-Token", token)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	defer func(resp *http.Response) {
+		_ = resp.Body.Close()
+	}(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d for %s", resp.StatusCode, path)
+	}
+
+	secret := vaultResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&secret)
+	if err != nil {
+		return "", err
+	}
+
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	value, ok := data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %s", path, key)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestResolveSecretsCoversTenantSinks(t *testing.T) {
+	t.Setenv("OGP_TEST_AMQP_URL", "amqp://user:secret@mq/")
+	t.Setenv("OGP_TEST_MEILI_KEY", "meili-secret")
+
+	config := AppConfig{
+		Sinks: SinksConfig{Amqp: AmqpSinkConfig{Url: "env:OGP_TEST_AMQP_URL"}},
+		Tenants: []TenantConfig{{
+			Name:  "other",
+			Sinks: SinksConfig{Meilisearch: MeilisearchSinkConfig{ApiKey: "env:OGP_TEST_MEILI_KEY"}},
+		}},
+	}
+
+	if err := resolveSecrets(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Sinks.Amqp.Url != "amqp://user:secret@mq/" {
+		t.Errorf("amqp url = %q, want it resolved", config.Sinks.Amqp.Url)
+	}
+	if key := config.Tenants[0].Sinks.Meilisearch.ApiKey; key != "meili-secret" {
+		t.Errorf("tenant meilisearch api key = %q, want it resolved", key)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// defaultFieldMap mirrors what is written to solr.
+var defaultFieldMap = map[string]string{
+	"description": "post_description",
+}
+
+// Sink receives the metadata of every post that was successfully parsed, in
+// addition to the db and solr updates.
+type Sink interface {
+	Name() string
+	Write(scraped PostScraped) error
+	Close() error
+}
+
+// searchSink is a sink that feeds a search index, which pages asking not to
+// be indexed are kept out of, as they are out of solr.
+type searchSink interface {
+	Sink
+	searchIndex()
+}
+
+type SinksConfig struct {
+	Jsonl JsonlSinkConfig `json:"jsonl"`
+	Amqp  AmqpSinkConfig  `json:"amqp"`
+	Mqtt  MqttSinkConfig  `json:"mqtt"`
+
+	Meilisearch MeilisearchSinkConfig `json:"meilisearch"`
+	OpenSearch  OpenSearchSinkConfig  `json:"openSearch"`
+	Typesense   TypesenseSinkConfig   `json:"typesense"`
+}
+
+// ScrapedEvent is the representation of a scraped post sent to sinks.
+// Delivery is at least once: a post is sent again when a write is retried or
+// replayed, so consumers should drop events whose IdempotencyKey they have
+// already processed.
+type ScrapedEvent struct {
+	// IdempotencyKey is the same for every delivery of the same values
+	IdempotencyKey string       `json:"idempotency_key"`
+	PostID         int64        `json:"post_id"`
+	Url            string       `json:"url"`
+	ScrapedAt      string       `json:"scraped_at"`
+	Title          string       `json:"title,omitempty"`
+	Description    string       `json:"description,omitempty"`
+	FeaturedImage  string       `json:"featured_image,omitempty"`
+	Language       string       `json:"language,omitempty"`
+	Direction      string       `json:"direction,omitempty"`
+	Nsfw           bool         `json:"nsfw,omitempty"`
+	WordCount      int          `json:"word_count,omitempty"`
+	ReadingMinutes int          `json:"reading_minutes,omitempty"`
+	Metadata       PostMetadata `json:"metadata"`
+	// Alternates are the translations the page links to
+	Alternates []HreflangAlternate `json:"alternates,omitempty"`
+	// Sources are where the title, description, image and so on came from
+	Sources map[string]ResultField `json:"sources,omitempty"`
+}
+
+func newScrapedEvent(scraped PostScraped) ScrapedEvent {
+	tags := scraped.OpenGraphTags
+
+	return ScrapedEvent{
+		IdempotencyKey: idempotencyKey(scraped),
+		PostID:         scraped.Post.PostID,
+		Url:            scraped.Post.Url,
+		ScrapedAt:      clock.Now().UTC().Format(time.RFC3339),
+		Title:          tags.Title,
+		Description:    tags.Description,
+		FeaturedImage:  tags.FeaturedImage,
+		Language:       tags.Language,
+		Direction:      tags.Direction,
+		Nsfw:           tags.Nsfw,
+		WordCount:      tags.WordCount,
+		ReadingMinutes: tags.ReadingMinutes,
+		Metadata:       tags.postMetadata(),
+		Alternates:     tags.Alternates,
+		Sources:        tags.result(scraped.Post.Url).Fields,
+	}
+}
+
+// idempotencyKey identifies a post's scraped values, from the same hash that
+// stops the db from saving them twice.
+func idempotencyKey(scraped PostScraped) string {
+	return fmt.Sprintf("%d-%s", scraped.Post.PostID, scraped.contentHash(SaveOptions{}))
+}
+
+// newSinks opens every sink enabled in the config. Sinks that fail to open
+// are logged and left out.
+func newSinks(config SinksConfig) []Sink {
+	sinks := make([]Sink, 0)
+
+	if sinkEnabled("jsonl", config.Jsonl.Enabled, config.Jsonl.Path != "") {
+		sink, err := newJsonlSink(config.Jsonl)
+		if err != nil {
+			fmt.Println("could not open jsonl sink", err.Error())
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+
+	if sinkEnabled("amqp", config.Amqp.Enabled, config.Amqp.Url != "") {
+		sink, err := newAmqpSink(config.Amqp)
+		if err != nil {
+			fmt.Println("could not connect amqp sink", err.Error())
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+
+	if sinkEnabled("mqtt", config.Mqtt.Enabled, config.Mqtt.Broker != "") {
+		sink, err := newMqttSink(config.Mqtt)
+		if err != nil {
+			fmt.Println("could not connect mqtt sink", err.Error())
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+
+	if sinkEnabled("meilisearch", config.Meilisearch.Enabled, config.Meilisearch.Host != "") {
+		sinks = append(sinks, newMeilisearchSink(config.Meilisearch))
+	}
+
+	if sinkEnabled("opensearch", config.OpenSearch.Enabled, config.OpenSearch.Endpoint != "") {
+		sink, err := newOpenSearchSink(config.OpenSearch)
+		if err != nil {
+			fmt.Println("could not configure opensearch sink", err.Error())
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+
+	if sinkEnabled("typesense", config.Typesense.Enabled, config.Typesense.Host != "") {
+		sinks = append(sinks, newTypesenseSink(config.Typesense))
+	}
+
+	for _, sink := range sinks {
+		fmt.Println("Writing scraped posts to", sink.Name(), "sink")
+	}
+
+	return sinks
+}
+
+// sinkEnabled is whether a configured sink should be opened, logging the
+// ones switched off with enabled: false.
+func sinkEnabled(name string, enabled *bool, configured bool) bool {
+	if configured && enabled != nil && !*enabled {
+		fmt.Println("The", name, "sink is disabled")
+		return false
+	}
+
+	return configured
+}
+
+// writeToSinks returns the names of the sinks the post was written to.
+func writeToSinks(sinks []Sink, scraped PostScraped) []string {
+	written := make([]string, 0, len(sinks))
+
+	for _, sink := range sinks {
+		err := sink.Write(scraped)
+		if err != nil {
+			fmt.Println("could not write to", sink.Name(), "sink", scraped.Post.Url, err.Error())
+			metrics.count("sinks."+metricName(sink.Name())+".errors", 1)
+			reportError("sink:"+sink.Name(), scraped.Post, err)
+			continue
+		}
+
+		written = append(written, sink.Name())
+	}
+
+	return written
+}
+
+// sinksFor drops the search sinks for a post that mustn't be indexed.
+func sinksFor(sinks []Sink, indexable bool) []Sink {
+	if indexable {
+		return sinks
+	}
+
+	kept := make([]Sink, 0, len(sinks))
+	for _, sink := range sinks {
+		if _, ok := sink.(searchSink); !ok {
+			kept = append(kept, sink)
+		}
+	}
+
+	return kept
+}
+
+func closeSinks(sinks []Sink) {
+	for _, sink := range sinks {
+		err := sink.Close()
+		if err != nil {
+			fmt.Println("could not close", sink.Name(), "sink", err.Error())
+		}
+	}
+}
+
+// searchDocument builds a document for a search index from a scraped post.
+// fieldMap maps our field names (description, featured_image, title,
+// language, canonical_url) to the index's, and fields without a value are
+// left out so they aren't overwritten.
+func searchDocument(scraped PostScraped, primaryKey string, fieldMap map[string]string) map[string]interface{} {
+	if fieldMap == nil {
+		fieldMap = defaultFieldMap
+	}
+
+	tags := scraped.OpenGraphTags
+	values := map[string]string{
+		"description":    tags.Description,
+		"featured_image": tags.FeaturedImage,
+		"title":          tags.Title,
+		"language":       tags.Language,
+		"canonical_url":  tags.canonicalUrl(),
+	}
+
+	doc := map[string]interface{}{
+		primaryKey: scraped.Post.PostID,
+	}
+
+	for field, indexField := range fieldMap {
+		if value := values[field]; value != "" {
+			doc[indexField] = value
+		}
+	}
+
+	return doc
+}
+
+// sendJson sends a json body to a search backend and returns an error for
+// any non 2xx response.
+func sendJson(httpClient *http.Client, method string, url string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	defer func(resp *http.Response) {
+		_ = resp.Body.Close()
+	}(resp)
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned status %d: %s", method, url, resp.StatusCode, respBody)
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestSinksForKeepsNoindexPagesOutOfSearchSinks(t *testing.T) {
+	sinks := []Sink{
+		&memorySink{},
+		&openSearchSink{},
+		&meilisearchSink{},
+		&typesenseSink{},
+	}
+
+	if got := sinksFor(sinks, true); len(got) != len(sinks) {
+		t.Errorf("indexable post goes to %d sinks, want all %d", len(got), len(sinks))
+	}
+
+	got := sinksFor(sinks, false)
+	if len(got) != 1 || got[0].Name() != "memory" {
+		t.Errorf("noindex post goes to %d sinks, want only the memory sink", len(got))
+	}
+}
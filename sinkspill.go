@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+const (
+	solrSpillTarget = "solr"
+	// spillReplayBatch is how many queued writes per target a cycle replays
+	// before moving on to scraping.
+	spillReplayBatch = 500
+)
+
+// SinkSpillConfig queues the writes to solr and the sinks that fail, e.g.
+// during maintenance, in a local sqlite file and replays them at the start
+// of the following cycles until they go through.
+type SinkSpillConfig struct {
+	// Path is the sqlite file. Tenants other than the default one get their
+	// name appended.
+	Path string `json:"path"`
+}
+
+// sinkSpill is the queue in one spill file. Only the latest write of a post
+// is kept per target, so a replay never overwrites newer values.
+type sinkSpill struct {
+	db *sql.DB
+	// replaying stops two cycles, e.g. the scheduled one and a grpc
+	// triggered one, replaying the same entries at once.
+	replaying sync.Mutex
+}
+
+var (
+	sinkSpillsMu sync.Mutex
+	sinkSpills   = map[string]*sinkSpill{}
+)
+
+// sinkSpill opens the spill file once and shares it from then on. It
+// returns nil when no spill file is configured or it can't be opened, and
+// every method of a nil spill does nothing.
+func (c AppConfig) sinkSpill() *sinkSpill {
+	if c.SinkSpill.Path == "" {
+		return nil
+	}
+
+	sinkSpillsMu.Lock()
+	defer sinkSpillsMu.Unlock()
+
+	spill, ok := sinkSpills[c.SinkSpill.Path]
+	if ok {
+		return spill
+	}
+
+	spill, err := openSinkSpill(c.SinkSpill.Path)
+	if err != nil {
+		fmt.Println("could not open sink spill file", c.SinkSpill.Path, err.Error())
+		return nil
+	}
+
+	sinkSpills[c.SinkSpill.Path] = spill
+
+	return spill
+}
+
+func openSinkSpill(path string) (*sinkSpill, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS spilled_writes (" +
+		"target TEXT NOT NULL, " +
+		"post_id INTEGER NOT NULL, " +
+		"scraped TEXT NOT NULL, " +
+		"queued_at TEXT NOT NULL, " +
+		"attempts INTEGER NOT NULL DEFAULT 0, " +
+		"PRIMARY KEY (target, post_id))")
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &sinkSpill{db: db}, nil
+}
+
+// track queues the post for every target it wasn't written to, and drops
+// what was queued for those it was, as that's now out of date.
+func (s *sinkSpill) track(scraped PostScraped, targets []string, written []string) {
+	if s == nil {
+		return
+	}
+
+	done := make(map[string]bool, len(written))
+	for _, target := range written {
+		done[target] = true
+	}
+
+	for _, target := range targets {
+		var err error
+		if done[target] {
+			_, err = s.db.Exec("DELETE FROM spilled_writes WHERE target = ? AND post_id = ?", target, scraped.Post.PostID)
+		} else {
+			err = s.queue(target, scraped)
+		}
+
+		if err != nil {
+			fmt.Println("could not update sink spill for", target, scraped.Post.Url, err.Error())
+		}
+	}
+}
+
+func (s *sinkSpill) queue(target string, scraped PostScraped) error {
+	// the fetch error isn't sent anywhere, and can't be decoded again
+	scraped.FetchErr = nil
+
+	encoded, err := json.Marshal(scraped)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		"INSERT INTO spilled_writes (target, post_id, scraped, queued_at) VALUES (?, ?, ?, ?) "+
+			"ON CONFLICT (target, post_id) DO UPDATE SET scraped = excluded.scraped, queued_at = excluded.queued_at",
+		target, scraped.Post.PostID, string(encoded), clock.Now().UTC().Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("queued", scraped.Post.Url, "for", target, "in the sink spill")
+
+	return nil
+}
+
+// replay writes what was queued, oldest first, to solr and the sinks still
+// configured, giving up on a target at its first failure as it's probably
+// still down.
+func (s *sinkSpill) replay(ctx context.Context, config AppConfig, sinks []Sink) {
+	if s == nil {
+		return
+	}
+
+	s.replaying.Lock()
+	defer s.replaying.Unlock()
+
+	targets := make(map[string]func(PostScraped) bool, len(sinks)+1)
+	if config.solrEnabled() {
+		targets[solrSpillTarget] = func(scraped PostScraped) bool {
+			return updateSolr(config, scraped)
+		}
+	}
+
+	for _, sink := range sinks {
+		sink := sink
+		targets[sink.Name()] = func(scraped PostScraped) bool {
+			return len(writeToSinks([]Sink{sink}, scraped)) > 0
+		}
+	}
+
+	for target, write := range targets {
+		replayed, err := s.replayTarget(ctx, target, write)
+		if err != nil {
+			fmt.Println("could not replay sink spill for", target, err.Error())
+		}
+
+		if replayed > 0 {
+			fmt.Println("replayed", replayed, "queued writes to", target)
+		}
+	}
+}
+
+func (s *sinkSpill) replayTarget(ctx context.Context, target string, write func(PostScraped) bool) (int, error) {
+	rows, err := s.db.QueryContext(
+		ctx, "SELECT post_id, scraped FROM spilled_writes WHERE target = ? ORDER BY queued_at, post_id LIMIT ?",
+		target, spillReplayBatch,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	type queued struct {
+		postID  int64
+		scraped string
+	}
+
+	entries := make([]queued, 0)
+	for rows.Next() {
+		var entry queued
+		err = rows.Scan(&entry.postID, &entry.scraped)
+		if err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		entries = append(entries, entry)
+	}
+
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, entry := range entries {
+		var scraped PostScraped
+		err = json.Unmarshal([]byte(entry.scraped), &scraped)
+		if err != nil {
+			fmt.Println("dropping unreadable sink spill entry for post", entry.postID, err.Error())
+		} else if !write(scraped) {
+			_, err = s.db.ExecContext(ctx, "UPDATE spilled_writes SET attempts = attempts + 1 WHERE target = ? AND post_id = ?", target, entry.postID)
+			return replayed, err
+		}
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM spilled_writes WHERE target = ? AND post_id = ?", target, entry.postID)
+		if err != nil {
+			return replayed, err
+		}
+
+		replayed++
+	}
+
+	return replayed, nil
+}
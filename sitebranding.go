@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SiteBranding is how a site presents itself, resolved per domain from the
+// pages scraped on it, so the frontend can show publishers without deriving
+// it from individual posts.
+type SiteBranding struct {
+	Domain   string
+	SiteName string
+	Icon     string
+	// ThemeColor is the page's theme-color, e.g. "#1da1f2"
+	ThemeColor string
+	// TileColor and TileImage are the msapplication tile the site declares
+	TileColor string
+	TileImage string
+	Updated   time.Time
+}
+
+func newSiteBranding(scraped PostScraped) SiteBranding {
+	branding := SiteBranding{
+		Domain:     routingKeyDomain(scraped.Post.Url),
+		SiteName:   scraped.OpenGraphTags.SiteName,
+		ThemeColor: scraped.OpenGraphTags.ThemeColor,
+		TileColor:  scraped.OpenGraphTags.TileColor,
+		TileImage:  scraped.OpenGraphTags.TileImage,
+		Updated:    clock.Now().UTC(),
+	}
+
+	// the /favicon.ico guessed for a page without icon links mustn't replace
+	// the icon another page of the site links to
+	if len(scraped.OpenGraphTags.icons) > 0 {
+		branding.Icon = scraped.OpenGraphTags.Icon
+	}
+
+	return branding
+}
+
+func (b SiteBranding) empty() bool {
+	return b.SiteName == "" && b.Icon == "" && b.ThemeColor == "" && b.TileColor == "" && b.TileImage == ""
+}
+
+// sameAs ignores when the branding was resolved.
+func (b SiteBranding) sameAs(other SiteBranding) bool {
+	b.Updated, other.Updated = time.Time{}, time.Time{}
+
+	return b == other
+}
+
+type siteBrandingKey struct {
+	store  Store
+	domain string
+}
+
+var (
+	siteBrandingsMu sync.Mutex
+	// siteBrandings are the last values saved per store and domain, so the
+	// many posts of a site only write its branding when it changes.
+	siteBrandings = map[siteBrandingKey]SiteBranding{}
+)
+
+// updateSiteBranding saves the branding a page shows for its domain, unless
+// that's what was saved last. Values the page doesn't have are left as they
+// were, as not every page of a site declares all of them.
+func updateSiteBranding(ctx context.Context, store Store, scraped PostScraped) {
+	if scraped.Html == "" {
+		return
+	}
+
+	branding := newSiteBranding(scraped)
+	if branding.empty() || branding.Domain == "unknown" {
+		return
+	}
+
+	key := siteBrandingKey{store: store, domain: branding.Domain}
+
+	siteBrandingsMu.Lock()
+	last, ok := siteBrandings[key]
+	siteBrandingsMu.Unlock()
+
+	if ok && last.sameAs(branding) {
+		return
+	}
+
+	err := store.SaveSiteBranding(ctx, branding)
+	if err != nil {
+		fmt.Println("could not save site branding for", branding.Domain, err.Error())
+		reportError("db", scraped.Post, err)
+		return
+	}
+
+	siteBrandingsMu.Lock()
+	siteBrandings[key] = branding
+	siteBrandingsMu.Unlock()
+}
+
+// normalizeThemeColor keeps a theme-color that looks like a css color,
+// lowercased.
+func normalizeThemeColor(content string) string {
+	color := strings.ToLower(strings.TrimSpace(content))
+	if color == "" || len(color) > 32 || strings.ContainsAny(color, "<>\"';{}") {
+		return ""
+	}
+
+	return color
+}
+
+func (s *sqlStore) SaveSiteBranding(ctx context.Context, branding SiteBranding) error {
+	args := s.safeArgs([]interface{}{
+		branding.Domain,
+		nullString(truncateRunes(branding.SiteName, 255)),
+		nullString(truncateRunes(branding.Icon, 2000)),
+		nullString(branding.ThemeColor),
+		nullString(branding.TileColor),
+		nullString(truncateRunes(branding.TileImage, 2000)),
+		branding.Updated.Format("2006-01-02 15:04:05"),
+	})
+
+	_, err := s.db.ExecContext(ctx, s.dialect.upsertSiteBrandingQuery, args...)
+
+	return err
+}
+
+func (s *memoryStore) SaveSiteBranding(ctx context.Context, branding SiteBranding) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := s.brandings[branding.Domain]
+	saved.Domain, saved.Updated = branding.Domain, branding.Updated
+
+	if branding.SiteName != "" {
+		saved.SiteName = branding.SiteName
+	}
+
+	if branding.Icon != "" {
+		saved.Icon = branding.Icon
+	}
+
+	if branding.ThemeColor != "" {
+		saved.ThemeColor = branding.ThemeColor
+	}
+
+	if branding.TileColor != "" {
+		saved.TileColor = branding.TileColor
+	}
+
+	if branding.TileImage != "" {
+		saved.TileImage = branding.TileImage
+	}
+
+	s.brandings[branding.Domain] = saved
+
+	return nil
+}
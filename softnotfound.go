@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// softNotFoundTitles match the whole of a title, or a part of it between
+// separators, of error pages that are served with a 200, so a post about
+// 404 pages isn't taken for one. Parked domains are permanent failures, left
+// to permanentFailureReason.
+var softNotFoundTitles = regexp.MustCompile(
+	`(?i)^((oops|sorry|error)[!,.]?\s*)*(404|(404\s+)?(((page|file|post|article|content)\s+)?not found|` +
+		`page (does not|doesn't) exist|nothing (was )?found|account (has been )?suspended|` +
+		`site (is )?(not available|unavailable)))[!.]*$`,
+)
+
+// titleSeparators split a title into its parts, e.g. the page's and the
+// site's name.
+var titleSeparators = regexp.MustCompile(`\s*[|:–—·•»]\s*|\s+-\s+`)
+
+// tinyPageBytes is the size below which a page is considered too small to
+// be a real article.
+const tinyPageBytes = 2048
+
+// compileSoftNotFoundPatterns compiles the configured soft 404 patterns,
+// leaving out the invalid ones validateConfig reports.
+func compileSoftNotFoundPatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err == nil {
+			compiled = append(compiled, re)
+		}
+	}
+
+	return compiled
+}
+
+// isErrorPageTitle reports whether a title or heading, or a part of it, is
+// what error pages are titled.
+func isErrorPageTitle(title string) bool {
+	for _, part := range titleSeparators.Split(title, -1) {
+		if softNotFoundTitles.MatchString(strings.TrimSpace(part)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// softNotFoundReason returns why a page looks like an error page served with
+// a 200, or an empty string if it looks like real content.
+func softNotFoundReason(scraped PostScraped, extraPatterns []*regexp.Regexp) string {
+	tags := scraped.OpenGraphTags
+
+	if isErrorPageTitle(tags.Title) {
+		return "title looks like an error page: " + tags.Title
+	}
+
+	if isErrorPageTitle(tags.heading) {
+		return "heading looks like an error page: " + strings.TrimSpace(tags.heading)
+	}
+
+	for _, re := range extraPatterns {
+		if re.MatchString(tags.Title) || re.MatchString(tags.Description) {
+			return "matched soft 404 pattern " + re.String()
+		}
+	}
+
+	if scraped.Html != "" && len(scraped.Html) < tinyPageBytes && tags.Description == "" && tags.FeaturedImage == "" {
+		return "page is tiny and has no metadata"
+	}
+
+	if pointsAtHomepage(scraped.Post.Url, tags.Canonical) {
+		return "canonical url points at the homepage"
+	}
+
+	if pointsAtHomepage(scraped.Post.Url, tags.Url) {
+		return "og:url points at the homepage"
+	}
+
+	return ""
+}
+
+// pointsAtHomepage reports whether target is the root of the site while the
+// post itself is not.
+func pointsAtHomepage(postUrl string, target string) bool {
+	if target == "" {
+		return false
+	}
+
+	post, err := url.Parse(postUrl)
+	if err != nil || isRootPath(post) {
+		return false
+	}
+
+	resolved, err := post.Parse(target)
+	if err != nil {
+		return false
+	}
+
+	return isRootPath(resolved)
+}
+
+func isRootPath(u *url.URL) bool {
+	return strings.Trim(u.Path, "/") == "" && u.RawQuery == ""
+}
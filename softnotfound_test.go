@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestIsErrorPageTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  bool
+	}{
+		{"404", true},
+		{"404 Not Found", true},
+		{"Page not found | Example Blog", true},
+		{"Example Blog - Page Not Found", true},
+		{"Error 404: page does not exist", true},
+		{"Oops! Nothing found", true},
+		{"Account suspended", true},
+		{"Why 404 errors hurt your rankings", false},
+		{"Lost and not found: a memoir", false},
+		{"Building a not found page that helps", false},
+		{"Page not found errors, explained | Example Blog", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := isErrorPageTitle(test.title); got != test.want {
+			t.Errorf("isErrorPageTitle(%q) = %v, want %v", test.title, got, test.want)
+		}
+	}
+}
+
+func TestSoftNotFoundReasonChecksTheHeading(t *testing.T) {
+	scraped := PostScraped{
+		Post: Post{Url: "https://example.com/posts/gone"},
+		Html: "<html><head><title>Example Blog</title></head><body><h1>Page <em>not found</em></h1></body></html>",
+	}
+	getOgTagsFromHtml(&scraped)
+
+	if reason := softNotFoundReason(scraped, nil); reason == "" {
+		t.Error("page headed \"Page not found\" wasn't taken for a soft 404")
+	}
+}
+
+func TestSoftNotFoundReasonUsesCompiledPatterns(t *testing.T) {
+	scraped := PostScraped{
+		Post: Post{Url: "https://example.com/posts/gone"},
+		OpenGraphTags: OpenGraphTags{
+			Title:         "Example Blog",
+			Description:   "This listing has expired.",
+			FeaturedImage: "https://example.com/image.png",
+		},
+	}
+
+	patterns := compileSoftNotFoundPatterns([]string{"(unclosed", "listing has expired"})
+	if len(patterns) != 1 {
+		t.Fatalf("compiled %d patterns, want the invalid one left out", len(patterns))
+	}
+
+	if reason := softNotFoundReason(scraped, patterns); reason == "" {
+		t.Error("configured pattern didn't match the description")
+	}
+}
+
+func TestParkedDomainIsAPermanentFailureOnly(t *testing.T) {
+	scraped := PostScraped{
+		Post:          Post{Url: "https://example.com/posts/gone"},
+		Html:          "<html><head><title>This domain is for sale</title></head></html>",
+		OpenGraphTags: OpenGraphTags{Title: "This domain is for sale", Description: "Make an offer today."},
+	}
+
+	if reason := permanentFailureReason(scraped); reason == "" {
+		t.Error("parked domain wasn't a permanent failure")
+	}
+	if reason := softNotFoundReason(scraped, nil); reason != "" {
+		t.Errorf("parked domain was also a soft 404: %s", reason)
+	}
+}
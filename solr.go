@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// sendSolrUpdate posts atomic updates to a solr update url.
+func sendSolrUpdate(solrUrl string, timeout time.Duration, docs AbtSolrDocs) error {
+	postBody, err := json.Marshal(docs)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", solrUrl, bytes.NewBuffer(postBody))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	defer func(cancel context.CancelFunc) {
+		cancel()
+	}(cancel)
+
+	httpClient := &http.Client{}
+
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	defer func(resp *http.Response) {
+		_ = resp.Body.Close()
+	}(resp)
+
+	if resp.StatusCode >= 300 {
+		return &solrStatusError{status: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// solrStatusError is an update solr rejected, which is only worth retrying
+// on another node for server errors.
+type solrStatusError struct {
+	status int
+}
+
+func (e *solrStatusError) Error() string {
+	return fmt.Sprintf("solr update returned status %d", e.status)
+}
+
+// solrDescriptionField is the field the parser writes with atomic updates.
+const solrDescriptionField = "post_description"
+
+// SolrSchemaConfig checks at startup that the solr core has the fields the
+// parser updates, rather than every update failing once running.
+type SolrSchemaConfig struct {
+	Check bool `json:"check"`
+	// Create adds missing fields through the schema api.
+	Create bool `json:"create"`
+	// DescriptionType is the field type post_description is created with.
+	DescriptionType string `json:"descriptionType"`
+}
+
+// checkSolrSchema verifies the core's unique key is id and that it has a
+// post_description field, creating the field if configured to.
+func checkSolrSchema(solrBaseUrl string, timeout time.Duration, config SolrSchemaConfig) error {
+	httpClient := &http.Client{Timeout: timeout}
+
+	var uniqueKey struct {
+		UniqueKey string `json:"uniqueKey"`
+	}
+
+	status, err := getSolrJson(httpClient, solrBaseUrl+"/schema/uniquekey", &uniqueKey)
+	if err != nil {
+		return fmt.Errorf("reading unique key: %w", err)
+	}
+
+	if status != http.StatusOK {
+		return fmt.Errorf("reading unique key: schema api returned status %d", status)
+	}
+
+	if uniqueKey.UniqueKey != "id" {
+		return fmt.Errorf("unique key is %q, the parser updates documents by id", uniqueKey.UniqueKey)
+	}
+
+	status, err = getSolrJson(httpClient, solrBaseUrl+"/schema/fields/"+solrDescriptionField, nil)
+	if err != nil {
+		return fmt.Errorf("reading field %s: %w", solrDescriptionField, err)
+	}
+
+	switch {
+	case status == http.StatusOK:
+		return nil
+	case status != http.StatusNotFound:
+		return fmt.Errorf("reading field %s: schema api returned status %d", solrDescriptionField, status)
+	case !config.Create:
+		return fmt.Errorf("field %s is missing from the schema", solrDescriptionField)
+	}
+
+	fieldType := config.DescriptionType
+	if fieldType == "" {
+		fieldType = "text_general"
+	}
+
+	fmt.Println("creating solr field", solrDescriptionField, "of type", fieldType)
+
+	addField := map[string]interface{}{
+		"add-field": map[string]interface{}{
+			"name":    solrDescriptionField,
+			"type":    fieldType,
+			"indexed": true,
+			"stored":  true,
+		},
+	}
+
+	err = sendJson(httpClient, "POST", solrBaseUrl+"/schema", nil, addField)
+	if err != nil {
+		return fmt.Errorf("creating field %s: %w", solrDescriptionField, err)
+	}
+
+	return nil
+}
+
+// getSolrJson decodes a successful response into v, which may be nil.
+func getSolrJson(httpClient *http.Client, solrUrl string, v interface{}) (int, error) {
+	resp, err := httpClient.Get(solrUrl)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func(resp *http.Response) {
+		_ = resp.Body.Close()
+	}(resp)
+
+	if resp.StatusCode != http.StatusOK || v == nil {
+		return resp.StatusCode, nil
+	}
+
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(v)
+}
+
+// runReindexSolr sends the description of every post that has one to solr,
+// e.g. to rebuild the index after a schema change. Batches are committed
+// within commit-within by solr rather than one by one:
+// ogparser reindex-solr [-batch 500] [-rate 200] [-commit-within 10s] [-from-id n]
+func runReindexSolr(args []string) {
+	flags := flag.NewFlagSet("reindex-solr", flag.ExitOnError)
+	batchSize := flags.Int("batch", 500, "how many posts to send per update")
+	rate := flags.Int("rate", 0, "the most posts to send per second, or 0 for no limit")
+	commitWithin := flags.Duration("commit-within", 10*time.Second, "how soon solr has to commit each batch")
+	fromID := flags.Int64("from-id", 0, "only reindex posts with a greater id")
+	tenantName := flags.String("tenant", primaryTenantName, "which tenant's posts to reindex")
+	_ = flags.Parse(args)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		kill("loading config file", err)
+	}
+
+	tenantConfig, ok := findTenantConfig(config, *tenantName)
+	if !ok {
+		kill("finding tenant", fmt.Errorf("no tenant named %s", *tenantName))
+	}
+
+	config = config.forTenant(tenantConfig)
+
+	if !config.solrEnabled() {
+		kill("reindexing solr", fmt.Errorf("no solr is configured for tenant %s", tenantConfig.Name))
+	}
+
+	store, err := newSqlStore(config.Db)
+	if err != nil {
+		kill("opening db connection", err)
+	}
+
+	defer func() {
+		_ = store.Close()
+	}()
+
+	ctx := context.Background()
+
+	total, err := store.CountPostsAfterID(ctx, *fromID)
+	if err != nil {
+		kill("counting posts", err)
+	}
+
+	params := fmt.Sprintf("commitWithin=%d", commitWithin.Milliseconds())
+	progress := newProgressLogger("reindex-solr", total)
+	query := StoredPostsQuery{AfterID: *fromID, WithDescription: true, Limit: *batchSize}
+	sent := 0
+
+	for {
+		batchStarted := clock.Now()
+
+		posts, err := store.StoredPosts(ctx, query)
+		if err != nil {
+			kill(fmt.Sprintf("loading posts after id %d", query.AfterID), err)
+		}
+
+		if len(posts) == 0 {
+			break
+		}
+
+		docs := make(AbtSolrDocs, 0, len(posts))
+		for _, post := range posts {
+			docs = append(docs, AbtSolrDocument{
+				Id:              post.Post.PostID,
+				PostDescription: SolrSetDocument{Set: truncateDescription(post.Description, config.DescriptionLimits.Solr)},
+			})
+		}
+
+		err = postToSolr(config, params, docs)
+		if err != nil {
+			kill(fmt.Sprintf("sending posts after id %d to solr", query.AfterID), err)
+		}
+
+		sent += len(docs)
+		progress.add(len(docs))
+		query.AfterID = posts[len(posts)-1].Post.PostID
+
+		if *rate > 0 {
+			batchDuration := time.Duration(len(docs)) * time.Second / time.Duration(*rate)
+			<-clock.After(batchDuration - clock.Now().Sub(batchStarted))
+		}
+	}
+
+	fmt.Println("Reindexed", sent, "posts in solr, last post id", query.AfterID)
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+)
+
+const defaultSolrCloudRefresh = time.Minute
+
+// SolrCloudConfig replaces the single solr url with a SolrCloud collection.
+// Cluster state is read from ZooKeeper when zkHosts is set, otherwise from
+// the collections api of the first node that answers.
+type SolrCloudConfig struct {
+	Collection string   `json:"collection"`
+	Nodes      []string `json:"nodes"`
+	ZkHosts    []string `json:"zkHosts"`
+	ZkChroot   string   `json:"zkChroot"`
+	// Refresh is how long cluster state is cached for. It is always reloaded
+	// after an update fails on every replica of a shard.
+	Refresh string `json:"refresh"`
+}
+
+type solrReplica struct {
+	baseUrl string
+	leader  bool
+}
+
+type solrShard struct {
+	name     string
+	min, max int32
+	// replicas that are active on a live node, leader first
+	replicas []solrReplica
+}
+
+type solrCloud struct {
+	config SolrCloudConfig
+
+	mu      sync.Mutex
+	shards  []solrShard
+	loaded  time.Time
+	refresh time.Duration
+}
+
+var (
+	solrCloudsMu sync.Mutex
+	solrClouds   = map[string]*solrCloud{}
+)
+
+// solrCloudFor shares cluster state between every update to a collection.
+func solrCloudFor(config SolrCloudConfig) *solrCloud {
+	key := config.Collection + "|" + strings.Join(config.ZkHosts, ",") + config.ZkChroot + "|" + strings.Join(config.Nodes, ",")
+
+	solrCloudsMu.Lock()
+	defer solrCloudsMu.Unlock()
+
+	cloud, ok := solrClouds[key]
+	if !ok {
+		cloud = &solrCloud{config: config, refresh: parseDurationOr(config.Refresh, defaultSolrCloudRefresh)}
+		solrClouds[key] = cloud
+	}
+
+	return cloud
+}
+
+// solrEnabled is whether posts are sent to a solr core or collection.
+func (c AppConfig) solrEnabled() bool {
+	if c.SolrEnabled != nil && !*c.SolrEnabled {
+		return false
+	}
+
+	return c.Solr != "" || c.SolrCloud != nil
+}
+
+// logSolrTarget says where a tenant's descriptions are indexed, if anywhere.
+func logSolrTarget(tenantName string, config AppConfig) {
+	switch {
+	case config.SolrEnabled != nil && !*config.SolrEnabled:
+		fmt.Println("Solr is disabled for tenant", tenantName)
+	case config.SolrCloud != nil:
+		fmt.Println("Indexing descriptions in solr collection", config.SolrCloud.Collection, "for tenant", tenantName)
+	case config.Solr != "":
+		fmt.Println("Indexing descriptions in solr at", config.Solr, "for tenant", tenantName)
+	default:
+		fmt.Println("No solr is configured for tenant", tenantName)
+	}
+}
+
+// solrCoreUrl is a url the core or collection's own apis, such as the schema
+// api, can be reached at.
+func (c AppConfig) solrCoreUrl() (string, error) {
+	if c.SolrCloud == nil {
+		return c.Solr, nil
+	}
+
+	return solrCloudFor(*c.SolrCloud).collectionUrl()
+}
+
+// postToSolr sends docs to the configured core, or to the leader of each
+// doc's shard in SolrCloud. params is the update handler's query string.
+func postToSolr(config AppConfig, params string, docs AbtSolrDocs) error {
+	if config.SolrCloud == nil {
+		return sendSolrUpdate(config.Solr+"/update?"+params, config.solrTimeout(), docs)
+	}
+
+	return solrCloudFor(*config.SolrCloud).update(params, config.solrTimeout(), docs)
+}
+
+func (s *solrCloud) update(params string, timeout time.Duration, docs AbtSolrDocs) error {
+	shards, err := s.state(false)
+	if err != nil {
+		return err
+	}
+
+	routed, err := routeSolrDocs(shards, docs)
+	if err != nil {
+		return err
+	}
+
+	for shard, shardDocs := range routed {
+		err = s.updateShard(*shard, params, timeout, shardDocs)
+		if err == nil {
+			continue
+		}
+
+		var statusErr *solrStatusError
+		if errors.As(err, &statusErr) && statusErr.status < 500 {
+			return err
+		}
+
+		// leadership or membership may have changed since state was loaded
+		shards, err = s.state(true)
+		if err != nil {
+			return err
+		}
+
+		for _, fresh := range shards {
+			if fresh.name == shard.name {
+				err = s.updateShard(fresh, params, timeout, shardDocs)
+				break
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("updating shard %s: %w", shard.name, err)
+		}
+	}
+
+	return nil
+}
+
+// updateShard tries each replica in turn, leader first. Non-leaders forward
+// the update to the leader themselves.
+func (s *solrCloud) updateShard(shard solrShard, params string, timeout time.Duration, docs AbtSolrDocs) error {
+	if len(shard.replicas) == 0 {
+		return fmt.Errorf("shard %s has no active replicas", shard.name)
+	}
+
+	var err error
+	for _, replica := range shard.replicas {
+		updateUrl := fmt.Sprintf("%s/%s/update?%s", replica.baseUrl, s.config.Collection, params)
+
+		err = sendSolrUpdate(updateUrl, timeout, docs)
+		if err == nil {
+			return nil
+		}
+
+		var statusErr *solrStatusError
+		if errors.As(err, &statusErr) && statusErr.status < 500 {
+			return err
+		}
+
+		fmt.Println("solr replica", replica.baseUrl, "failed for shard", shard.name, err.Error())
+	}
+
+	return err
+}
+
+func (s *solrCloud) collectionUrl() (string, error) {
+	shards, err := s.state(false)
+	if err != nil {
+		return "", err
+	}
+
+	for _, shard := range shards {
+		if len(shard.replicas) > 0 {
+			return shard.replicas[0].baseUrl + "/" + s.config.Collection, nil
+		}
+	}
+
+	return "", fmt.Errorf("collection %s has no active replicas", s.config.Collection)
+}
+
+func (s *solrCloud) state(reload bool) ([]solrShard, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !reload && s.shards != nil && clock.Now().Sub(s.loaded) < s.refresh {
+		return s.shards, nil
+	}
+
+	var shards []solrShard
+	var err error
+
+	if len(s.config.ZkHosts) > 0 {
+		shards, err = s.stateFromZk()
+	} else {
+		shards, err = s.stateFromNodes()
+	}
+
+	if err != nil {
+		if s.shards != nil {
+			fmt.Println("could not reload solr cluster state, using the last known state", err.Error())
+			return s.shards, nil
+		}
+
+		return nil, fmt.Errorf("loading solr cluster state for %s: %w", s.config.Collection, err)
+	}
+
+	s.shards = shards
+	s.loaded = clock.Now()
+
+	return shards, nil
+}
+
+// solrCollectionState is a collection in state.json or CLUSTERSTATUS, which
+// share a layout.
+type solrCollectionState struct {
+	Shards map[string]struct {
+		Range    string `json:"range"`
+		State    string `json:"state"`
+		Replicas map[string]struct {
+			BaseUrl  string `json:"base_url"`
+			NodeName string `json:"node_name"`
+			State    string `json:"state"`
+			Leader   string `json:"leader"`
+		} `json:"replicas"`
+	} `json:"shards"`
+}
+
+func (s *solrCloud) stateFromNodes() ([]solrShard, error) {
+	if len(s.config.Nodes) == 0 {
+		return nil, errors.New("solrCloud needs either nodes or zkHosts")
+	}
+
+	httpClient := &http.Client{Timeout: defaultSolrTimeout}
+
+	var status struct {
+		Cluster struct {
+			Collections map[string]solrCollectionState `json:"collections"`
+			LiveNodes   []string                       `json:"live_nodes"`
+		} `json:"cluster"`
+	}
+
+	var err error
+	for _, node := range s.config.Nodes {
+		statusUrl := fmt.Sprintf(
+			"%s/admin/collections?action=CLUSTERSTATUS&collection=%s",
+			strings.TrimSuffix(node, "/"), url.QueryEscape(s.config.Collection),
+		)
+
+		var code int
+		code, err = getSolrJson(httpClient, statusUrl, &status)
+		if err == nil && code != http.StatusOK {
+			err = fmt.Errorf("cluster status returned status %d", code)
+		}
+
+		if err == nil {
+			collection, ok := status.Cluster.Collections[s.config.Collection]
+			if !ok {
+				return nil, fmt.Errorf("no collection named %s", s.config.Collection)
+			}
+
+			return collection.shards(status.Cluster.LiveNodes, nodeScheme(node))
+		}
+
+		fmt.Println("solr node", node, "could not report cluster status", err.Error())
+	}
+
+	return nil, err
+}
+
+func (s *solrCloud) stateFromZk() ([]solrShard, error) {
+	conn, _, err := zk.Connect(s.config.ZkHosts, 10*time.Second, zk.WithLogInfo(false))
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	root := strings.TrimSuffix(s.config.ZkChroot, "/")
+
+	liveNodes, _, err := conn.Children(root + "/live_nodes")
+	if err != nil {
+		return nil, fmt.Errorf("reading live nodes: %w", err)
+	}
+
+	scheme := "http"
+	props, _, err := conn.Get(root + "/clusterprops.json")
+	if err == nil && len(props) > 0 {
+		var clusterProps struct {
+			UrlScheme string `json:"urlScheme"`
+		}
+
+		if json.Unmarshal(props, &clusterProps) == nil && clusterProps.UrlScheme != "" {
+			scheme = clusterProps.UrlScheme
+		}
+	} else if err != nil && !errors.Is(err, zk.ErrNoNode) {
+		return nil, fmt.Errorf("reading cluster properties: %w", err)
+	}
+
+	stateJson, _, err := conn.Get(fmt.Sprintf("%s/collections/%s/state.json", root, s.config.Collection))
+	if err != nil {
+		return nil, fmt.Errorf("reading state of collection %s: %w", s.config.Collection, err)
+	}
+
+	var state map[string]solrCollectionState
+	err = json.Unmarshal(stateJson, &state)
+	if err != nil {
+		return nil, fmt.Errorf("parsing state of collection %s: %w", s.config.Collection, err)
+	}
+
+	collection, ok := state[s.config.Collection]
+	if !ok {
+		return nil, fmt.Errorf("no collection named %s", s.config.Collection)
+	}
+
+	return collection.shards(liveNodes, scheme)
+}
+
+func (c solrCollectionState) shards(liveNodes []string, scheme string) ([]solrShard, error) {
+	live := make(map[string]bool, len(liveNodes))
+	for _, node := range liveNodes {
+		live[node] = true
+	}
+
+	shards := make([]solrShard, 0, len(c.Shards))
+
+	for name, state := range c.Shards {
+		if state.State != "" && state.State != "active" {
+			continue
+		}
+
+		shard := solrShard{name: name}
+
+		min, max, err := parseHashRange(state.Range)
+		if err != nil {
+			return nil, fmt.Errorf("shard %s: %w", name, err)
+		}
+
+		shard.min, shard.max = min, max
+
+		for _, replica := range state.Replicas {
+			if replica.State != "active" || !live[replica.NodeName] {
+				continue
+			}
+
+			baseUrl := replica.BaseUrl
+			if baseUrl == "" {
+				baseUrl = nodeNameUrl(replica.NodeName, scheme)
+			}
+
+			r := solrReplica{baseUrl: strings.TrimSuffix(baseUrl, "/"), leader: replica.Leader == "true"}
+			if r.leader {
+				shard.replicas = append([]solrReplica{r}, shard.replicas...)
+			} else {
+				shard.replicas = append(shard.replicas, r)
+			}
+		}
+
+		shards = append(shards, shard)
+	}
+
+	if len(shards) == 0 {
+		return nil, errors.New("collection has no active shards")
+	}
+
+	return shards, nil
+}
+
+// parseHashRange parses a shard's hash range, e.g. "80000000-ffffffff". A
+// shard without one, as with the implicit router, takes every doc.
+func parseHashRange(hashRange string) (int32, int32, error) {
+	if hashRange == "" {
+		return -1 << 31, 1<<31 - 1, nil
+	}
+
+	parts := strings.SplitN(hashRange, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid hash range %q", hashRange)
+	}
+
+	min, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hash range %q", hashRange)
+	}
+
+	max, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hash range %q", hashRange)
+	}
+
+	return int32(uint32(min)), int32(uint32(max)), nil
+}
+
+// nodeNameUrl turns a live node name such as "solr1:8983_solr" into its
+// base url, for Solr versions that no longer store base_url.
+func nodeNameUrl(nodeName string, scheme string) string {
+	hostPort, context := nodeName, ""
+	if i := strings.Index(nodeName, "_"); i >= 0 {
+		hostPort, context = nodeName[:i], nodeName[i+1:]
+	}
+
+	context, err := url.PathUnescape(context)
+	if err != nil {
+		context = ""
+	}
+
+	if context == "" {
+		return scheme + "://" + hostPort
+	}
+
+	return scheme + "://" + hostPort + "/" + strings.Trim(context, "/")
+}
+
+func nodeScheme(node string) string {
+	u, err := url.Parse(node)
+	if err != nil || u.Scheme == "" {
+		return "http"
+	}
+
+	return u.Scheme
+}
+
+// routeSolrDocs groups docs by the shard the compositeId router puts them in.
+func routeSolrDocs(shards []solrShard, docs AbtSolrDocs) (map[*solrShard]AbtSolrDocs, error) {
+	routed := map[*solrShard]AbtSolrDocs{}
+
+docs:
+	for _, doc := range docs {
+		hash := int32(murmur3(strconv.FormatInt(doc.Id, 10)))
+
+		for i := range shards {
+			if hash >= shards[i].min && hash <= shards[i].max {
+				routed[&shards[i]] = append(routed[&shards[i]], doc)
+				continue docs
+			}
+		}
+
+		return nil, fmt.Errorf("no active shard covers post %d", doc.Id)
+	}
+
+	return routed, nil
+}
+
+// murmur3 is the 32 bit x86 MurmurHash3 with seed 0 that solr hashes ids
+// with.
+func murmur3(id string) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+
+	data := []byte(id)
+	var h uint32
+
+	for len(data) >= 4 {
+		k := binary.LittleEndian.Uint32(data)
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+
+		data = data[4:]
+	}
+
+	var k uint32
+	switch len(data) {
+	case 3:
+		k ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(id))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+
+	return h
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// DomainStats summarises the scrape attempts made against one domain.
+type DomainStats struct {
+	Domain      string
+	Attempts    int
+	Successes   int
+	AvgDuration time.Duration
+	// TopFailure is the most common error (or status code) of the failed
+	// attempts.
+	TopFailure string
+}
+
+func (d DomainStats) successRate() float64 {
+	if d.Attempts == 0 {
+		return 0
+	}
+
+	return float64(d.Successes) / float64(d.Attempts)
+}
+
+// aggregateDomainStats groups attempts by domain, worst success rate first.
+func aggregateDomainStats(attempts []ScrapeAttempt) []DomainStats {
+	byDomain := make(map[string]*DomainStats)
+	totalDuration := make(map[string]time.Duration)
+	failures := make(map[string]map[string]int)
+
+	for _, attempt := range attempts {
+		domain := attempt.Domain
+		if domain == "" {
+			domain = "unknown"
+		}
+
+		stats, ok := byDomain[domain]
+		if !ok {
+			stats = &DomainStats{Domain: domain}
+			byDomain[domain] = stats
+			failures[domain] = make(map[string]int)
+		}
+
+		stats.Attempts++
+		totalDuration[domain] += attempt.Duration
+
+		if attempt.Success {
+			stats.Successes++
+			continue
+		}
+
+		failures[domain][failureReason(attempt)]++
+	}
+
+	domains := make([]DomainStats, 0, len(byDomain))
+	for domain, stats := range byDomain {
+		stats.AvgDuration = totalDuration[domain] / time.Duration(stats.Attempts)
+		stats.TopFailure = mostCommon(failures[domain])
+		domains = append(domains, *stats)
+	}
+
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].successRate() != domains[j].successRate() {
+			return domains[i].successRate() < domains[j].successRate()
+		}
+
+		return domains[i].Attempts > domains[j].Attempts
+	})
+
+	return domains
+}
+
+func failureReason(attempt ScrapeAttempt) string {
+	if attempt.Error != "" {
+		return attempt.Error
+	}
+
+	if attempt.StatusCode != 0 {
+		return fmt.Sprintf("status %d", attempt.StatusCode)
+	}
+
+	return "empty response"
+}
+
+func mostCommon(counts map[string]int) string {
+	top := ""
+	for reason, count := range counts {
+		if count > counts[top] || (count == counts[top] && reason < top) {
+			top = reason
+		}
+	}
+
+	return top
+}
+
+func writeDomainStats(w io.Writer, domains []DomainStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "DOMAIN\tATTEMPTS\tSUCCESS\tAVG LATENCY\tTOP FAILURE")
+	for _, d := range domains {
+		_, _ = fmt.Fprintf(
+			tw,
+			"%s\t%d\t%.0f%%\t%s\t%s\n",
+			d.Domain,
+			d.Attempts,
+			d.successRate()*100,
+			d.AvgDuration.Round(time.Millisecond),
+			truncateRunes(d.TopFailure, 80),
+		)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,785 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Store is where posts to scrape come from and where their metadata is
+// saved.
+type Store interface {
+	Ping(ctx context.Context) error
+	PostsToScrape(ctx context.Context, filter PostFilter) ([]Post, error)
+	// MarkPermanentFailure stops a post whose page can never be scraped from
+	// being picked up again.
+	MarkPermanentFailure(ctx context.Context, postID int64, reason string) error
+	// PostsAfterID pages through every post in id order, for backfills,
+	// skipping permanent failures.
+	PostsAfterID(ctx context.Context, afterID int64, limit int) ([]Post, error)
+	CountPostsAfterID(ctx context.Context, afterID int64) (int, error)
+	// LoadCheckpoint returns the last post id a backfill processed, and
+	// whether it had saved one.
+	LoadCheckpoint(ctx context.Context, name string) (int64, bool, error)
+	SaveCheckpoint(ctx context.Context, name string, lastPostID int64) error
+	// PostsByID loads posts that were pushed to the parser by id.
+	PostsByID(ctx context.Context, ids []int64) ([]Post, error)
+	// StoredPosts loads what has been saved for posts, in id order.
+	StoredPosts(ctx context.Context, query StoredPostsQuery) ([]StoredPost, error)
+	// SaveMetadata reports whether anything was written, which it isn't when
+	// the post was last saved with the same values.
+	SaveMetadata(ctx context.Context, scraped PostScraped, opts SaveOptions) (bool, error)
+	// SaveContentHash marks a post as saved with the values hashed, once
+	// they reached solr and the sinks too.
+	SaveContentHash(ctx context.Context, postID int64, hash string) error
+	RecordAttempt(ctx context.Context, attempt ScrapeAttempt) error
+	// SaveResponse keeps the latest response metadata of a post.
+	SaveResponse(ctx context.Context, response ResponseMetadata) error
+	// SaveSiteBranding updates a domain's branding with the values set.
+	SaveSiteBranding(ctx context.Context, branding SiteBranding) error
+	RecordAudit(ctx context.Context, entry AuditEntry) error
+	// AuditTrail returns a post's latest audit entries, newest first.
+	AuditTrail(ctx context.Context, postID int64, limit int) ([]AuditEntry, error)
+	AttemptsSince(ctx context.Context, since time.Time) ([]ScrapeAttempt, error)
+	RecordRun(ctx context.Context, run ScrapeRun) error
+	// Runs returns the latest cycles, newest first.
+	Runs(ctx context.Context, limit int) ([]ScrapeRun, error)
+	// SaveDiscoveredFeeds returns the feeds that had not been seen before.
+	SaveDiscoveredFeeds(ctx context.Context, post Post, feeds []string) ([]string, error)
+	// ClaimOutbox removes up to limit posts from the outbox of newly inserted
+	// posts and returns them.
+	ClaimOutbox(ctx context.Context, limit int) ([]Post, error)
+	// ClearOutbox drops outbox entries queued before a full cycle started,
+	// as that cycle has covered them.
+	ClearOutbox(ctx context.Context, before time.Time) error
+	// SetPriority moves a post up (or down) the queue of posts to scrape.
+	SetPriority(ctx context.Context, postID int64, priority int) error
+	Migrate(ctx context.Context) error
+	Close() error
+}
+
+// StoredPostsQuery selects stored posts. Only the conditions that are set
+// apply.
+type StoredPostsQuery struct {
+	IDs     []int64
+	AfterID int64
+	// ModifiedSince leaves out posts last saved before then
+	ModifiedSince time.Time
+	// WithDescription leaves out posts without a description
+	WithDescription bool
+	// WithContent also loads the stored html, which can be large
+	WithContent bool
+	Limit       int
+}
+
+// StoredPost is a post as it was last saved.
+type StoredPost struct {
+	Post          Post
+	Title         string
+	Description   string
+	FeaturedImage string
+	Language      string
+	Modified      time.Time
+	Metadata      PostMetadata
+	Content       string
+}
+
+type SaveOptions struct {
+	StoreMetaTags bool
+}
+
+// ScrapeAttempt is recorded for every post a cycle tries to scrape.
+type ScrapeAttempt struct {
+	PostID     int64
+	Domain     string
+	Attempted  time.Time
+	Duration   time.Duration
+	StatusCode int
+	Error      string
+	Success    bool
+}
+
+func newScrapeAttempt(scraped PostScraped) ScrapeAttempt {
+	attempt := ScrapeAttempt{
+		PostID:     scraped.Post.PostID,
+		Domain:     routingKeyDomain(scraped.Post.Url),
+		Attempted:  clock.Now().UTC(),
+		Duration:   scraped.FetchDuration,
+		StatusCode: scraped.StatusCode,
+		Success:    scraped.Html != "",
+	}
+
+	if scraped.FetchErr != nil {
+		attempt.Error = scraped.FetchErr.Error()
+	}
+
+	return attempt
+}
+
+// sqlStore is the Store for the aggregator's own mysql (or sqlite) database.
+type sqlStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+	// fourByte is the DbConfig's fourByteMode
+	fourByte string
+}
+
+func newSqlStore(config DbConfig) (*sqlStore, error) {
+	db, dialect, err := openDb(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlStore{db: db, dialect: dialect, fourByte: config.fourByteMode()}, nil
+}
+
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqlStore) Migrate(ctx context.Context) error {
+	return migrate(ctx, s.db, s.dialect)
+}
+
+func (s *sqlStore) PostsToScrape(ctx context.Context, filter PostFilter) ([]Post, error) {
+	conditions, args := filter.sqlConditions()
+
+	posts, err := s.queryPosts(ctx, s.dialect.recentPostsQuery+conditions+" ORDER BY priority DESC, created DESC", args...)
+	if err != nil {
+		return posts, err
+	}
+
+	return filter.byDomain(posts), nil
+}
+
+func (s *sqlStore) PostsByID(ctx context.Context, ids []int64) ([]Post, error) {
+	if len(ids) == 0 {
+		return make([]Post, 0), nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	return s.queryPosts(
+		ctx,
+		"SELECT pk_post_id, link, description, priority, fk_feed_id FROM posts WHERE pk_post_id IN ("+
+			strings.Join(placeholders, ", ")+") ORDER BY priority DESC, created DESC",
+		args...,
+	)
+}
+
+func (s *sqlStore) PostsAfterID(ctx context.Context, afterID int64, limit int) ([]Post, error) {
+	return s.queryPosts(
+		ctx,
+		"SELECT pk_post_id, link, description, priority, fk_feed_id FROM posts "+
+			"WHERE pk_post_id > ? AND permanent_failure IS NULL ORDER BY pk_post_id LIMIT ?",
+		afterID,
+		limit,
+	)
+}
+
+func (s *sqlStore) CountPostsAfterID(ctx context.Context, afterID int64) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(
+		ctx, "SELECT COUNT(*) FROM posts WHERE pk_post_id > ? AND permanent_failure IS NULL", afterID,
+	).Scan(&count)
+
+	return count, err
+}
+
+func (s *sqlStore) MarkPermanentFailure(ctx context.Context, postID int64, reason string) error {
+	_, err := s.db.ExecContext(
+		ctx, "UPDATE posts SET permanent_failure = ? WHERE pk_post_id = ?", truncateRunes(reason, 255), postID,
+	)
+
+	return err
+}
+
+func (s *sqlStore) LoadCheckpoint(ctx context.Context, name string) (int64, bool, error) {
+	var lastPostID int64
+	err := s.db.QueryRowContext(
+		ctx, "SELECT last_post_id FROM backfill_checkpoints WHERE name = ?", name,
+	).Scan(&lastPostID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return lastPostID, true, nil
+}
+
+func (s *sqlStore) SaveCheckpoint(ctx context.Context, name string, lastPostID int64) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		s.dialect.upsertCheckpointQuery,
+		name,
+		lastPostID,
+		clock.Now().UTC().Format("2006-01-02 15:04:05"),
+	)
+
+	return err
+}
+
+func (s *sqlStore) StoredPosts(ctx context.Context, query StoredPostsQuery) ([]StoredPost, error) {
+	posts := make([]StoredPost, 0)
+
+	content := "NULL"
+	if query.WithContent {
+		content = "p.content"
+	}
+
+	sqlQuery := "SELECT p.pk_post_id, p.link, p.title, p.description, p.language, p.modified, p.metadata, " + content +
+		", (SELECT f.external_url FROM files f WHERE f.fk_post_id = p.pk_post_id ORDER BY f.pk_file_id LIMIT 1) " +
+		"FROM posts p WHERE p.pk_post_id > ?"
+	args := []interface{}{query.AfterID}
+
+	if len(query.IDs) > 0 {
+		placeholders := make([]string, len(query.IDs))
+		for i, id := range query.IDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		sqlQuery += " AND p.pk_post_id IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	if !query.ModifiedSince.IsZero() {
+		sqlQuery += " AND p.modified >= ?"
+		args = append(args, query.ModifiedSince.UTC().Format("2006-01-02 15:04:05"))
+	}
+
+	if query.WithDescription {
+		sqlQuery += " AND p.description <> ''"
+	}
+
+	sqlQuery += " ORDER BY p.pk_post_id"
+
+	if query.Limit > 0 {
+		sqlQuery += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return posts, err
+	}
+
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		var title, description, language, modified, metadata, content, image sql.NullString
+		post := StoredPost{}
+
+		err = rows.Scan(
+			&post.Post.PostID, &post.Post.Url, &title, &description, &language, &modified, &metadata, &content, &image,
+		)
+		if err != nil {
+			return posts, err
+		}
+
+		post.Title = title.String
+		post.Description = description.String
+		post.Post.OrigDescription = description.String
+		post.Language = language.String
+		post.Modified, _ = time.Parse("2006-01-02 15:04:05", modified.String)
+		post.Content = content.String
+		post.FeaturedImage = image.String
+
+		if metadata.Valid {
+			_ = json.Unmarshal([]byte(metadata.String), &post.Metadata)
+		}
+
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+func (s *sqlStore) queryPosts(ctx context.Context, query string, args ...interface{}) ([]Post, error) {
+	posts := make([]Post, 0)
+
+	getPostsRows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return posts, err
+	}
+
+	defer func(getPostsRows *sql.Rows) {
+		_ = getPostsRows.Close()
+	}(getPostsRows)
+
+	for getPostsRows.Next() {
+		post := Post{}
+		// the description is NULL for posts whose feed had none
+		var description sql.NullString
+		var feedID sql.NullInt64
+		err = getPostsRows.Scan(
+			&post.PostID,
+			&post.Url,
+			&description,
+			&post.Priority,
+			&feedID,
+		)
+		if err != nil {
+			return posts, err
+		}
+
+		post.OrigDescription = description.String
+		post.FeedID = feedID.Int64
+
+		posts = append(posts, post)
+	}
+
+	return posts, getPostsRows.Err()
+}
+
+func (s *sqlStore) ClaimOutbox(ctx context.Context, limit int) ([]Post, error) {
+	posts := make([]Post, 0)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return posts, err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT o.pk_post_outbox_id, p.pk_post_id, p.link, p.description, p.priority, p.fk_feed_id FROM post_outbox o "+
+			"JOIN posts p ON p.pk_post_id = o.fk_post_id ORDER BY o.pk_post_outbox_id LIMIT ?",
+		limit,
+	)
+	if err != nil {
+		return posts, err
+	}
+
+	lastID := int64(0)
+	for rows.Next() {
+		post := Post{}
+		var description sql.NullString
+		var feedID sql.NullInt64
+		err = rows.Scan(&lastID, &post.PostID, &post.Url, &description, &post.Priority, &feedID)
+		if err != nil {
+			_ = rows.Close()
+			return posts, err
+		}
+
+		post.OrigDescription = description.String
+		post.FeedID = feedID.Int64
+
+		posts = append(posts, post)
+	}
+
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return posts, err
+	}
+
+	if lastID == 0 {
+		return posts, nil
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM post_outbox WHERE pk_post_outbox_id <= ?", lastID)
+	if err != nil {
+		return posts, err
+	}
+
+	return posts, tx.Commit()
+}
+
+func (s *sqlStore) ClearOutbox(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(
+		ctx, "DELETE FROM post_outbox WHERE created < ?", before.UTC().Format("2006-01-02 15:04:05"),
+	)
+
+	return err
+}
+
+func (s *sqlStore) SaveMetadata(ctx context.Context, scraped PostScraped, opts SaveOptions) (bool, error) {
+	hash := scraped.contentHash(opts)
+
+	// an unchanged hash leaves the post, and modified, alone
+	var storedHash sql.NullString
+	err := s.db.QueryRowContext(
+		ctx, "SELECT content_hash FROM posts WHERE pk_post_id = ?", scraped.Post.PostID,
+	).Scan(&storedHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("loading content hash: %w", err)
+	}
+
+	if storedHash.Valid && storedHash.String == hash {
+		return false, nil
+	}
+
+	description := scraped.description()
+	metadata := scraped.OpenGraphTags.metadataJson()
+
+	// modified only moves when the description or metadata differ, so posts
+	// saved before content_hash existed, or whose stored meta tags or html
+	// changed, keep their place in "recently updated" lists. It's assigned
+	// first as mysql would otherwise compare against the new values.
+	query := "UPDATE posts SET modified = CASE WHEN COALESCE(description, '') = ? AND " + s.dialect.sameMetadataCondition + " " +
+		"THEN modified ELSE ? END, description = ?, content = ?, metadata = ?, language = ?, is_nsfw = ?, " +
+		"word_count = ?, reading_minutes = ?, direction = ?"
+	args := []interface{}{
+		description,
+		metadata,
+		clock.Now().UTC().Format("2006-01-02 15:04:05"),
+		description,
+		scraped.Html,
+		metadata,
+		nullString(scraped.OpenGraphTags.Language),
+		scraped.OpenGraphTags.Nsfw,
+		nullInt(scraped.OpenGraphTags.WordCount),
+		nullInt(scraped.OpenGraphTags.ReadingMinutes),
+		nullString(scraped.OpenGraphTags.Direction),
+	}
+
+	if opts.StoreMetaTags {
+		query += ", meta_tags = ?"
+		args = append(args, scraped.OpenGraphTags.metaTagsJson())
+	}
+
+	query += " WHERE pk_post_id = ?"
+	args = append(args, scraped.Post.PostID)
+
+	_, err = s.db.ExecContext(ctx, query, s.safeArgs(args)...)
+	if err != nil {
+		return false, fmt.Errorf("updating post with og values: %w", err)
+	}
+
+	err = s.saveTags(ctx, scraped.Post.PostID, scraped.OpenGraphTags.Tags)
+	if err != nil {
+		return true, err
+	}
+
+	err = s.saveAlternates(ctx, scraped.Post.PostID, scraped.OpenGraphTags.Alternates)
+	if err != nil {
+		return true, err
+	}
+
+	err = s.saveSimhash(ctx, scraped.Post.PostID, scraped.OpenGraphTags.Simhash)
+	if err != nil {
+		return true, err
+	}
+
+	err = s.saveFeaturedImage(ctx, scraped.Post.PostID, scraped.OpenGraphTags.FeaturedImage)
+	if err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+func (s *sqlStore) SaveContentHash(ctx context.Context, postID int64, hash string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE posts SET content_hash = ? WHERE pk_post_id = ?", hash, postID)
+	if err != nil {
+		return fmt.Errorf("storing content hash: %w", err)
+	}
+
+	return nil
+}
+
+// saveFeaturedImage adds the post's image to its files, unless it already
+// has one.
+func (s *sqlStore) saveFeaturedImage(ctx context.Context, postID int64, image string) error {
+	if image == "" {
+		return nil
+	}
+
+	var ttlFiles int
+	err := s.db.QueryRowContext(
+		ctx, "SELECT COUNT(*) AS ttl FROM files WHERE fk_post_id = ?", postID,
+	).Scan(&ttlFiles)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("counting files: %w", err)
+	}
+
+	if ttlFiles > 0 {
+		return nil
+	}
+
+	_, err = s.db.ExecContext(ctx, "INSERT INTO files (fk_post_id, external_url) VALUES (?, ?)", postID, image)
+	if err != nil {
+		return fmt.Errorf("inserting post image: %w", err)
+	}
+
+	return nil
+}
+
+// saveTags replaces the tags extracted for a post.
+func (s *sqlStore) saveTags(ctx context.Context, postID int64, tags []string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM post_tags WHERE fk_post_id = ?", postID)
+	if err != nil {
+		return fmt.Errorf("clearing post tags: %w", err)
+	}
+
+	// replacing characters can make two tags the same
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = s.safeText(tag)
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+
+		_, err = s.db.ExecContext(ctx, "INSERT INTO post_tags (fk_post_id, tag) VALUES (?, ?)", postID, tag)
+		if err != nil {
+			return fmt.Errorf("inserting post tag: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// saveSimhash stores a post's fingerprint and marks it as a duplicate of the
+// earliest post with nearly the same one.
+func (s *sqlStore) saveSimhash(ctx context.Context, postID int64, fingerprint uint64) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM post_simhash_bands WHERE fk_post_id = ?", postID)
+	if err != nil {
+		return fmt.Errorf("clearing simhash bands: %w", err)
+	}
+
+	if fingerprint == 0 {
+		_, err = s.db.ExecContext(
+			ctx, "UPDATE posts SET simhash = NULL, duplicate_of = NULL WHERE pk_post_id = ?", postID,
+		)
+		if err != nil {
+			return fmt.Errorf("clearing simhash: %w", err)
+		}
+
+		return nil
+	}
+
+	query := "SELECT p.pk_post_id, p.simhash, p.duplicate_of FROM post_simhash_bands b " +
+		"JOIN posts p ON p.pk_post_id = b.fk_post_id WHERE b.fk_post_id <> ? AND ("
+	args := []interface{}{postID}
+
+	for band := 0; band < simhashBands; band++ {
+		if band > 0 {
+			query += " OR "
+		}
+		query += "(b.band = ? AND b.value = ?)"
+		args = append(args, band, simhashBand(fingerprint, band))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query+")", args...)
+	if err != nil {
+		return fmt.Errorf("finding duplicate candidates: %w", err)
+	}
+
+	candidates := make([]duplicateCandidate, 0)
+	for rows.Next() {
+		var candidate duplicateCandidate
+		var candidateHash int64
+		var duplicateOf sql.NullInt64
+
+		err = rows.Scan(&candidate.postID, &candidateHash, &duplicateOf)
+		if err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("finding duplicate candidates: %w", err)
+		}
+
+		candidate.simhash = uint64(candidateHash)
+		candidate.duplicateOf = duplicateOf.Int64
+		candidates = append(candidates, candidate)
+	}
+
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("finding duplicate candidates: %w", err)
+	}
+
+	for band := 0; band < simhashBands; band++ {
+		_, err = s.db.ExecContext(
+			ctx,
+			"INSERT INTO post_simhash_bands (fk_post_id, band, value) VALUES (?, ?, ?)",
+			postID, band, simhashBand(fingerprint, band),
+		)
+		if err != nil {
+			return fmt.Errorf("inserting simhash band: %w", err)
+		}
+	}
+
+	duplicateOf := sql.NullInt64{}
+	if canonical := canonicalPost(postID, fingerprint, candidates); canonical != 0 {
+		duplicateOf = sql.NullInt64{Int64: canonical, Valid: true}
+	}
+
+	// stored signed, as mysql's BIGINT and sqlite's INTEGER are
+	_, err = s.db.ExecContext(
+		ctx, "UPDATE posts SET simhash = ?, duplicate_of = ? WHERE pk_post_id = ?",
+		int64(fingerprint), duplicateOf, postID,
+	)
+	if err != nil {
+		return fmt.Errorf("saving simhash: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) SetPriority(ctx context.Context, postID int64, priority int) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE posts SET priority = ? WHERE pk_post_id = ?", priority, postID)
+
+	return err
+}
+
+func (s *sqlStore) RecordAttempt(ctx context.Context, attempt ScrapeAttempt) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO scrape_attempts (fk_post_id, domain, attempted, duration_ms, status_code, error, success) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?)",
+		attempt.PostID,
+		attempt.Domain,
+		attempt.Attempted.Format("2006-01-02 15:04:05"),
+		attempt.Duration.Milliseconds(),
+		attempt.StatusCode,
+		nullString(attempt.Error),
+		attempt.Success,
+	)
+
+	return err
+}
+
+func (s *sqlStore) RecordAudit(ctx context.Context, entry AuditEntry) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO post_audit (fk_post_id, created, status_code, bytes, outcome, details) VALUES (?, ?, ?, ?, ?, ?)",
+		entry.PostID,
+		entry.Created.Format("2006-01-02 15:04:05"),
+		entry.StatusCode,
+		entry.Bytes,
+		entry.Outcome,
+		s.safeText(entry.detailsJson()),
+	)
+
+	return err
+}
+
+func (s *sqlStore) AuditTrail(ctx context.Context, postID int64, limit int) ([]AuditEntry, error) {
+	entries := make([]AuditEntry, 0)
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT created, status_code, bytes, outcome, details FROM post_audit "+
+			"WHERE fk_post_id = ? ORDER BY created DESC, pk_post_audit_id DESC LIMIT ?",
+		postID,
+		limit,
+	)
+	if err != nil {
+		return entries, err
+	}
+
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		var created, details sql.NullString
+		entry := AuditEntry{}
+
+		err = rows.Scan(&created, &entry.StatusCode, &entry.Bytes, &entry.Outcome, &details)
+		if err != nil {
+			return entries, err
+		}
+
+		if details.Valid {
+			_ = json.Unmarshal([]byte(details.String), &entry)
+		}
+
+		entry.PostID = postID
+		entry.Created, _ = time.Parse("2006-01-02 15:04:05", created.String)
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (s *sqlStore) AttemptsSince(ctx context.Context, since time.Time) ([]ScrapeAttempt, error) {
+	attempts := make([]ScrapeAttempt, 0)
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT fk_post_id, domain, attempted, duration_ms, status_code, error, success FROM scrape_attempts "+
+			"WHERE attempted >= ? ORDER BY attempted",
+		since.UTC().Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return attempts, err
+	}
+
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		var domain, attempted, attemptErr sql.NullString
+		var durationMs sql.NullInt64
+		attempt := ScrapeAttempt{}
+
+		err = rows.Scan(
+			&attempt.PostID,
+			&domain,
+			&attempted,
+			&durationMs,
+			&attempt.StatusCode,
+			&attemptErr,
+			&attempt.Success,
+		)
+		if err != nil {
+			return attempts, err
+		}
+
+		attempt.Domain = domain.String
+		attempt.Attempted, _ = time.Parse("2006-01-02 15:04:05", attempted.String)
+		attempt.Duration = time.Duration(durationMs.Int64) * time.Millisecond
+		attempt.Error = attemptErr.String
+
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, rows.Err()
+}
+
+func (s *sqlStore) SaveDiscoveredFeeds(ctx context.Context, post Post, feeds []string) ([]string, error) {
+	newFeeds := make([]string, 0)
+
+	for _, feed := range feeds {
+		result, err := s.db.ExecContext(
+			ctx,
+			s.dialect.insertIgnoreQuery+" discovered_feeds (url, fk_post_id, discovered) VALUES (?, ?, ?)",
+			feed,
+			post.PostID,
+			clock.Now().UTC().Format("2006-01-02 15:04:05"),
+		)
+		if err != nil {
+			return newFeeds, err
+		}
+
+		if inserted, err := result.RowsAffected(); err == nil && inserted > 0 {
+			newFeeds = append(newFeeds, feed)
+		}
+	}
+
+	return newFeeds, nil
+}
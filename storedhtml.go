@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// StoredHtmlConfig bounds the html kept in posts.content, since its only
+// consumer is extracting metadata again, e.g. by reparse, and most of it
+// comes from the head. Pages are always parsed in full before saving.
+type StoredHtmlConfig struct {
+	// HeadOnly keeps the document up to the end of its head, which leaves
+	// nothing for reparse to read the body-derived fields from
+	HeadOnly bool `json:"headOnly"`
+	// MaxBytes keeps at most the first n bytes, 0 for no limit
+	MaxBytes int `json:"maxBytes"`
+}
+
+// reparsable refuses reparsing html kept without its body, which would
+// recompute the word count, reading time, simhash, tags, direction and body
+// json-ld from nothing.
+func (c StoredHtmlConfig) reparsable() error {
+	if c.HeadOnly {
+		return errors.New("storedHtml.headOnly keeps no body to reparse")
+	}
+
+	return nil
+}
+
+// trimStoredHtml cuts a page down to what the config keeps.
+func trimStoredHtml(pageHtml string, config StoredHtmlConfig) string {
+	if config.HeadOnly {
+		pageHtml = htmlHead(pageHtml)
+	}
+
+	if config.MaxBytes > 0 && len(pageHtml) > config.MaxBytes {
+		pageHtml = truncateHtml(pageHtml, config.MaxBytes)
+	}
+
+	return pageHtml
+}
+
+// htmlHead returns the page up to and including </head>, or up to where the
+// body starts when the head isn't closed.
+func htmlHead(pageHtml string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(pageHtml))
+	offset := 0
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				return pageHtml[:offset]
+			}
+			return pageHtml
+		}
+
+		raw := len(tokenizer.Raw())
+		name, _ := tokenizer.TagName()
+
+		switch {
+		case tokenType == html.EndTagToken && string(name) == "head":
+			return pageHtml[:offset+raw]
+		case tokenType == html.StartTagToken && string(name) == "body":
+			return pageHtml[:offset]
+		}
+
+		offset += raw
+	}
+}
+
+// truncateHtml cuts a page to at most n bytes, after the last complete tag
+// when there is one, and never inside a utf-8 sequence.
+func truncateHtml(pageHtml string, n int) string {
+	cut := pageHtml[:n]
+
+	if i := strings.LastIndexByte(cut, '>'); i >= 0 {
+		return cut[:i+1]
+	}
+
+	for len(cut) > 0 && !utf8.ValidString(cut) {
+		cut = cut[:len(cut)-1]
+	}
+
+	return cut
+}
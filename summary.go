@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultSummaryMinLength = 80
+	defaultSummaryMaxLength = 300
+	// minSummaryParagraphWords skips captions, bylines and the like
+	minSummaryParagraphWords = 12
+	summaryEnricherName      = "summary"
+)
+
+// SummaryConfig configures the summary enricher, which writes a description
+// from the article text for pages whose own is missing or too short.
+type SummaryConfig struct {
+	// MinLength is the shortest description, in characters, that is kept.
+	MinLength int `json:"minLength"`
+	MaxLength int `json:"maxLength"`
+}
+
+func init() {
+	registerEnricher(summaryEnricherName, func(config AppConfig) (Enricher, error) {
+		summaryConfig := config.Summary
+		if summaryConfig.MinLength <= 0 {
+			summaryConfig.MinLength = defaultSummaryMinLength
+		}
+		if summaryConfig.MaxLength <= 0 {
+			summaryConfig.MaxLength = defaultSummaryMaxLength
+		}
+		if config.MaxDescriptionLength > 0 && summaryConfig.MaxLength > config.MaxDescriptionLength {
+			summaryConfig.MaxLength = config.MaxDescriptionLength
+		}
+
+		return summaryEnricher{config: summaryConfig}, nil
+	})
+}
+
+type summaryEnricher struct {
+	config SummaryConfig
+}
+
+func (e summaryEnricher) Name() string {
+	return summaryEnricherName
+}
+
+func (e summaryEnricher) Enrich(ctx context.Context, scraped *PostScraped) error {
+	if utf8.RuneCountInString(scraped.OpenGraphTags.Description) >= e.config.MinLength {
+		return nil
+	}
+
+	summary := summarize(scraped.OpenGraphTags.articleParagraphs(), e.config.MaxLength)
+	if utf8.RuneCountInString(summary) > utf8.RuneCountInString(scraped.OpenGraphTags.Description) {
+		scraped.OpenGraphTags.Description = summary
+		scraped.OpenGraphTags.setSource("description", summaryEnricherName, summary)
+	}
+
+	return nil
+}
+
+// summarize takes the first paragraph long enough to be article text,
+// shortened to whole sentences.
+func summarize(paragraphs []string, maxLength int) string {
+	for _, paragraph := range paragraphs {
+		if len(strings.Fields(paragraph)) >= minSummaryParagraphWords {
+			return truncateSentences(paragraph, maxLength)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+const primaryTenantName = "default"
+
+// TenantConfig is another aggregator database processed by the same service.
+// Everything not set here is shared with the top level config, which is
+// itself the primary tenant.
+type TenantConfig struct {
+	Name      string           `json:"name"`
+	Db        DbConfig         `json:"db"`
+	Solr      string           `json:"solr"`
+	SolrCloud *SolrCloudConfig `json:"solrCloud"`
+	Sinks     SinksConfig      `json:"sinks"`
+}
+
+type tenant struct {
+	name   string
+	config AppConfig
+	store  Store
+	sinks  []Sink
+}
+
+// currentTenant is the tenant whose cycle is running, for tagging errors.
+// Cycles for every tenant run on the main goroutine, one at a time.
+var currentTenant = ""
+
+func (c AppConfig) tenantConfigs() []TenantConfig {
+	primary := TenantConfig{Name: primaryTenantName, Db: c.Db, Solr: c.Solr, SolrCloud: c.SolrCloud, Sinks: c.Sinks}
+
+	return append([]TenantConfig{primary}, c.Tenants...)
+}
+
+func findTenantConfig(config AppConfig, name string) (TenantConfig, bool) {
+	for _, tc := range config.tenantConfigs() {
+		if tc.Name == name {
+			return tc, true
+		}
+	}
+
+	return TenantConfig{}, false
+}
+
+// forTenant is the config a tenant's cycles run with.
+func (c AppConfig) forTenant(t TenantConfig) AppConfig {
+	c.Db = t.Db
+	c.Solr = t.Solr
+	c.SolrCloud = t.SolrCloud
+	c.Sinks = t.Sinks
+	c.Tenants = nil
+
+	if c.SinkSpill.Path != "" && t.Name != primaryTenantName {
+		c.SinkSpill.Path += "." + t.Name
+	}
+
+	return c
+}
+
+// openTenants connects to every tenant's database. A tenant that can't be
+// opened is left out rather than stopping the others.
+func openTenants(config AppConfig) []*tenant {
+	tenants := make([]*tenant, 0, len(config.Tenants)+1)
+
+	for _, tc := range config.tenantConfigs() {
+		currentTenant = tc.Name
+		tenantConfig := config.forTenant(tc)
+
+		store, err := newSqlStore(tc.Db)
+		if err != nil {
+			fmt.Println("could not open db for tenant", tc.Name, err.Error())
+			reportPhaseError("db", err)
+			continue
+		}
+
+		if tenantConfig.AutoMigrate {
+			err = store.Migrate(context.Background())
+			if err != nil {
+				fmt.Println("could not migrate db for tenant", tc.Name, err.Error())
+				reportPhaseError("db", err)
+				_ = store.Close()
+				continue
+			}
+		}
+
+		logSolrTarget(tc.Name, tenantConfig)
+
+		tenants = append(tenants, &tenant{
+			name:   tc.Name,
+			config: tenantConfig,
+			store:  newBufferingStore(store, tenantConfig.DbOutage, tc.Name),
+			sinks:  newSinks(tc.Sinks),
+		})
+	}
+
+	currentTenant = ""
+
+	return tenants
+}
+
+// reloadTenants applies a reloaded config. Adding or removing tenants, like
+// any db change, needs a restart.
+func reloadTenants(tenants []*tenant, config AppConfig) {
+	tenantConfigs := make(map[string]TenantConfig)
+	for _, tc := range config.tenantConfigs() {
+		tenantConfigs[tc.Name] = tc
+	}
+
+	for _, t := range tenants {
+		tc, ok := tenantConfigs[t.name]
+		if !ok {
+			fmt.Println("tenant", t.name, "was removed, restart to apply it")
+			continue
+		}
+
+		if tc.Db != t.config.Db {
+			fmt.Println("db settings changed for tenant", t.name, "restart to apply them")
+			tc.Db = t.config.Db
+		}
+
+		closeSinks(t.sinks)
+		t.config = config.forTenant(tc)
+		t.sinks = newSinks(tc.Sinks)
+		logSolrTarget(t.name, t.config)
+	}
+}
+
+func closeTenants(tenants []*tenant) {
+	for _, t := range tenants {
+		closeSinks(t.sinks)
+
+		err := t.store.Close()
+		if err != nil {
+			fmt.Println("could not close db for tenant", t.name, err.Error())
+		}
+	}
+}
+
+// startTenants runs a cycle for every tenant, reporting whether they all
+// succeeded.
+func startTenants(tenants []*tenant) bool {
+	ok := true
+
+	// the enrichers' budgets are for a scheduled cycle of every tenant
+	enrichment.startCycle()
+
+	for _, t := range tenants {
+		currentTenant = t.name
+		err := start(t.store, t.config, t.sinks)
+		if err != nil {
+			fmt.Println("cycle failed for tenant", t.name, err.Error())
+			metrics.count("tenants."+metricName(t.name)+".cycle.errors", 1)
+			alerts.cycleFailed(t.name, err.Error())
+			ok = false
+			continue
+		}
+
+		alerts.cycleSucceeded(t.name)
+	}
+
+	currentTenant = ""
+	metrics.push()
+
+	return ok
+}
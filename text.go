@@ -0,0 +1,129 @@
+package main
+
+import (
+	"golang.org/x/net/html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// normalizeText decodes entities that survived parsing (descriptions are
+// often double encoded), strips control characters and collapses all
+// whitespace, including non-breaking spaces and newlines, to single spaces.
+func normalizeText(text string) string {
+	for i := 0; i < 2 && strings.Contains(text, "&"); i++ {
+		text = html.UnescapeString(text)
+	}
+
+	text = strings.Map(func(r rune) rune {
+		// unicode.IsSpace already covers non-breaking spaces
+		if unicode.IsSpace(r) || r == '\u200b' {
+			return ' '
+		}
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, text)
+
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// truncateRunes shortens text to at most max runes without splitting a
+// multi-byte character. A max of 0 means no limit.
+func truncateRunes(text string, max int) string {
+	if max <= 0 {
+		return text
+	}
+
+	count := 0
+	for i := range text {
+		if count == max {
+			return strings.TrimRightFunc(text[:i], unicode.IsSpace)
+		}
+		count++
+	}
+
+	return text
+}
+
+// truncateSentences shortens text to as many whole sentences as fit in max
+// runes. When even the first sentence is too long it's cut at a word and
+// ends with an ellipsis.
+func truncateSentences(text string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	truncated := truncateRunes(text, max)
+
+	end := -1
+	for i, r := range truncated {
+		if r != '.' && r != '!' && r != '?' {
+			continue
+		}
+
+		// a sentence ends at punctuation followed by a space, not in 3.5
+		next := i + utf8.RuneLen(r)
+		if next < len(text) && text[next] == ' ' {
+			end = next
+		}
+	}
+
+	if end != -1 {
+		return truncated[:end]
+	}
+
+	return truncateWords(text, max)
+}
+
+// truncateWords cuts text at the last word that fits in max runes along
+// with an ellipsis, or mid-word when a single word is too long.
+func truncateWords(text string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	if i := strings.LastIndex(truncateRunes(text, max-1), " "); i > 0 {
+		return strings.TrimRightFunc(text[:i], unicode.IsPunct) + "…"
+	}
+
+	return truncateRunes(text, max-1) + "…"
+}
+
+// truncateDescription cuts a description to whole sentences, unless that
+// loses more than half of what would fit, as when the second sentence is a
+// long one, in which case it's cut at a word instead.
+func truncateDescription(text string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	if sentences := truncateSentences(text, max); utf8.RuneCountInString(sentences)*2 >= max {
+		return sentences
+	}
+
+	return truncateWords(text, max)
+}
+
+// normalize cleans up the free text fields before they are stored and
+// indexed.
+func (t *OpenGraphTags) normalize(maxDescriptionLength int) {
+	t.Description = truncateRunes(normalizeText(t.Description), maxDescriptionLength)
+	t.Title = normalizeText(t.Title)
+	t.DublinCore.Title = normalizeText(t.DublinCore.Title)
+	t.DublinCore.Description = normalizeText(t.DublinCore.Description)
+	t.Article.Section = normalizeText(t.Article.Section)
+
+	for i := range t.Article.Authors {
+		t.Article.Authors[i] = normalizeText(t.Article.Authors[i])
+	}
+
+	for i := range t.Article.Tags {
+		t.Article.Tags[i] = normalizeText(t.Article.Tags[i])
+	}
+
+	for i := range t.Keywords {
+		t.Keywords[i] = normalizeText(t.Keywords[i])
+	}
+}
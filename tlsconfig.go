@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// TlsConfig applies to fetching pages only, not to solr or the sinks.
+type TlsConfig struct {
+	// MinVersion is "1.0", "1.1", "1.2" or "1.3".
+	MinVersion string `json:"minVersion"`
+	// CaBundle is a pem file of extra roots trusted alongside the system ones.
+	CaBundle string `json:"caBundle"`
+	// InsecureHosts are fetched without verifying their certificate, e.g.
+	// blogs whose certificate has expired. Subdomains are included.
+	InsecureHosts []string `json:"insecureHosts"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newFetchTlsConfig returns nil when nothing is configured, leaving the
+// transport's defaults alone. InsecureHosts aren't part of it: they get a
+// transport of their own, see WithInsecureHosts.
+func newFetchTlsConfig(config TlsConfig) (*tls.Config, error) {
+	if config.MinVersion == "" && config.CaBundle == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if config.MinVersion != "" {
+		version, ok := tlsVersions[config.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls version %s", config.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if config.CaBundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := ioutil.ReadFile(config.CaBundle)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca bundle: %w", err)
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CaBundle)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// WithInsecureHosts fetches from these hosts, and their subdomains, without
+// verifying their certificate. They go through a transport of their own, so
+// every other host is verified by crypto/tls against the host dialed,
+// including ip addresses, which are never sent as a server name.
+func WithInsecureHosts(hosts []string) Option {
+	return func(f *httpFetcher) {
+		f.insecureHosts = hosts
+	}
+}
+
+func (f *httpFetcher) isInsecureHost(host string) bool {
+	return hostMatches(host, f.insecureHosts) || f.domains.insecure(host)
+}
+
+// insecureTransport is a copy of transport that doesn't verify certificates.
+func insecureTransport(transport *http.Transport) *http.Transport {
+	insecure := transport.Clone()
+	if insecure.TLSClientConfig == nil {
+		insecure.TLSClientConfig = &tls.Config{}
+	} else {
+		insecure.TLSClientConfig = insecure.TLSClientConfig.Clone()
+	}
+
+	insecure.TLSClientConfig.InsecureSkipVerify = true
+
+	return insecure
+}
+
+// hostMatches reports whether host is one of domains or a subdomain of one.
+func hostMatches(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
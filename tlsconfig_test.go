@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newOtherNameTlsServer serves over tls with a trusted certificate that is
+// only valid for other.example, returning the pool that trusts it.
+func newOtherNameTlsServer(t *testing.T) (*httptest.Server, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other.example"},
+		DNSNames:              []string{"other.example"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return server, pool
+}
+
+func TestInsecureHostsStillVerifyIpHosts(t *testing.T) {
+	server, pool := newOtherNameTlsServer(t)
+
+	tests := []struct {
+		name          string
+		insecureHosts []string
+		ok            bool
+	}{
+		{"no insecure hosts", nil, false},
+		{"another host is insecure", []string{"insecure.example"}, false},
+		{"the ip is insecure", []string{"127.0.0.1"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetcher := NewFetcher(WithTLSConfig(&tls.Config{RootCAs: pool}), WithInsecureHosts(test.insecureHosts))
+			defer func() {
+				_ = fetcher.Close()
+			}()
+
+			_, status, err := fetcher.Fetch(Post{}, server.URL)
+			if test.ok && (err != nil || status != http.StatusOK) {
+				t.Errorf("Fetch = %d, %v, want the page", status, err)
+			}
+			if !test.ok && err == nil {
+				t.Errorf("Fetch = %d, want the certificate for another name refused", status)
+			}
+		})
+	}
+}
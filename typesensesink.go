@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type TypesenseSinkConfig struct {
+	// Enabled turns the sink off without removing its settings. It is on
+	// whenever it is configured unless set to false.
+	Enabled    *bool             `json:"enabled"`
+	Host       string            `json:"host"`
+	Collection string            `json:"collection"`
+	ApiKey     string            `json:"apiKey"`
+	Fields     map[string]string `json:"fields"`
+	// Action defaults to emplace, which like a solr atomic update only
+	// changes the given fields. upsert replaces the whole document.
+	Action string `json:"action"`
+}
+
+type typesenseSink struct {
+	config     TypesenseSinkConfig
+	httpClient *http.Client
+}
+
+func newTypesenseSink(config TypesenseSinkConfig) *typesenseSink {
+	if config.Collection == "" {
+		config.Collection = "posts"
+	}
+
+	if config.Action == "" {
+		config.Action = "emplace"
+	}
+
+	return &typesenseSink{config: config, httpClient: &http.Client{}}
+}
+
+func (s *typesenseSink) Name() string {
+	return "typesense"
+}
+
+func (s *typesenseSink) searchIndex() {}
+
+func (s *typesenseSink) Write(scraped PostScraped) error {
+	doc := searchDocument(scraped, "id", s.config.Fields)
+	// typesense ids are strings
+	doc["id"] = fmt.Sprint(scraped.Post.PostID)
+
+	documentsUrl := strings.TrimRight(s.config.Host, "/") + "/collections/" + url.PathEscape(s.config.Collection) +
+		"/documents?action=" + url.QueryEscape(s.config.Action)
+
+	headers := map[string]string{
+		"X-TYPESENSE-API-KEY": s.config.ApiKey,
+	}
+
+	return sendJson(s.httpClient, "POST", documentsUrl, headers, doc)
+}
+
+func (s *typesenseSink) Close() error {
+	return nil
+}
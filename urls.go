@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// defaultTrackingParams are removed from stored urls when the config doesn't
+// give its own list. A trailing * matches any suffix.
+var defaultTrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"msclkid",
+	"yclid",
+	"mc_cid",
+	"mc_eid",
+	"igshid",
+	"_ga",
+	"_hsenc",
+	"_hsmi",
+}
+
+// stripTrackingParams removes tracking query parameters and the fragment from
+// a url, leaving it untouched if it cannot be parsed.
+func stripTrackingParams(rawUrl string, params []string) string {
+	if rawUrl == "" {
+		return rawUrl
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			if isTrackingParam(key, params) {
+				query.Del(key)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String()
+}
+
+func isTrackingParam(key string, params []string) bool {
+	key = strings.ToLower(key)
+	for _, param := range params {
+		param = strings.ToLower(param)
+		if strings.HasSuffix(param, "*") {
+			if strings.HasPrefix(key, strings.TrimSuffix(param, "*")) {
+				return true
+			}
+		} else if key == param {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizePostUrl reduces a post url to a form where urls for the same page
+// compare equal.
+func normalizePostUrl(rawUrl string, params []string) string {
+	if params == nil {
+		params = defaultTrackingParams
+	}
+
+	u, err := url.Parse(stripTrackingParams(strings.TrimSpace(rawUrl), params))
+	if err != nil {
+		return rawUrl
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+	}
+
+	if u.Path != "/" {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = strings.TrimSuffix(u.RawPath, "/")
+	}
+
+	return u.String()
+}
+
+// groupPostsByUrl groups posts that point at the same page, keeping the
+// order in which each url was first seen.
+func groupPostsByUrl(posts []Post, params []string) [][]Post {
+	groups := make([][]Post, 0, len(posts))
+	groupIndex := make(map[string]int)
+
+	for _, post := range posts {
+		key := normalizePostUrl(post.Url, params)
+
+		if i, ok := groupIndex[key]; ok {
+			groups[i] = append(groups[i], post)
+			continue
+		}
+
+		groupIndex[key] = len(groups)
+		groups = append(groups, []Post{post})
+	}
+
+	return groups
+}
+
+// posts returns every post the scraped page belongs to.
+func (s PostScraped) posts() []Post {
+	return append([]Post{s.Post}, s.Duplicates...)
+}
+
+// cleanUrls strips tracking parameters from the urls that are stored.
+func (t *OpenGraphTags) cleanUrls(params []string) {
+	if params == nil {
+		params = defaultTrackingParams
+	}
+
+	t.FeaturedImage = stripTrackingParams(t.FeaturedImage, params)
+	t.Url = stripTrackingParams(t.Url, params)
+	t.Canonical = stripTrackingParams(t.Canonical, params)
+}
+
+// canonicalUrl is the url the page says it should be known by.
+func (t OpenGraphTags) canonicalUrl() string {
+	if t.Canonical != "" {
+		return t.Canonical
+	}
+
+	return t.Url
+}
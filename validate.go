@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// validateConfig reports every problem with the config at once, so a bad
+// deploy fails at startup instead of on the first cycle.
+func validateConfig(config AppConfig) []error {
+	problems := make([]error, 0)
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	for _, duration := range []struct{ name, value string }{
+		{"interval", config.Interval},
+		{"solrTimeout", config.SolrTimeout},
+		{"dbOutage.reconnectBackoff", config.DbOutage.ReconnectBackoff},
+		{"fetch.dns.timeout", config.Fetch.Dns.Timeout},
+	} {
+		if duration.value == "" {
+			continue
+		}
+
+		if d, err := time.ParseDuration(duration.value); err != nil || d <= 0 {
+			add("%s: %q is not a positive duration", duration.name, duration.value)
+		}
+	}
+
+	for _, pattern := range config.SoftNotFoundPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			add("softNotFoundPatterns: %s", err.Error())
+		}
+	}
+
+	if config.Fetch.Proxy != "" {
+		if problem := validateUrl(config.Fetch.Proxy, "http", "https", "socks5"); problem != "" {
+			add("fetch.proxy: %s", problem)
+		}
+	}
+
+	_, domainProblems := compileDomains(config.Domains)
+	problems = append(problems, domainProblems...)
+
+	for i, domain := range config.Domains {
+		if domain.Interval != "" {
+			if d, err := time.ParseDuration(domain.Interval); err != nil || d <= 0 {
+				add("domains[%d].interval: %q is not a positive duration", i, domain.Interval)
+			}
+		}
+
+		if domain.Proxy != "" && domain.Proxy != directProxy {
+			if problem := validateUrl(domain.Proxy, "http", "https", "socks5"); problem != "" {
+				add("domains[%d].proxy: %s", i, problem)
+			}
+		}
+
+		for _, name := range domain.Enrichers {
+			if _, ok := enricherFactories[name]; !ok {
+				add("domains[%d].enrichers: unknown enricher %s", i, name)
+			}
+		}
+	}
+
+	if config.MaxDescriptionLength < 0 || config.DescriptionLimits.Db < 0 || config.DescriptionLimits.Solr < 0 {
+		add("maxDescriptionLength and descriptionLimits can't be negative")
+	}
+
+	if config.Fetch.Cassette.Path != "" && config.Fetch.Cassette.Mode != cassetteRecord && config.Fetch.Cassette.Mode != cassetteReplay {
+		add("fetch.cassette.mode: %q should be record or replay", config.Fetch.Cassette.Mode)
+	}
+
+	if config.Fetch.Dns.DohUrl != "" {
+		if problem := validateUrl(config.Fetch.Dns.DohUrl, "https", "http"); problem != "" {
+			add("fetch.dns.dohUrl: %s", problem)
+		}
+	}
+
+	for _, server := range config.Fetch.Dns.Servers {
+		host := server
+		if h, _, err := net.SplitHostPort(server); err == nil {
+			host = h
+		}
+
+		if net.ParseIP(host) == nil {
+			add("fetch.dns.servers: %q is not an ip address", server)
+		}
+	}
+
+	if config.Sentry.Dsn != "" {
+		if _, err := newSentryReporter(config.Sentry); err != nil {
+			add("sentry.dsn: %s", err.Error())
+		}
+	}
+
+	names := map[string]bool{}
+
+	for i, tc := range config.tenantConfigs() {
+		prefix := ""
+		if i > 0 {
+			prefix = fmt.Sprintf("tenants[%d].", i-1)
+
+			if tc.Name == "" {
+				add("%sname is required", prefix)
+			}
+		}
+
+		if names[tc.Name] {
+			add("%sname: tenant %q is defined more than once", prefix, tc.Name)
+		}
+
+		names[tc.Name] = true
+
+		for _, problem := range validateDbConfig(tc.Db) {
+			add("%sdb.%s", prefix, problem)
+		}
+
+		for _, problem := range validateSolrConfig(tc) {
+			add("%s%s", prefix, problem)
+		}
+
+		for _, problem := range validateSinksConfig(tc.Sinks) {
+			add("%ssinks.%s", prefix, problem)
+		}
+	}
+
+	return problems
+}
+
+func validateDbConfig(config DbConfig) []string {
+	problems := make([]string, 0)
+
+	switch config.Driver {
+	case "", "mysql":
+		for _, field := range []struct{ name, value string }{
+			{"server", config.Server},
+			{"dbName", config.DbName},
+			{"user", config.User},
+		} {
+			if field.value == "" {
+				problems = append(problems, field.name+" is required for mysql")
+			}
+		}
+	case "sqlite":
+		if config.Path == "" {
+			problems = append(problems, "path is required for sqlite")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("driver: unsupported db driver %q", config.Driver))
+	}
+
+	switch strings.ToLower(config.Charset) {
+	case "", "utf8mb4", "utf8", "utf8mb3":
+	default:
+		problems = append(problems, fmt.Sprintf("charset: %q should be utf8mb4 or utf8", config.Charset))
+	}
+
+	if config.FourByteChars != "" && config.FourByteChars != fourByteReplace && config.FourByteChars != fourByteStrip {
+		problems = append(problems, fmt.Sprintf("fourByteChars: %q should be replace or strip", config.FourByteChars))
+	}
+
+	return problems
+}
+
+func validateSolrConfig(tc TenantConfig) []string {
+	problems := make([]string, 0)
+
+	if tc.Solr != "" {
+		if problem := validateUrl(tc.Solr, "http", "https"); problem != "" {
+			problems = append(problems, "solr: "+problem)
+		}
+	}
+
+	if tc.SolrCloud == nil {
+		return problems
+	}
+
+	if tc.Solr != "" {
+		problems = append(problems, "solr and solrCloud can't both be set")
+	}
+
+	if tc.SolrCloud.Collection == "" {
+		problems = append(problems, "solrCloud.collection is required")
+	}
+
+	if len(tc.SolrCloud.Nodes) == 0 && len(tc.SolrCloud.ZkHosts) == 0 {
+		problems = append(problems, "solrCloud needs either nodes or zkHosts")
+	}
+
+	for _, node := range tc.SolrCloud.Nodes {
+		if problem := validateUrl(node, "http", "https"); problem != "" {
+			problems = append(problems, "solrCloud.nodes: "+problem)
+		}
+	}
+
+	return problems
+}
+
+func validateSinksConfig(config SinksConfig) []string {
+	problems := make([]string, 0)
+
+	for _, sink := range []struct {
+		name, field, value string
+		enabled            *bool
+		schemes            []string
+	}{
+		{"jsonl", "path", config.Jsonl.Path, config.Jsonl.Enabled, nil},
+		{"amqp", "url", config.Amqp.Url, config.Amqp.Enabled, []string{"amqp", "amqps"}},
+		{"mqtt", "broker", config.Mqtt.Broker, config.Mqtt.Enabled, []string{"tcp", "ssl", "tls", "mqtt", "mqtts", "ws", "wss"}},
+		{"meilisearch", "host", config.Meilisearch.Host, config.Meilisearch.Enabled, []string{"http", "https"}},
+		{"openSearch", "endpoint", config.OpenSearch.Endpoint, config.OpenSearch.Enabled, []string{"http", "https"}},
+		{"typesense", "host", config.Typesense.Host, config.Typesense.Enabled, []string{"http", "https"}},
+	} {
+		switch {
+		case sink.enabled != nil && !*sink.enabled:
+			continue
+		case sink.value == "" && sink.enabled != nil:
+			problems = append(problems, fmt.Sprintf("%s is enabled but %s.%s is empty", sink.name, sink.name, sink.field))
+		case sink.value != "" && sink.schemes != nil:
+			if problem := validateUrl(sink.value, sink.schemes...); problem != "" {
+				problems = append(problems, fmt.Sprintf("%s.%s: %s", sink.name, sink.field, problem))
+			}
+		}
+	}
+
+	if config.Amqp.Url != "" && config.Amqp.Exchange == "" && (config.Amqp.Enabled == nil || *config.Amqp.Enabled) {
+		problems = append(problems, "amqp.exchange is required")
+	}
+
+	if config.Mqtt.Qos > 2 {
+		problems = append(problems, "mqtt.qos must be 0, 1 or 2")
+	}
+
+	if config.Jsonl.MaxBytes < 0 || config.Jsonl.MaxBackups < 0 {
+		problems = append(problems, "jsonl.maxBytes and jsonl.maxBackups can't be negative")
+	}
+
+	return problems
+}
+
+// validateUrl returns what is wrong with an absolute url, if anything.
+func validateUrl(rawUrl string, schemes ...string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return fmt.Sprintf("%q is not a valid url", rawUrl)
+	}
+
+	if u.Host == "" {
+		return fmt.Sprintf("%q has no host", rawUrl)
+	}
+
+	for _, scheme := range schemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("%q should start with %s://", rawUrl, strings.Join(schemes, "://, "))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const waybackAvailabilityUrl = "https://archive.org/wayback/available"
+
+type waybackAvailability struct {
+	ArchivedSnapshots struct {
+		Closest struct {
+			Available bool   `json:"available"`
+			Url       string `json:"url"`
+			Timestamp string `json:"timestamp"`
+		} `json:"closest"`
+	} `json:"archived_snapshots"`
+}
+
+// isDeadLink reports whether the post's page is gone rather than temporarily
+// unavailable.
+func isDeadLink(scraped PostScraped) bool {
+	if scraped.StatusCode == http.StatusNotFound || scraped.StatusCode == http.StatusGone {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	return errors.As(scraped.FetchErr, &dnsErr) && dnsErr.IsNotFound
+}
+
+// fetchWaybackFallback replaces a dead page with the latest wayback machine
+// snapshot of it, if there is one.
+func fetchWaybackFallback(fetcher Fetcher, scrapedPost *PostScraped) {
+	snapshotUrl, timestamp, err := findWaybackSnapshot(fetcher, scrapedPost.Post.Url)
+	if err != nil {
+		fmt.Println("could not query the wayback machine for", scrapedPost.Post.Url, err.Error())
+		return
+	}
+
+	if snapshotUrl == "" {
+		return
+	}
+
+	fmt.Println("falling back to wayback machine snapshot for", scrapedPost.Post.Url)
+
+	archived := PostScraped{
+		Post: scrapedPost.Post,
+	}
+
+	archived.Html, archived.StatusCode, archived.FetchErr = fetcher.Fetch(scrapedPost.Post, snapshotUrl)
+	if archived.Html == "" {
+		return
+	}
+
+	getOgTagsFromHtml(&archived)
+
+	archived.OpenGraphTags.ArchivedAt = waybackTimestamp(timestamp)
+	*scrapedPost = archived
+}
+
+// findWaybackSnapshot asks the availability api for the latest snapshot of a
+// page, through the fetcher so a cassette records the answer too.
+func findWaybackSnapshot(fetcher Fetcher, pageUrl string) (string, string, error) {
+	page := fetcher.FetchPage(Post{}, waybackAvailabilityUrl+"?url="+url.QueryEscape(pageUrl))
+	if page.Err != nil {
+		return "", "", page.Err
+	}
+
+	if page.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("availability api returned status %d", page.StatusCode)
+	}
+
+	availability := waybackAvailability{}
+	err := json.Unmarshal([]byte(page.Html), &availability)
+	if err != nil {
+		return "", "", err
+	}
+
+	closest := availability.ArchivedSnapshots.Closest
+	if !closest.Available || closest.Url == "" {
+		return "", "", nil
+	}
+
+	return rawSnapshotUrl(closest.Url, closest.Timestamp), closest.Timestamp, nil
+}
+
+// rawSnapshotUrl asks for the page as it was archived, without the wayback
+// toolbar and link rewriting.
+func rawSnapshotUrl(snapshotUrl string, timestamp string) string {
+	if timestamp == "" {
+		return snapshotUrl
+	}
+
+	return strings.Replace(snapshotUrl, "/"+timestamp+"/", "/"+timestamp+"id_/", 1)
+}
+
+func waybackTimestamp(timestamp string) string {
+	t, err := time.Parse("20060102150405", timestamp)
+	if err != nil {
+		return timestamp
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}